@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+    corev1 "k8s.io/api/core/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -43,9 +44,23 @@ type PodsCountArgs struct {
     MaxCount int `json:"max_count"`
 }
 
+// OvercommitArgs caps predicted usage and requests of pods on a node at
+// percents of its allocatable resources. The caps are independent, zero
+// disables the usage cap. Requests never exceed allocatable resources,
+// because the kubelet rejects such pods.
+type OvercommitArgs struct {
+    // +kubebuilder:validation:Minimum=0
+    MaxUsage int64 `json:"max_usage,omitempty"`
+    // Defaults to 100.
+    // +kubebuilder:validation:Minimum=0
+    // +kubebuilder:validation:Maximum=100
+    MaxRequests int64 `json:"max_requests,omitempty"`
+}
+
 type ConstraintArgsList struct {
     ResourceRange *ResourceRangeArgs `json:"resource_range,omitempty"`
     PodsCount     *PodsCountArgs     `json:"pods_count,omitempty"`
+    Overcommit    *OvercommitArgs    `json:"overcommit,omitempty"`
 }
 
 type EconomyArgs struct {
@@ -75,11 +90,17 @@ type TopologySpreadArgs struct {
     Keys   []TopologyKey `json:"keys"`
 }
 
+type CostArgs struct {
+    // +kubebuilder:validation:Minimum=1
+    Weight int `json:"weight"`
+}
+
 type PreferenceArgsList struct {
     Economy            *EconomyArgs            `json:"economy,omitempty"`
     Perfomance         *PerfomanceArgs         `json:"perfomance,omitempty"`
     Balanced           *BalancedArgs           `json:"balanced,omitempty"`
     TopologySpread     *TopologySpreadArgs     `json:"topology_spread,omitempty"`
+    Cost               *CostArgs               `json:"cost,omitempty"`
 }
 
 type AlgorithmArgs struct {
@@ -92,21 +113,323 @@ type AlgorithmArgs struct {
     OptimizerMaxNodesPerCycle int `json:"optimizer_max_nodes_per_cycle,omitempty"`
 }
 
+type ExecutionArgs struct {
+    // +kubebuilder:validation:Minimum=1
+    MovementTimeout int `json:"movement_timeout,omitempty"`
+    // +kubebuilder:validation:Minimum=1
+    MaxParallelMovements int `json:"max_parallel_movements,omitempty"`
+    // +kubebuilder:validation:Minimum=0
+    MaxIncomingMovementsPerNode int `json:"max_incoming_movements_per_node,omitempty"`
+    // +kubebuilder:validation:Minimum=0
+    MaxOutgoingMovementsPerNode int `json:"max_outgoing_movements_per_node,omitempty"`
+    AllowDeleteBeforeCreate bool `json:"allow_delete_before_create,omitempty"`
+    // +kubebuilder:validation:Enum=none;minikube;cluster_api;cluster_autoscaler;webhook;exec
+    NodeDriver string `json:"node_driver,omitempty"`
+    // +kubebuilder:validation:Minimum=1
+    NodeCreationTimeout int `json:"node_creation_timeout,omitempty"`
+    ClusterAPI *ClusterAPIArgs `json:"cluster_api,omitempty"`
+    ClusterAutoscaler *ClusterAutoscalerArgs `json:"cluster_autoscaler,omitempty"`
+    Webhook *WebhookArgs `json:"webhook,omitempty"`
+    Exec *ExecArgs `json:"exec,omitempty"`
+}
+
+// ClusterAPIArgs points to the MachineDeployment or MachineSet
+// whose replicas the cluster_api node driver scales.
+type ClusterAPIArgs struct {
+    Namespace string `json:"namespace"`
+    MachineDeployment string `json:"machine_deployment,omitempty"`
+    MachineSet string `json:"machine_set,omitempty"`
+    // Sets of the same kind by node pool name. Nodes of other pools are
+    // added to MachineDeployment or MachineSet.
+    Pools map[string]string `json:"pools,omitempty"`
+}
+
+// ClusterAutoscalerArgs configures the cluster_autoscaler node driver.
+// The planner does not create nodes in this mode, it only marks empty nodes
+// as scale-down candidates and keeps node groups within their bounds.
+// cluster-autoscaler decides on its own which nodes to delete and when.
+type ClusterAutoscalerArgs struct {
+    // Label of nodes with the name of their node group.
+    NodeGroupLabel string `json:"node_group_label"`
+    StatusNamespace string `json:"status_namespace,omitempty"`
+    StatusConfigMap string `json:"status_config_map,omitempty"`
+}
+
+// WebhookArgs configures the webhook node driver. See
+// driver.WebhookDriver for the contract of the service.
+type WebhookArgs struct {
+    URL string `json:"url"`
+}
+
+// ExecArgs configures the exec node driver. Arguments are Go templates:
+// {{.Id}} is the id of the operation, {{.Pool}}, {{.Cpu}}, {{.Memory}} and
+// {{.Labels}} describe the node to add and {{.Node}} is the name of the node
+// to delete.
+type ExecArgs struct {
+    Command string `json:"command"`
+    AddArgs []string `json:"add_args,omitempty"`
+    DeleteArgs []string `json:"delete_args,omitempty"`
+    // Seconds every command may run, 600 by default.
+    // +kubebuilder:validation:Minimum=1
+    Timeout int `json:"timeout,omitempty"`
+}
+
+// NodePoolArgs describes a group of identical nodes. Nodes belong to the
+// pool when they have all of its labels.
+type NodePoolArgs struct {
+    Name string `json:"name"`
+    // Node shape, e.g. "4" and "16Gi".
+    Cpu    string `json:"cpu"`
+    Memory string `json:"memory"`
+    Labels map[string]string `json:"labels,omitempty"`
+    Taints []corev1.Taint `json:"taints,omitempty"`
+    // +kubebuilder:validation:Minimum=0
+    MinNodes int `json:"min_nodes,omitempty"`
+    // +kubebuilder:validation:Minimum=0
+    MaxNodes int `json:"max_nodes,omitempty"`
+    // Price of a node per hour, e.g. "0.192".
+    HourlyCost string `json:"hourly_cost,omitempty"`
+}
+
+// VPAArgs publishes recommendations in status.recommendation of
+// VerticalPodAutoscaler objects that target owners of pods, so that the VPA
+// updater and admission controller apply them.
+type VPAArgs struct {
+    // Only objects that list this name in spec.recommenders are updated.
+    // Empty name updates every object.
+    RecommenderName string `json:"recommender_name,omitempty"`
+    // The planner updates pods as well if true. Otherwise recommendations
+    // are only published.
+    UpdatePods bool `json:"update_pods,omitempty"`
+}
+
+// ResourceApplyArgs selects how recommended requests reach the cluster:
+// "pod" recreates the pod with new requests, "owner" patches the pod
+// template of its Deployment, StatefulSet or DaemonSet and "in_place"
+// resizes the running pod. Methods that can not be used for a pod fall
+// back to the next one in this order: in_place, owner, pod.
+type ResourceApplyArgs struct {
+    // +kubebuilder:validation:Enum=pod;owner;in_place
+    Method string `json:"method,omitempty"`
+    // Methods by namespace, overriding the default one.
+    Namespaces map[string]string `json:"namespaces,omitempty"`
+}
+
+// MetricsSourceArgs selects where usage samples come from and where they
+// are kept between restarts.
+type MetricsSourceArgs struct {
+    // Defaults to metrics_server.
+    // +kubebuilder:validation:Enum=metrics_server;prometheus
+    Type       string          `json:"type,omitempty"`
+    Prometheus *PrometheusArgs `json:"prometheus,omitempty"`
+    // Directory of the on-disk history, e.g. a mounted volume. The last
+    // history_size samples are kept in a ring of files, 60 samples per
+    // file, and loaded on start.
+    HistoryDir string `json:"history_dir,omitempty"`
+    // Defaults to 1440.
+    // +kubebuilder:validation:Minimum=1
+    HistorySize int `json:"history_size,omitempty"`
+}
+
+// PrometheusArgs configures the prometheus metrics source. Queries use
+// cAdvisor metrics with namespace, pod, container and node labels. On
+// start the history of metrics_max_age is loaded with range queries.
+type PrometheusArgs struct {
+    URL string `json:"url"`
+    // Range of rate() in queries. Defaults to "5m".
+    RateWindow string `json:"rate_window,omitempty"`
+}
+
+// SizingArgs selects what the rescheduler packs pods by: "requests",
+// "usage", a percentile of usage observed over the metrics window, or
+// "forecast", the peak of usage expected over the forecast horizon. Pods
+// without metrics are sized by requests. Planning by usage does not keep
+// requests within allocatable resources, the overcommit constraint does.
+type SizingArgs struct {
+    // +kubebuilder:validation:Enum=requests;usage;forecast
+    Source string `json:"source,omitempty"`
+    // Percentile of usage. Defaults to 95. Pods with too short history for
+    // a forecast are sized by it too.
+    // +kubebuilder:validation:Minimum=1
+    // +kubebuilder:validation:Maximum=100
+    Percentile int           `json:"percentile,omitempty"`
+    Forecast   *ForecastArgs `json:"forecast,omitempty"`
+}
+
+// ForecastArgs configures Holt-Winters forecasts of pod usage.
+type ForecastArgs struct {
+    // Smoothing factors of the level, the trend and the season between 0
+    // and 1, e.g. "0.5". Default to 0.5, 0.1 and 0.3.
+    Alpha string `json:"alpha,omitempty"`
+    Beta  string `json:"beta,omitempty"`
+    Gamma string `json:"gamma,omitempty"`
+    // Length of the season in seconds, e.g. 86400 for daily peaks. Zero
+    // disables the season. Metrics have to be kept for two seasons.
+    // +kubebuilder:validation:Minimum=0
+    Season int `json:"season,omitempty"`
+    // Seconds to forecast. Defaults to the planning interval.
+    // +kubebuilder:validation:Minimum=1
+    Horizon int `json:"horizon,omitempty"`
+}
+
+// ResourceUpdateArgs tunes resource update strategies.
+type ResourceUpdateArgs struct {
+    // Percentile of the histogram strategy. Defaults to 90.
+    // +kubebuilder:validation:Minimum=1
+    // +kubebuilder:validation:Maximum=100
+    HistogramPercentile int `json:"histogram_percentile,omitempty"`
+    // Number of seconds after which the weight of a sample in the histogram
+    // halves. Defaults to a day.
+    // +kubebuilder:validation:Minimum=1
+    HalfLife int `json:"half_life,omitempty"`
+    // Number of standard deviations the mean_stddev strategy adds to the
+    // mean, e.g. "2.5". Defaults to 2.
+    StddevFactor string `json:"stddev_factor,omitempty"`
+    // Percents added to every recommendation.
+    // +kubebuilder:validation:Minimum=0
+    Margin int `json:"margin,omitempty"`
+    // The first bounds matching a container are used.
+    Bounds []ContainerBoundsArgs `json:"bounds,omitempty"`
+    // Limits are set to requests multiplied by the ratio, e.g. "1.5".
+    // Without a ratio limits are kept, but never below requests.
+    CpuLimitRatio    string `json:"cpu_limit_ratio,omitempty"`
+    MemoryLimitRatio string `json:"memory_limit_ratio,omitempty"`
+    // Percents added to memory of OOM killed containers. Defaults to 20.
+    // +kubebuilder:validation:Minimum=0
+    OOMBump int `json:"oom_bump,omitempty"`
+    // Cpu of containers that are throttled in more than this percent of
+    // periods on average is raised by ThrottlingBump percents. Zero
+    // disables the check.
+    // +kubebuilder:validation:Minimum=0
+    // +kubebuilder:validation:Maximum=100
+    ThrottlingThreshold int `json:"throttling_threshold,omitempty"`
+    // Defaults to 20.
+    // +kubebuilder:validation:Minimum=0
+    ThrottlingBump int `json:"throttling_bump,omitempty"`
+}
+
+// ContainerBoundsArgs limits recommended requests, e.g. "100m" and "2Gi".
+// Bounds without a container name match every container.
+type ContainerBoundsArgs struct {
+    Container string `json:"container,omitempty"`
+    MinCpu    string `json:"min_cpu,omitempty"`
+    MaxCpu    string `json:"max_cpu,omitempty"`
+    MinMemory string `json:"min_memory,omitempty"`
+    MaxMemory string `json:"max_memory,omitempty"`
+}
+
+// ScaleDownArgs limits which nodes and how often the node policy deletes.
+// The last scale-up and recent deletions are kept in the planner-node-changes
+// ConfigMap, so a restart of the planner does not reset them.
+type ScaleDownArgs struct {
+    // Nodes younger than this number of seconds are kept.
+    // +kubebuilder:validation:Minimum=0
+    MinNodeAge int `json:"min_node_age,omitempty"`
+    // Nodes whose cpu or memory usage in percents is at or above the
+    // threshold are kept. Zero disables the check.
+    // +kubebuilder:validation:Minimum=0
+    // +kubebuilder:validation:Maximum=100
+    UtilizationThreshold int `json:"utilization_threshold,omitempty"`
+    // No nodes are deleted for this number of seconds after a scale-up.
+    // +kubebuilder:validation:Minimum=0
+    CooldownAfterScaleUp int `json:"cooldown_after_scale_up,omitempty"`
+    // +kubebuilder:validation:Minimum=0
+    MaxDeletionsPerHour int `json:"max_deletions_per_hour,omitempty"`
+    // Nodes with this label are never deleted.
+    ProtectedLabel string `json:"protected_label,omitempty"`
+}
+
+// NodePriceArgs prices nodes that have all labels of the selector.
+type NodePriceArgs struct {
+    Selector map[string]string `json:"selector"`
+    // Price of an on-demand node per hour, e.g. "0.192".
+    HourlyCost string `json:"hourly_cost"`
+    // Price of a spot node per hour. Defaults to the on-demand price.
+    SpotHourlyCost string `json:"spot_hourly_cost,omitempty"`
+}
+
+// CostModelArgs prices nodes that do not belong to a node pool.
+type CostModelArgs struct {
+    // The first matching price is used.
+    Prices []NodePriceArgs `json:"prices,omitempty"`
+    // Labels of spot nodes, e.g. "node.kubernetes.io/lifecycle": "spot".
+    SpotSelector map[string]string `json:"spot_selector,omitempty"`
+    // Price of nodes without a matching price.
+    DefaultHourlyCost string `json:"default_hourly_cost,omitempty"`
+}
+
+// ScopeArgs selects the namespaces and pods the planner works with.
+// Namespaces are those of the namespaces list and those matching the
+// namespace selector, or all namespaces if both are empty. Excluded
+// namespaces are removed from them.
+type ScopeArgs struct {
+    NamespaceSelector  *metav1.LabelSelector `json:"namespace_selector,omitempty"`
+    ExcludedNamespaces []string              `json:"excluded_namespaces,omitempty"`
+    // Only pods matching the selector are planned.
+    PodSelector *metav1.LabelSelector `json:"pod_selector,omitempty"`
+    // Only nodes matching the selector and not excluded are planned, e.g.
+    // to keep control-plane and special-purpose pools out. Pods on other
+    // nodes are not touched. New nodes are requested with the match labels.
+    NodeSelector  *metav1.LabelSelector `json:"node_selector,omitempty"`
+    ExcludedNodes []string              `json:"excluded_nodes,omitempty"`
+}
+
+// ClusterArgs connects the planner to another cluster. Every cluster is
+// planned separately with the same spec.
+type ClusterArgs struct {
+    // Name of the cluster in status and metrics.
+    Name string `json:"name"`
+    // Path to a kubeconfig file, e.g. mounted from a Secret. Default loading
+    // rules are used if empty.
+    Kubeconfig string `json:"kubeconfig,omitempty"`
+    // Context of the kubeconfig. The current context is used if empty.
+    Context string `json:"context,omitempty"`
+    // Namespace of the cluster where the execution journal and node changes
+    // are stored. Defaults to "default".
+    JournalNamespace string `json:"journal_namespace,omitempty"`
+    // Metrics source of the cluster. Defaults to the one of the spec.
+    MetricsSource *MetricsSourceArgs `json:"metrics_source,omitempty"`
+}
+
 // PlannerSpec defines the desired state of Planner
 type PlannerSpec struct {
-    Namespaces []string `json:"namespaces,omitempty"`
+    Namespaces []string   `json:"namespaces,omitempty"`
+    Scope      *ScopeArgs `json:"scope,omitempty"`
     // +kubebuilder:validation:Minimum=1
     PlanningInterval int `json:"planning_interval,omitempty"`
     // +kubebuilder:validation:Minimum=1
     MeticsFetchPeriod int `json:"metrics_fetch_period,omitempty"`
     // +kubebuilder:validation:Minimum=1
-    MetrcisMaxAge          int                `json:"metrics_max_age,omitempty"`
-    ResourceUpdateStrategy string             `json:"resource_update_strategy,omitempty"`
-    NodePolicy             string             `json:"node_policy,omitempty"`
-    MaxNodes               int                `json:"max_nodes,omitempty"`
-    Algorithm              *AlgorithmArgs     `json:"algorithm,omitempty"`
-    Constraints            ConstraintArgsList `json:"constraints,omitempty"`
-    Preferences            PreferenceArgsList `json:"preferences,omitempty"`
+    MetrcisMaxAge int                `json:"metrics_max_age,omitempty"`
+    // Samples older than metrics_downsample_after seconds are merged into
+    // one per metrics_downsample_step seconds. Default to 900 and 300.
+    // +kubebuilder:validation:Minimum=1
+    MetricsDownsampleAfter int `json:"metrics_downsample_after,omitempty"`
+    // +kubebuilder:validation:Minimum=1
+    MetricsDownsampleStep int       `json:"metrics_downsample_step,omitempty"`
+    MetricsSource *MetricsSourceArgs `json:"metrics_source,omitempty"`
+    // One of none, max, histogram, mean_stddev and pXX, e.g. p95.
+    // +kubebuilder:validation:Pattern=`^(none|max|histogram|mean_stddev|p([1-9][0-9]?|100))$`
+    ResourceUpdateStrategy string              `json:"resource_update_strategy,omitempty"`
+    ResourceUpdate         *ResourceUpdateArgs `json:"resource_update,omitempty"`
+    ResourceApply          *ResourceApplyArgs  `json:"resource_apply,omitempty"`
+    VPA                    *VPAArgs            `json:"vpa,omitempty"`
+    Sizing                 *SizingArgs         `json:"sizing,omitempty"`
+    NodePolicy             string              `json:"node_policy,omitempty"`
+    MaxNodes               int                 `json:"max_nodes,omitempty"`
+    NodePools              []NodePoolArgs      `json:"node_pools,omitempty"`
+    CostModel              *CostModelArgs      `json:"cost_model,omitempty"`
+    ScaleDown              *ScaleDownArgs      `json:"scale_down,omitempty"`
+    RequireApproval        bool                `json:"require_approval,omitempty"`
+    Algorithm              *AlgorithmArgs      `json:"algorithm,omitempty"`
+    Execution              *ExecutionArgs      `json:"execution,omitempty"`
+    Constraints            ConstraintArgsList  `json:"constraints,omitempty"`
+    Preferences            PreferenceArgsList  `json:"preferences,omitempty"`
+    // Clusters planned in addition to the one the planner runs in.
+    Clusters []ClusterArgs `json:"clusters,omitempty"`
+    // Report how many nodes every cluster should get or give away to even
+    // utilization across clusters.
+    BalanceClusters bool `json:"balance_clusters,omitempty"`
 }
 
 type PlannerPhase int
@@ -117,6 +440,7 @@ const (
     ResourcesUpdating              = 2
     Planning                       = 3
     Executing                      = 4
+    WaitingApproval                = 5
 )
 
 // PlannerStatus defines the observed state of Planner
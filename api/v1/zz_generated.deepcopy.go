@@ -22,6 +22,8 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -55,6 +57,63 @@ func (in *BalancedArgs) DeepCopy() *BalancedArgs {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAPIArgs) DeepCopyInto(out *ClusterAPIArgs) {
+	*out = *in
+	if in.Pools != nil {
+		in, out := &in.Pools, &out.Pools
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAPIArgs.
+func (in *ClusterAPIArgs) DeepCopy() *ClusterAPIArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAPIArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterArgs) DeepCopyInto(out *ClusterArgs) {
+	*out = *in
+	if in.MetricsSource != nil {
+		in, out := &in.MetricsSource, &out.MetricsSource
+		*out = new(MetricsSourceArgs)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterArgs.
+func (in *ClusterArgs) DeepCopy() *ClusterArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAutoscalerArgs) DeepCopyInto(out *ClusterAutoscalerArgs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAutoscalerArgs.
+func (in *ClusterAutoscalerArgs) DeepCopy() *ClusterAutoscalerArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAutoscalerArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConstraintArgsList) DeepCopyInto(out *ConstraintArgsList) {
 	*out = *in
@@ -68,6 +127,11 @@ func (in *ConstraintArgsList) DeepCopyInto(out *ConstraintArgsList) {
 		*out = new(PodsCountArgs)
 		**out = **in
 	}
+	if in.Overcommit != nil {
+		in, out := &in.Overcommit, &out.Overcommit
+		*out = new(OvercommitArgs)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConstraintArgsList.
@@ -80,6 +144,65 @@ func (in *ConstraintArgsList) DeepCopy() *ConstraintArgsList {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ContainerBoundsArgs) DeepCopyInto(out *ContainerBoundsArgs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ContainerBoundsArgs.
+func (in *ContainerBoundsArgs) DeepCopy() *ContainerBoundsArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ContainerBoundsArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CostArgs) DeepCopyInto(out *CostArgs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CostArgs.
+func (in *CostArgs) DeepCopy() *CostArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(CostArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CostModelArgs) DeepCopyInto(out *CostModelArgs) {
+	*out = *in
+	if in.Prices != nil {
+		in, out := &in.Prices, &out.Prices
+		*out = make([]NodePriceArgs, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SpotSelector != nil {
+		in, out := &in.SpotSelector, &out.SpotSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CostModelArgs.
+func (in *CostModelArgs) DeepCopy() *CostModelArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(CostModelArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EconomyArgs) DeepCopyInto(out *EconomyArgs) {
 	*out = *in
@@ -95,6 +218,167 @@ func (in *EconomyArgs) DeepCopy() *EconomyArgs {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecArgs) DeepCopyInto(out *ExecArgs) {
+	*out = *in
+	if in.AddArgs != nil {
+		in, out := &in.AddArgs, &out.AddArgs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeleteArgs != nil {
+		in, out := &in.DeleteArgs, &out.DeleteArgs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecArgs.
+func (in *ExecArgs) DeepCopy() *ExecArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExecutionArgs) DeepCopyInto(out *ExecutionArgs) {
+	*out = *in
+	if in.ClusterAPI != nil {
+		in, out := &in.ClusterAPI, &out.ClusterAPI
+		*out = new(ClusterAPIArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClusterAutoscaler != nil {
+		in, out := &in.ClusterAutoscaler, &out.ClusterAutoscaler
+		*out = new(ClusterAutoscalerArgs)
+		**out = **in
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(WebhookArgs)
+		**out = **in
+	}
+	if in.Exec != nil {
+		in, out := &in.Exec, &out.Exec
+		*out = new(ExecArgs)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExecutionArgs.
+func (in *ExecutionArgs) DeepCopy() *ExecutionArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ExecutionArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForecastArgs) DeepCopyInto(out *ForecastArgs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForecastArgs.
+func (in *ForecastArgs) DeepCopy() *ForecastArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ForecastArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetricsSourceArgs) DeepCopyInto(out *MetricsSourceArgs) {
+	*out = *in
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(PrometheusArgs)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetricsSourceArgs.
+func (in *MetricsSourceArgs) DeepCopy() *MetricsSourceArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(MetricsSourceArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodePoolArgs) DeepCopyInto(out *NodePoolArgs) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Taints != nil {
+		in, out := &in.Taints, &out.Taints
+		*out = make([]corev1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodePoolArgs.
+func (in *NodePoolArgs) DeepCopy() *NodePoolArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(NodePoolArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodePriceArgs) DeepCopyInto(out *NodePriceArgs) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodePriceArgs.
+func (in *NodePriceArgs) DeepCopy() *NodePriceArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(NodePriceArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OvercommitArgs) DeepCopyInto(out *OvercommitArgs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OvercommitArgs.
+func (in *OvercommitArgs) DeepCopy() *OvercommitArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(OvercommitArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PerfomanceArgs) DeepCopyInto(out *PerfomanceArgs) {
 	*out = *in
@@ -177,13 +461,72 @@ func (in *PlannerSpec) DeepCopyInto(out *PlannerSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Scope != nil {
+		in, out := &in.Scope, &out.Scope
+		*out = new(ScopeArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MetricsSource != nil {
+		in, out := &in.MetricsSource, &out.MetricsSource
+		*out = new(MetricsSourceArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResourceUpdate != nil {
+		in, out := &in.ResourceUpdate, &out.ResourceUpdate
+		*out = new(ResourceUpdateArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ResourceApply != nil {
+		in, out := &in.ResourceApply, &out.ResourceApply
+		*out = new(ResourceApplyArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.VPA != nil {
+		in, out := &in.VPA, &out.VPA
+		*out = new(VPAArgs)
+		**out = **in
+	}
+	if in.Sizing != nil {
+		in, out := &in.Sizing, &out.Sizing
+		*out = new(SizingArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodePools != nil {
+		in, out := &in.NodePools, &out.NodePools
+		*out = make([]NodePoolArgs, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.CostModel != nil {
+		in, out := &in.CostModel, &out.CostModel
+		*out = new(CostModelArgs)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ScaleDown != nil {
+		in, out := &in.ScaleDown, &out.ScaleDown
+		*out = new(ScaleDownArgs)
+		**out = **in
+	}
 	if in.Algorithm != nil {
 		in, out := &in.Algorithm, &out.Algorithm
 		*out = new(AlgorithmArgs)
 		**out = **in
 	}
+	if in.Execution != nil {
+		in, out := &in.Execution, &out.Execution
+		*out = new(ExecutionArgs)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Constraints.DeepCopyInto(&out.Constraints)
 	in.Preferences.DeepCopyInto(&out.Preferences)
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]ClusterArgs, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannerSpec.
@@ -249,6 +592,11 @@ func (in *PreferenceArgsList) DeepCopyInto(out *PreferenceArgsList) {
 		*out = new(TopologySpreadArgs)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Cost != nil {
+		in, out := &in.Cost, &out.Cost
+		*out = new(CostArgs)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreferenceArgsList.
@@ -261,6 +609,43 @@ func (in *PreferenceArgsList) DeepCopy() *PreferenceArgsList {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrometheusArgs) DeepCopyInto(out *PrometheusArgs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrometheusArgs.
+func (in *PrometheusArgs) DeepCopy() *PrometheusArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(PrometheusArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceApplyArgs) DeepCopyInto(out *ResourceApplyArgs) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceApplyArgs.
+func (in *ResourceApplyArgs) DeepCopy() *ResourceApplyArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceApplyArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceRangeArgs) DeepCopyInto(out *ResourceRangeArgs) {
 	*out = *in
@@ -276,6 +661,101 @@ func (in *ResourceRangeArgs) DeepCopy() *ResourceRangeArgs {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceUpdateArgs) DeepCopyInto(out *ResourceUpdateArgs) {
+	*out = *in
+	if in.Bounds != nil {
+		in, out := &in.Bounds, &out.Bounds
+		*out = make([]ContainerBoundsArgs, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceUpdateArgs.
+func (in *ResourceUpdateArgs) DeepCopy() *ResourceUpdateArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceUpdateArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleDownArgs) DeepCopyInto(out *ScaleDownArgs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleDownArgs.
+func (in *ScaleDownArgs) DeepCopy() *ScaleDownArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleDownArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScopeArgs) DeepCopyInto(out *ScopeArgs) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExcludedNamespaces != nil {
+		in, out := &in.ExcludedNamespaces, &out.ExcludedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PodSelector != nil {
+		in, out := &in.PodSelector, &out.PodSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExcludedNodes != nil {
+		in, out := &in.ExcludedNodes, &out.ExcludedNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScopeArgs.
+func (in *ScopeArgs) DeepCopy() *ScopeArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(ScopeArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SizingArgs) DeepCopyInto(out *SizingArgs) {
+	*out = *in
+	if in.Forecast != nil {
+		in, out := &in.Forecast, &out.Forecast
+		*out = new(ForecastArgs)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SizingArgs.
+func (in *SizingArgs) DeepCopy() *SizingArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(SizingArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TopologyKey) DeepCopyInto(out *TopologyKey) {
 	*out = *in
@@ -310,3 +790,33 @@ func (in *TopologySpreadArgs) DeepCopy() *TopologySpreadArgs {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VPAArgs) DeepCopyInto(out *VPAArgs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VPAArgs.
+func (in *VPAArgs) DeepCopy() *VPAArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(VPAArgs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WebhookArgs) DeepCopyInto(out *WebhookArgs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WebhookArgs.
+func (in *WebhookArgs) DeepCopy() *WebhookArgs {
+	if in == nil {
+		return nil
+	}
+	out := new(WebhookArgs)
+	in.DeepCopyInto(out)
+	return out
+}
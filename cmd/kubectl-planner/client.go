@@ -0,0 +1,94 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "time"
+
+    clientset "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/clientcmd"
+)
+
+const requestTimeout = 2 * time.Minute
+
+// PlannerClient talks to the planner control server through the API server
+// service proxy, so no port-forward is needed.
+type PlannerClient struct {
+    cltset    *clientset.Clientset
+    namespace string
+    service   string
+    // Cluster selects a remote cluster of a multi-cluster planner.
+    Cluster string
+}
+
+func NewPlannerClient(kubeconfig, kubecontext, namespace, service string) (*PlannerClient, error) {
+    rules := clientcmd.NewDefaultClientConfigLoadingRules()
+    if kubeconfig != "" {
+        rules.ExplicitPath = kubeconfig
+    }
+    overrides := &clientcmd.ConfigOverrides{CurrentContext: kubecontext}
+
+    config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+    if err != nil {
+        return nil, err
+    }
+
+    cltset, err := clientset.NewForConfig(config)
+    if err != nil {
+        return nil, err
+    }
+
+    return &PlannerClient{cltset: cltset, namespace: namespace, service: service}, nil
+}
+
+func (c *PlannerClient) Get(path string) ([]byte, error) {
+    return c.do("GET", path, nil)
+}
+
+func (c *PlannerClient) Post(path string, body []byte) ([]byte, error) {
+    return c.do("POST", path, body)
+}
+
+func (c *PlannerClient) GetJson(path string, v interface{}) error {
+    b, err := c.Get(path)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(b, v)
+}
+
+func (c *PlannerClient) do(verb, path string, body []byte) ([]byte, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+    defer cancel()
+
+    req := c.cltset.CoreV1().RESTClient().Verb(verb).
+        Namespace(c.namespace).
+        Resource("services").
+        Name(c.service).
+        SubResource("proxy").
+        Suffix(path)
+    if c.Cluster != "" {
+        req = req.Param("cluster", c.Cluster)
+    }
+    if body != nil {
+        req = req.SetHeader("Content-Type", "application/json").Body(body)
+    }
+
+    return req.DoRaw(ctx)
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-planner is a kubectl plugin for the planner control server.
+// Put the binary on PATH and call it as "kubectl planner <command>".
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "strings"
+    "text/tabwriter"
+
+    messages "github.com/miha3009/planner/controllers/messages"
+    "sigs.k8s.io/yaml"
+)
+
+const usage = `Usage: kubectl planner [flags] <command>
+
+Commands:
+  status                 Show planner phase and the current plan summary
+  plan                   Show the current plan
+  explain                Show how the current plan changes node utilization
+  approve                Approve a plan waiting for approval
+  abort                  Discard a plan waiting for approval or stop its execution
+  start                  Start the planner
+  stop                   Stop the planner
+  history                Show recent plans
+  simulate -f FILE       Generate a plan for a cluster snapshot (yaml or json)
+
+Flags:
+`
+
+func main() {
+    flags := flag.NewFlagSet("kubectl-planner", flag.ExitOnError)
+    kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig file")
+    kubecontext := flags.String("context", "", "The kubeconfig context to use")
+    namespace := flags.String("n", "planner-system", "Namespace of the planner service")
+    service := flags.String("service", "planner-service", "Name of the planner service")
+    port := flags.String("port", "9999", "Port of the planner service")
+    cluster := flags.String("cluster", "", "Cluster of a multi-cluster planner, the local one by default")
+    flags.Usage = func() {
+        fmt.Fprint(os.Stderr, usage)
+        flags.PrintDefaults()
+    }
+    flags.Parse(os.Args[1:])
+
+    if flags.NArg() == 0 {
+        flags.Usage()
+        os.Exit(2)
+    }
+
+    clt, err := NewPlannerClient(*kubeconfig, *kubecontext, *namespace, *service+":"+*port)
+    if err != nil {
+        fail(err)
+    }
+    clt.Cluster = *cluster
+
+    command, args := flags.Arg(0), flags.Args()[1:]
+    switch command {
+    case "status":
+        err = status(clt)
+    case "plan":
+        err = plan(clt)
+    case "explain":
+        err = explain(clt)
+    case "approve", "abort", "start", "stop":
+        err = post(clt, "/"+command)
+    case "history":
+        err = history(clt)
+    case "simulate":
+        err = simulate(clt, args)
+    default:
+        fmt.Fprintf(os.Stderr, "Unknown command \"%s\"\n\n", command)
+        flags.Usage()
+        os.Exit(2)
+    }
+
+    if err != nil {
+        fail(err)
+    }
+}
+
+func fail(err error) {
+    fmt.Fprintln(os.Stderr, "Error:", err)
+    os.Exit(1)
+}
+
+func post(clt *PlannerClient, path string) error {
+    b, err := clt.Post(path, nil)
+    if err != nil {
+        return err
+    }
+    fmt.Print(string(b))
+    return nil
+}
+
+func status(clt *PlannerClient) error {
+    st := messages.StatusMessage{}
+    if err := clt.GetJson("/status", &st); err != nil {
+        return err
+    }
+
+    fmt.Printf("Active:     %t\n", st.Active)
+    fmt.Printf("Phase:      %s\n", st.Phase)
+    if !st.LastStart.IsZero() {
+        fmt.Printf("Last start: %s\n", st.LastStart.Format("2006-01-02 15:04:05"))
+    }
+    if st.HasPlan {
+        fmt.Printf("Plan:       %s\n", summary(st.Plan))
+    } else {
+        fmt.Println("Plan:       none")
+    }
+
+    if len(st.Clusters) == 0 {
+        return nil
+    }
+    fmt.Println()
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "CLUSTER\tPHASE\tNODES\tCPU %\tMEMORY %\tNODE SHIFT\tPLAN")
+    for _, c := range st.Clusters {
+        plan := "none"
+        if c.HasPlan {
+            plan = summary(c.Plan)
+        }
+        fmt.Fprintf(w, "%s\t%s\t%d\t%.1f\t%.1f\t%+d\t%s\n", c.Name, c.Phase, c.Nodes,
+            c.CpuUtilization, c.MemoryUtilization, c.NodeShift, plan)
+    }
+    return w.Flush()
+}
+
+func plan(clt *PlannerClient) error {
+    b, err := clt.Get("/plan")
+    if err != nil {
+        return err
+    }
+    if len(b) == 0 {
+        fmt.Println("Plan not found.")
+        return nil
+    }
+
+    myPlan := messages.PlanMessage{}
+    if err := json.Unmarshal(b, &myPlan); err != nil {
+        return err
+    }
+    printPlan(myPlan)
+    return nil
+}
+
+func explain(clt *PlannerClient) error {
+    ex := messages.ExplainMessage{}
+    if err := clt.GetJson("/explain", &ex); err != nil {
+        return err
+    }
+
+    printPlan(ex.Plan)
+    fmt.Println()
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "NODE\tPODS\tCPU %\tMEMORY %")
+    for _, node := range ex.Nodes {
+        fmt.Fprintf(w, "%s\t%d -> %d\t%.1f -> %.1f\t%.1f -> %.1f\n", node.Node,
+            node.PodsBefore, node.PodsAfter,
+            node.CpuBefore, node.CpuAfter,
+            node.MemoryBefore, node.MemoryAfter)
+    }
+    return w.Flush()
+}
+
+func history(clt *PlannerClient) error {
+    records := make([]messages.HistoryMessage, 0)
+    if err := clt.GetJson("/history", &records); err != nil {
+        return err
+    }
+
+    if len(records) == 0 {
+        fmt.Println("History is empty.")
+        return nil
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "CREATED\tSTATUS\tPLAN")
+    for i := len(records) - 1; i >= 0; i-- {
+        fmt.Fprintf(w, "%s\t%s\t%s\n", records[i].CreatedAt.Format("2006-01-02 15:04:05"),
+            records[i].Status, summary(records[i].Plan))
+    }
+    return w.Flush()
+}
+
+func simulate(clt *PlannerClient, args []string) error {
+    flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+    file := flags.String("f", "", "Snapshot file with spec, nodes and pods")
+    flags.Parse(args)
+    if *file == "" {
+        return fmt.Errorf("snapshot file is not specified, use -f")
+    }
+
+    raw, err := ioutil.ReadFile(*file)
+    if err != nil {
+        return err
+    }
+
+    snapshot := messages.Snapshot{}
+    if err := yaml.Unmarshal(raw, &snapshot); err != nil {
+        return err
+    }
+
+    body, err := json.Marshal(snapshot)
+    if err != nil {
+        return err
+    }
+
+    b, err := clt.Post("/simulate", body)
+    if err != nil {
+        return err
+    }
+
+    myPlan := messages.PlanMessage{}
+    if err := json.Unmarshal(b, &myPlan); err != nil {
+        return err
+    }
+    printPlan(myPlan)
+    return nil
+}
+
+func summary(myPlan messages.PlanMessage) string {
+    parts := make([]string, 0)
+    if myPlan.NodesChange > 0 {
+        parts = append(parts, fmt.Sprintf("%d nodes to create", myPlan.NodesChange))
+    } else if myPlan.NodesChange < 0 {
+        parts = append(parts, fmt.Sprintf("%d nodes to delete", -myPlan.NodesChange))
+    }
+    parts = append(parts, fmt.Sprintf("%d moves", len(myPlan.Moves)))
+    if myPlan.MonthlySavings != 0 {
+        parts = append(parts, fmt.Sprintf("%.2f saved per month", myPlan.MonthlySavings))
+    }
+    return strings.Join(parts, ", ")
+}
+
+func printPlan(myPlan messages.PlanMessage) {
+    if myPlan.NodesChange == 0 && len(myPlan.Moves) == 0 {
+        fmt.Println("Nothing will change.")
+        return
+    }
+
+    if myPlan.NodesChange > 0 {
+        fmt.Printf("%d nodes will be created.\n", myPlan.NodesChange)
+    } else if myPlan.NodesChange < 0 {
+        fmt.Printf("%d nodes will be deleted.\n", -myPlan.NodesChange)
+    }
+    if myPlan.MonthlySavings != 0 {
+        fmt.Printf("Estimated monthly savings: %.2f\n", myPlan.MonthlySavings)
+    }
+
+    if len(myPlan.Moves) == 0 {
+        fmt.Println("Pods will not move.")
+        return
+    }
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "POD\tFROM\tTO")
+    for _, move := range myPlan.Moves {
+        fmt.Fprintf(w, "%s\t%s\t%s\n", move.Pod, move.OldNode, move.NewNode)
+    }
+    w.Flush()
+
+    if len(myPlan.Results) > 0 {
+        fmt.Println()
+        printResults(myPlan.Results)
+    }
+}
+
+func printResults(results []messages.MoveResultMessage) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "POD\tNEW POD\tNODE\tRESULT")
+    for _, result := range results {
+        status := "ok"
+        if !result.Ok {
+            status = "failed: " + result.Error
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Pod, result.NewPod, result.NewNode, status)
+    }
+    w.Flush()
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    clientset "k8s.io/client-go/kubernetes"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// blockingExecutor executes plans until it is cancelled.
+type blockingExecutor struct {
+    started chan struct{}
+}
+
+func (exe *blockingExecutor) ExecutePlan(ctx context.Context, events chan types.Event, cache *types.PlannerCache, clt client.Client, cltset *clientset.Clientset, planner appsv1.PlannerSpec) {
+    exe.started <- struct{}{}
+    <-ctx.Done()
+    events <- types.ExecutingEnded
+}
+
+func approvalReconciler() (*PlannerReconciler, *blockingExecutor) {
+    exe := &blockingExecutor{started: make(chan struct{}, 1)}
+    ctx, cancel := context.WithCancel(context.Background())
+    return &PlannerReconciler{
+        Events:      make(chan types.Event, 10),
+        Cache:       types.NewCache(),
+        MainProcess: &Process{Context: ctx, CancelFunc: cancel},
+        Executor:    exe,
+    }, exe
+}
+
+func TestApproveOnlyWaitingPlan(t *testing.T) {
+    r, exe := approvalReconciler()
+    defer r.MainProcess.CancelFunc()
+    planner := &appsv1.Planner{Spec: appsv1.PlannerSpec{RequireApproval: true}}
+    r.UpdatePhase(planner, appsv1.Waiting)
+
+    if r.ProcessEvent(context.Background(), planner, types.PlanApproved) || r.ExecutionProcess != nil {
+        t.Fatal("expected approve to be ignored without a plan waiting for approval")
+    }
+
+    r.Cache.Plan = &types.Plan{}
+    r.ProcessEvent(context.Background(), planner, types.PlanningEnded)
+    if planner.Status.Phase != appsv1.WaitingApproval || r.ExecutionProcess != nil {
+        t.Fatalf("expected plan to wait for approval, got phase %v", planner.Status.Phase)
+    }
+    if r.Cache.LastPlanStatus() != types.PlanStatusPendingApproval {
+        t.Errorf("expected pending plan in history, got %s", r.Cache.LastPlanStatus())
+    }
+
+    if !r.ProcessEvent(context.Background(), planner, types.PlanApproved) {
+        t.Fatal("expected approve to start execution")
+    }
+    if planner.Status.Phase != appsv1.Executing || r.Cache.LastPlanStatus() != types.PlanStatusExecuting {
+        t.Errorf("expected plan to be executing, got phase %v", planner.Status.Phase)
+    }
+    <-exe.started
+
+    // A second approve must not start another execution.
+    if r.ProcessEvent(context.Background(), planner, types.PlanApproved) {
+        t.Error("expected approve to be ignored during execution")
+    }
+    select {
+    case <-exe.started:
+        t.Error("expected a single execution")
+    case <-time.After(10 * time.Millisecond):
+    }
+}
+
+func TestAbortWaitingPlan(t *testing.T) {
+    r, _ := approvalReconciler()
+    defer r.MainProcess.CancelFunc()
+    planner := &appsv1.Planner{Spec: appsv1.PlannerSpec{RequireApproval: true}}
+    r.Cache.Plan = &types.Plan{}
+    r.ProcessEvent(context.Background(), planner, types.PlanningEnded)
+
+    if !r.ProcessEvent(context.Background(), planner, types.PlanAborted) {
+        t.Fatal("expected abort to drop the plan")
+    }
+    if planner.Status.Phase != appsv1.Waiting || r.Cache.LastPlanStatus() != types.PlanStatusAborted {
+        t.Errorf("expected aborted plan, got phase %v and status %s", planner.Status.Phase, r.Cache.LastPlanStatus())
+    }
+    if r.ProcessEvent(context.Background(), planner, types.PlanApproved) || r.ExecutionProcess != nil {
+        t.Error("expected aborted plan not to be approved")
+    }
+}
+
+func TestAbortStopsExecution(t *testing.T) {
+    r, exe := approvalReconciler()
+    defer r.MainProcess.CancelFunc()
+    planner := &appsv1.Planner{}
+    r.Cache.Plan = &types.Plan{}
+    r.ProcessEvent(context.Background(), planner, types.PlanningEnded)
+    <-exe.started
+
+    r.ProcessEvent(context.Background(), planner, types.PlanAborted)
+    select {
+    case e := <-r.Events:
+        if e != types.ExecutingEnded {
+            t.Fatalf("expected execution to end, got event %v", e)
+        }
+        r.ProcessEvent(context.Background(), planner, e)
+    case <-time.After(time.Second):
+        t.Fatal("expected abort to cancel execution")
+    }
+
+    if planner.Status.Phase != appsv1.Waiting || r.ExecutionProcess != nil {
+        t.Errorf("expected planner to wait after abort, got phase %v", planner.Status.Phase)
+    }
+    if r.Cache.LastPlanStatus() != types.PlanStatusAborted {
+        t.Errorf("expected aborted plan not to be marked executed, got %s", r.Cache.LastPlanStatus())
+    }
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+    appsv1 "github.com/miha3009/planner/api/v1"
+    multicluster "github.com/miha3009/planner/controllers/multicluster"
+)
+
+// syncClusters connects the clusters of the spec, keeps their metrics
+// listeners running and reports their capacity.
+func (r *PlannerReconciler) syncClusters(planner *appsv1.Planner) {
+    if r.Clusters == nil {
+        return
+    }
+    r.Clusters.Sync(planner.Spec.Clusters, r.Scheme)
+    r.Clusters.SetBalance(planner.Spec.BalanceClusters)
+    if len(planner.Spec.Clusters) == 0 {
+        return
+    }
+
+    for _, c := range r.Clusters.List() {
+        c.StartMetrics(r.MetricsProcess.Context, planner.Spec)
+    }
+    capacities := r.Clusters.Capacities()
+    multicluster.Report(capacities, r.Clusters.Shifts(capacities))
+}
+
+// startClusterCycles plans remote clusters along with the local one.
+func (r *PlannerReconciler) startClusterCycles(planner *appsv1.Planner) {
+    if r.Clusters == nil {
+        return
+    }
+    for _, c := range r.Clusters.List() {
+        c.StartCycle(r.MainProcess.Context, planner.Spec)
+    }
+}
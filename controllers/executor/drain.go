@@ -0,0 +1,255 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    policyv1beta1 "k8s.io/api/policy/v1beta1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/fields"
+    k8stypes "k8s.io/apimachinery/pkg/types"
+    "k8s.io/apimachinery/pkg/util/wait"
+    clientset "k8s.io/client-go/kubernetes"
+)
+
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// evictionRetryInterval is how often an eviction blocked by a
+// PodDisruptionBudget is retried.
+var evictionRetryInterval = time.Second * 5
+
+// drainer empties nodes before they are deleted. Pods are removed through
+// the eviction API, so PodDisruptionBudgets and termination grace periods
+// are respected. Pods without a controller are copied to another node
+// first, because nothing would recreate them.
+type drainer struct {
+    cltset  clientset.Interface
+    timeout time.Duration
+}
+
+// Drain cordons the node and evicts its pods. The node is uncordoned if the
+// drain fails.
+func (d *drainer) Drain(ctx context.Context, node *corev1.Node) error {
+    if err := setUnschedulable(ctx, d.cltset, node, true); err != nil {
+        return err
+    }
+
+    if err := d.evictPods(ctx, node); err != nil {
+        d.Uncordon(node)
+        return fmt.Errorf("failed to drain node %s: %v", node.Name, err)
+    }
+    return nil
+}
+
+// Uncordon makes the node schedulable again even if the context of the
+// execution is cancelled.
+func (d *drainer) Uncordon(node *corev1.Node) {
+    ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+    defer cancel()
+
+    if err := setUnschedulable(ctx, d.cltset, node, false); err != nil {
+        log.Info(err)
+    }
+}
+
+// evictPods copies pods without a controller, evicts all pods and waits
+// until they are gone. If it fails, copies of pods that still exist are
+// deleted and the others are kept as replacements.
+func (d *drainer) evictPods(ctx context.Context, node *corev1.Node) (err error) {
+    fieldSelector := fields.OneTermEqualSelector("spec.nodeName", node.Name).String()
+    list, err := d.cltset.CoreV1().Pods("").List(ctx, metav1.ListOptions{FieldSelector: fieldSelector})
+    if err != nil {
+        return err
+    }
+
+    pods := make([]*corev1.Pod, 0, len(list.Items))
+    for i := range list.Items {
+        if list.Items[i].Spec.NodeName == node.Name && needsDrain(&list.Items[i]) {
+            pods = append(pods, &list.Items[i])
+        }
+    }
+
+    // Pods get their termination grace period on top of the drain timeout.
+    timeout := d.timeout + maxGracePeriod(pods)
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    copies := make(map[*corev1.Pod]*corev1.Pod)
+    defer func() {
+        if err != nil {
+            d.cleanupCopies(copies)
+        }
+    }()
+    for _, pod := range pods {
+        if metav1.GetControllerOf(pod) != nil {
+            continue
+        }
+        newPod, err := d.copyPod(ctx, pod)
+        if err != nil {
+            return err
+        }
+        copies[pod] = newPod
+    }
+
+    for _, pod := range pods {
+        if err := d.evictPod(ctx, pod); err != nil {
+            return err
+        }
+    }
+
+    for _, pod := range pods {
+        if err := waitForPodDeleted(ctx, d.cltset, pod, timeout); err != nil {
+            return err
+        }
+        if newPod, ok := copies[pod]; ok {
+            if err := setPodLabels(ctx, d.cltset, newPod, pod.Labels); err != nil {
+                log.Info(err)
+            }
+            delete(copies, pod)
+        }
+    }
+    return nil
+}
+
+// cleanupCopies deletes copies of pods that are still on the node. A pod
+// that is gone or terminating keeps its copy, which gets the labels of the
+// pod.
+func (d *drainer) cleanupCopies(copies map[*corev1.Pod]*corev1.Pod) {
+    ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+    defer cancel()
+
+    for pod, newPod := range copies {
+        current, err := d.cltset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+        if err != nil && !errors.IsNotFound(err) {
+            log.Info(err)
+            continue
+        }
+        if err == nil && current.UID == pod.UID && current.DeletionTimestamp == nil {
+            if err := deletePod(ctx, d.cltset, newPod); err != nil {
+                log.Info(err)
+            }
+            continue
+        }
+        if err := setPodLabels(ctx, d.cltset, newPod, pod.Labels); err != nil {
+            log.Info(err)
+        }
+    }
+}
+
+// evictPod asks the API server to evict the pod and retries while a
+// PodDisruptionBudget does not allow it.
+func (d *drainer) evictPod(ctx context.Context, pod *corev1.Pod) error {
+    eviction := &policyv1beta1.Eviction{
+        ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+        DeleteOptions: &metav1.DeleteOptions{
+            GracePeriodSeconds: pod.Spec.TerminationGracePeriodSeconds,
+            Preconditions:      metav1.NewUIDPreconditions(string(pod.UID)),
+        },
+    }
+
+    var lastErr error
+    err := wait.PollImmediateUntil(evictionRetryInterval, func() (bool, error) {
+        err := d.cltset.PolicyV1beta1().Evictions(pod.Namespace).Evict(ctx, eviction)
+        switch {
+        case err == nil || errors.IsNotFound(err):
+            return true, nil
+        case errors.IsTooManyRequests(err):
+            lastErr = err
+            return false, nil
+        default:
+            return false, err
+        }
+    }, ctx.Done())
+    if err == wait.ErrWaitTimeout && lastErr != nil {
+        return fmt.Errorf("pod %s can not be evicted: %v", pod.Name, lastErr)
+    }
+    return err
+}
+
+// copyPod creates a copy of a pod without a controller and waits until the
+// scheduler starts it on another node.
+func (d *drainer) copyPod(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+    newPod := &corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{
+            Namespace:   pod.Namespace,
+            Name:        NewNameForPod(pod),
+            Annotations: pod.Annotations,
+        },
+        Spec: *pod.Spec.DeepCopy(),
+    }
+    newPod.Spec.NodeName = ""
+
+    if _, err := d.cltset.CoreV1().Pods(newPod.Namespace).Create(ctx, newPod, metav1.CreateOptions{}); err != nil {
+        return nil, err
+    }
+    if err := waitForPodReady(ctx, d.cltset, newPod, d.timeout); err != nil {
+        cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+        if err := deletePod(cleanupCtx, d.cltset, newPod); err != nil {
+            log.Info(err)
+        }
+        cancel()
+        return nil, err
+    }
+    return newPod, nil
+}
+
+func maxGracePeriod(pods []*corev1.Pod) time.Duration {
+    grace := int64(0)
+    for _, pod := range pods {
+        if pod.Spec.TerminationGracePeriodSeconds != nil && *pod.Spec.TerminationGracePeriodSeconds > grace {
+            grace = *pod.Spec.TerminationGracePeriodSeconds
+        }
+    }
+    return time.Duration(grace) * time.Second
+}
+
+func setUnschedulable(ctx context.Context, cltset clientset.Interface, node *corev1.Node, unschedulable bool) error {
+    patch, err := json.Marshal(map[string]interface{}{
+        "spec": map[string]interface{}{"unschedulable": unschedulable},
+    })
+    if err != nil {
+        return err
+    }
+
+    _, err = cltset.CoreV1().Nodes().Patch(ctx, node.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+    return err
+}
+
+// needsDrain is false for pods that can not run elsewhere: DaemonSet pods
+// are recreated on the node anyway and mirror pods belong to the kubelet.
+// Finished pods do not block the deletion.
+func needsDrain(pod *corev1.Pod) bool {
+    if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+        return false
+    }
+    if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+        return false
+    }
+    for _, owner := range pod.OwnerReferences {
+        if owner.Kind == "DaemonSet" {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+)
+
+// evictAfter makes evictions fail as if a PodDisruptionBudget forbids them
+// until the given number of attempts is made. Negative means never.
+func evictAfter(cltset *fake.Clientset, attempts int) *int {
+    calls := 0
+    cltset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        if action.GetSubresource() != "eviction" {
+            return false, nil, nil
+        }
+        calls++
+        if attempts < 0 || calls <= attempts {
+            return true, nil, errors.NewTooManyRequests("disruption budget", 1)
+        }
+        eviction := action.(k8stesting.CreateAction).GetObject().(metav1.Object)
+        gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+        return true, nil, cltset.Tracker().Delete(gvr, eviction.GetNamespace(), eviction.GetName())
+    })
+    return &calls
+}
+
+func managedPod(name string, node string) *corev1.Pod {
+    controller := true
+    grace := int64(1)
+    return &corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{
+            Namespace:       "default",
+            Name:            name,
+            OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "rs", Controller: &controller}},
+        },
+        Spec: corev1.PodSpec{NodeName: node, TerminationGracePeriodSeconds: &grace},
+    }
+}
+
+func TestDrainRetriesEvictionBlockedByBudget(t *testing.T) {
+    evictionRetryInterval = time.Millisecond
+    node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}}
+    mirror := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+        Namespace: "kube-system", Name: "etcd-a",
+        Annotations: map[string]string{mirrorPodAnnotation: "hash"},
+    }, Spec: corev1.PodSpec{NodeName: "a"}}
+    cltset := fake.NewSimpleClientset(node, managedPod("p", "a"), mirror)
+    calls := evictAfter(cltset, 2)
+
+    d := &drainer{cltset: cltset, timeout: time.Second}
+    if err := d.Drain(context.Background(), node); err != nil {
+        t.Fatal(err)
+    }
+    if *calls != 3 {
+        t.Errorf("expected eviction to be retried, got %d calls", *calls)
+    }
+
+    updated, _ := cltset.CoreV1().Nodes().Get(context.Background(), "a", metav1.GetOptions{})
+    if !updated.Spec.Unschedulable {
+        t.Errorf("expected drained node to stay cordoned")
+    }
+    if _, err := cltset.CoreV1().Pods("kube-system").Get(context.Background(), "etcd-a", metav1.GetOptions{}); err != nil {
+        t.Errorf("expected mirror pod to be kept: %v", err)
+    }
+}
+
+func TestDrainUncordonsOnTimeout(t *testing.T) {
+    evictionRetryInterval = time.Millisecond
+    node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}}
+    cltset := fake.NewSimpleClientset(node, managedPod("p", "a"))
+    evictAfter(cltset, -1)
+
+    d := &drainer{cltset: cltset, timeout: time.Millisecond * 100}
+    if err := d.Drain(context.Background(), node); err == nil {
+        t.Fatalf("expected drain to fail")
+    }
+
+    updated, _ := cltset.CoreV1().Nodes().Get(context.Background(), "a", metav1.GetOptions{})
+    if updated.Spec.Unschedulable {
+        t.Errorf("expected node to be uncordoned")
+    }
+    if _, err := cltset.CoreV1().Pods("default").Get(context.Background(), "p", metav1.GetOptions{}); err != nil {
+        t.Errorf("expected pod to be kept: %v", err)
+    }
+}
+
+// readyOnCreate makes created pods Ready, as if the scheduler started them.
+func readyOnCreate(cltset *fake.Clientset) {
+    cltset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        if pod, ok := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod); ok && action.GetSubresource() == "" {
+            pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+        }
+        return false, nil, nil
+    })
+}
+
+func TestDrainCleansUpCopiesOnFailure(t *testing.T) {
+    evictionRetryInterval = time.Millisecond
+    for _, evictable := range []string{"", "bare"} {
+        node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}}
+        bare := &corev1.Pod{
+            ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bare", Labels: map[string]string{"app": "bare"}},
+            Spec:       corev1.PodSpec{NodeName: "a"},
+        }
+        cltset := fake.NewSimpleClientset(node, bare, managedPod("p", "a"))
+        readyOnCreate(cltset)
+        // Only the evictable pod is removed, the eviction of p never succeeds.
+        cltset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+            if action.GetSubresource() != "eviction" {
+                return false, nil, nil
+            }
+            eviction := action.(k8stesting.CreateAction).GetObject().(metav1.Object)
+            if eviction.GetName() != evictable {
+                return true, nil, errors.NewTooManyRequests("disruption budget", 1)
+            }
+            gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+            return true, nil, cltset.Tracker().Delete(gvr, eviction.GetNamespace(), eviction.GetName())
+        })
+
+        d := &drainer{cltset: cltset, timeout: time.Millisecond * 100}
+        if err := d.Drain(context.Background(), node); err == nil {
+            t.Fatalf("expected drain to fail")
+        }
+
+        pods, _ := cltset.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+        copies := 0
+        for _, pod := range pods.Items {
+            if pod.Name == "bare" || pod.Name == "p" {
+                continue
+            }
+            copies++
+            if pod.Labels["app"] != "bare" {
+                t.Errorf("expected the kept copy to get labels of the pod, got %v", pod.Labels)
+            }
+        }
+        if evictable == "" && copies != 0 {
+            t.Errorf("expected the copy of a pod that is not evicted to be deleted, got %d copies", copies)
+        }
+        if evictable == "bare" && copies != 1 {
+            t.Errorf("expected the copy of an evicted pod to be kept, got %d copies", copies)
+        }
+    }
+}
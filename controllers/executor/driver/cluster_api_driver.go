@@ -0,0 +1,183 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+    clusterAPIGroup         = "cluster.x-k8s.io"
+    clusterAPIVersion       = "v1beta1"
+    deleteMachineAnnotation = "cluster.x-k8s.io/delete-machine"
+    deploymentNameLabel     = "cluster.x-k8s.io/deployment-name"
+    setNameLabel            = "cluster.x-k8s.io/set-name"
+    clusterAPITimeout       = time.Second * 30
+)
+
+// ClusterAPIDriver scales replicas of a Cluster API MachineDeployment or
+// MachineSet. Nodes of a pool listed in Pools are added to the set of the
+// pool, other nodes to the set named Name. Specific nodes are removed by
+// marking their machines with the delete-machine annotation before the
+// replicas are decreased, so that the MachineSet controller deletes them
+// first.
+type ClusterAPIDriver struct {
+    Client    client.Client
+    Namespace string
+    // Kind is MachineDeployment or MachineSet.
+    Kind string
+    Name string
+    // Pools maps pool names to names of sets of the same kind.
+    Pools map[string]string
+}
+
+func NewClusterAPIDriver(clt client.Client, namespace string, machineDeployment string, machineSet string, pools map[string]string) *ClusterAPIDriver {
+    if machineDeployment != "" {
+        return &ClusterAPIDriver{Client: clt, Namespace: namespace, Kind: "MachineDeployment", Name: machineDeployment, Pools: pools}
+    }
+    return &ClusterAPIDriver{Client: clt, Namespace: namespace, Kind: "MachineSet", Name: machineSet, Pools: pools}
+}
+
+func (d *ClusterAPIDriver) AddNode(node *corev1.Node) bool {
+    ctx, cancel := context.WithTimeout(context.Background(), clusterAPITimeout)
+    defer cancel()
+
+    name := d.Name
+    if pool, ok := d.Pools[node.Annotations[types.PoolAnnotation]]; ok {
+        name = pool
+    }
+    if err := d.scale(ctx, name, 1); err != nil {
+        log.Info(err)
+        return false
+    }
+    return true
+}
+
+func (d *ClusterAPIDriver) DeleteNode(node *corev1.Node) bool {
+    ctx, cancel := context.WithTimeout(context.Background(), clusterAPITimeout)
+    defer cancel()
+
+    machine, err := d.MachineForNode(ctx, node.Name)
+    if err != nil {
+        log.Info(err)
+        return false
+    }
+
+    annotations := machine.GetAnnotations()
+    if annotations == nil {
+        annotations = make(map[string]string)
+    }
+    annotations[deleteMachineAnnotation] = "yes"
+    machine.SetAnnotations(annotations)
+    if err := d.Client.Update(ctx, machine); err != nil {
+        log.Info(err)
+        return false
+    }
+
+    if err := d.scale(ctx, machine.GetLabels()[d.label()], -1); err != nil {
+        log.Info(err)
+        return false
+    }
+    return true
+}
+
+// MachineForNode returns the machine of the scaled sets that backs the node.
+func (d *ClusterAPIDriver) MachineForNode(ctx context.Context, nodeName string) (*unstructured.Unstructured, error) {
+    for _, name := range d.names() {
+        machines := &unstructured.UnstructuredList{}
+        machines.SetGroupVersionKind(d.gvk("MachineList"))
+        err := d.Client.List(ctx, machines, client.InNamespace(d.Namespace), client.MatchingLabels{d.label(): name})
+        if err != nil {
+            return nil, err
+        }
+
+        for i := range machines.Items {
+            node, _, _ := unstructured.NestedString(machines.Items[i].Object, "status", "nodeRef", "name")
+            if node == nodeName {
+                return &machines.Items[i], nil
+            }
+        }
+    }
+    return nil, fmt.Errorf("node %s does not belong to %s %s", nodeName, d.Kind, strings.Join(d.names(), ", "))
+}
+
+// names returns the scaled sets without repeats.
+func (d *ClusterAPIDriver) names() []string {
+    names := []string{}
+    seen := make(map[string]struct{})
+    add := func(name string) {
+        if _, ok := seen[name]; ok || name == "" {
+            return
+        }
+        seen[name] = struct{}{}
+        names = append(names, name)
+    }
+
+    add(d.Name)
+    pools := make([]string, 0, len(d.Pools))
+    for pool := range d.Pools {
+        pools = append(pools, pool)
+    }
+    sort.Strings(pools)
+    for _, pool := range pools {
+        add(d.Pools[pool])
+    }
+    return names
+}
+
+func (d *ClusterAPIDriver) label() string {
+    if d.Kind == "MachineSet" {
+        return setNameLabel
+    }
+    return deploymentNameLabel
+}
+
+func (d *ClusterAPIDriver) scale(ctx context.Context, name string, delta int64) error {
+    owner := &unstructured.Unstructured{}
+    owner.SetGroupVersionKind(d.gvk(d.Kind))
+    if err := d.Client.Get(ctx, client.ObjectKey{Namespace: d.Namespace, Name: name}, owner); err != nil {
+        return err
+    }
+
+    replicas, _, err := unstructured.NestedInt64(owner.Object, "spec", "replicas")
+    if err != nil {
+        return err
+    }
+    if replicas+delta < 0 {
+        return fmt.Errorf("%s %s has no replicas to remove", d.Kind, name)
+    }
+
+    if err := unstructured.SetNestedField(owner.Object, replicas+delta, "spec", "replicas"); err != nil {
+        return err
+    }
+    return d.Client.Update(ctx, owner)
+}
+
+func (d *ClusterAPIDriver) gvk(kind string) schema.GroupVersionKind {
+    return schema.GroupVersionKind{Group: clusterAPIGroup, Version: clusterAPIVersion, Kind: kind}
+}
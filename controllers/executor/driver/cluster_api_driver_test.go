@@ -0,0 +1,126 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+    "context"
+    "testing"
+
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func machineDeployment(name string, replicas int64) *unstructured.Unstructured {
+    md := &unstructured.Unstructured{Object: map[string]interface{}{
+        "spec": map[string]interface{}{"replicas": replicas},
+    }}
+    md.SetAPIVersion(clusterAPIGroup + "/" + clusterAPIVersion)
+    md.SetKind("MachineDeployment")
+    md.SetNamespace("default")
+    md.SetName(name)
+    return md
+}
+
+func machine(name string, deployment string, node string) *unstructured.Unstructured {
+    m := &unstructured.Unstructured{Object: map[string]interface{}{
+        "status": map[string]interface{}{"nodeRef": map[string]interface{}{"name": node}},
+    }}
+    m.SetAPIVersion(clusterAPIGroup + "/" + clusterAPIVersion)
+    m.SetKind("Machine")
+    m.SetNamespace("default")
+    m.SetName(name)
+    m.SetLabels(map[string]string{deploymentNameLabel: deployment})
+    return m
+}
+
+func replicas(t *testing.T, clt client.Client, name string) int64 {
+    md := &unstructured.Unstructured{}
+    md.SetGroupVersionKind(machineDeployment(name, 0).GroupVersionKind())
+    if err := clt.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, md); err != nil {
+        t.Fatal(err)
+    }
+    value, _, _ := unstructured.NestedInt64(md.Object, "spec", "replicas")
+    return value
+}
+
+// clusterAPIScheme registers Cluster API kinds as unstructured objects,
+// so that the fake client can list them.
+func clusterAPIScheme() *runtime.Scheme {
+    scheme := runtime.NewScheme()
+    d := &ClusterAPIDriver{}
+    for _, kind := range []string{"MachineDeployment", "MachineSet", "Machine"} {
+        scheme.AddKnownTypeWithName(d.gvk(kind), &unstructured.Unstructured{})
+        scheme.AddKnownTypeWithName(d.gvk(kind+"List"), &unstructured.UnstructuredList{})
+    }
+    return scheme
+}
+
+func TestClusterAPIDriver(t *testing.T) {
+    clt := fake.NewFakeClientWithScheme(clusterAPIScheme(),
+        machineDeployment("workers", 2),
+        machine("workers-a", "workers", "node-a"),
+        machine("workers-b", "workers", "node-b"),
+        machine("other-c", "other", "node-c"),
+    )
+    d := NewClusterAPIDriver(clt, "default", "workers", "", nil)
+
+    if !d.AddNode(&corev1.Node{}) || replicas(t, clt, "workers") != 3 {
+        t.Fatalf("expected replicas to be increased")
+    }
+
+    if !d.DeleteNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}}) || replicas(t, clt, "workers") != 2 {
+        t.Fatalf("expected replicas to be decreased")
+    }
+    m, err := d.MachineForNode(context.Background(), "node-b")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if m.GetName() != "workers-b" || m.GetAnnotations()[deleteMachineAnnotation] != "yes" {
+        t.Errorf("expected machine workers-b to be marked for deletion")
+    }
+
+    if d.DeleteNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-c"}}) || replicas(t, clt, "workers") != 2 {
+        t.Errorf("expected node of another MachineDeployment to be kept")
+    }
+}
+
+func TestClusterAPIDriverScalesPools(t *testing.T) {
+    clt := fake.NewFakeClientWithScheme(clusterAPIScheme(),
+        machineDeployment("workers", 1),
+        machineDeployment("gpu", 1),
+        machine("gpu-a", "gpu", "node-a"),
+    )
+    d := NewClusterAPIDriver(clt, "default", "workers", "", map[string]string{"gpu": "gpu"})
+
+    planned := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{types.PoolAnnotation: "gpu"}}}
+    if !d.AddNode(planned) || replicas(t, clt, "gpu") != 2 || replicas(t, clt, "workers") != 1 {
+        t.Fatalf("expected only the gpu MachineDeployment to grow")
+    }
+    planned.Annotations[types.PoolAnnotation] = "cpu"
+    if !d.AddNode(planned) || replicas(t, clt, "workers") != 2 {
+        t.Fatalf("expected nodes of unknown pools to be added to workers")
+    }
+
+    if !d.DeleteNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}}) || replicas(t, clt, "gpu") != 1 {
+        t.Errorf("expected the gpu MachineDeployment to shrink")
+    }
+}
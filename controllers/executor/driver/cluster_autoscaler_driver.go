@@ -0,0 +1,125 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+    "context"
+    "time"
+
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientset "k8s.io/client-go/kubernetes"
+)
+
+const (
+    ScaleDownCandidateTaint = "planner.hse.ru/scale-down-candidate"
+    autoscalerTimeout       = time.Second * 30
+)
+
+// ClusterAutoscalerDriver leaves provisioning to cluster-autoscaler. It does
+// not create nodes and marks nodes to delete with a PreferNoSchedule taint,
+// so that no new pods land on them. The taint is not a request to the
+// autoscaler: it deletes a node only when its own scale-down rules find the
+// node unneeded, e.g. below --scale-down-utilization-threshold for
+// --scale-down-unneeded-time. Nodes the plan has emptied usually pass them,
+// but the autoscaler may keep them or delete other nodes.
+type ClusterAutoscalerDriver struct {
+    Clientset clientset.Interface
+}
+
+func (d *ClusterAutoscalerDriver) AddNode(node *corev1.Node) bool {
+    log.Info("Nodes are provisioned by cluster-autoscaler")
+    return false
+}
+
+func (d *ClusterAutoscalerDriver) DeleteNode(node *corev1.Node) bool {
+    return d.MarkNode(node)
+}
+
+func (d *ClusterAutoscalerDriver) MarkNode(node *corev1.Node) bool {
+    ctx, cancel := context.WithTimeout(context.Background(), autoscalerTimeout)
+    defer cancel()
+
+    nodes := d.Clientset.CoreV1().Nodes()
+    current, err := nodes.Get(ctx, node.Name, metav1.GetOptions{})
+    if err != nil {
+        log.Info(err)
+        return false
+    }
+
+    if hasScaleDownTaint(current) {
+        return true
+    }
+
+    now := metav1.Now()
+    current.Spec.Taints = append(current.Spec.Taints, corev1.Taint{
+        Key:       ScaleDownCandidateTaint,
+        Effect:    corev1.TaintEffectPreferNoSchedule,
+        TimeAdded: &now,
+    })
+    if _, err := nodes.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+        log.Info(err)
+        return false
+    }
+    log.Info("Node ", node.Name, " is a scale-down candidate, cluster-autoscaler decides whether to delete it")
+    return true
+}
+
+// UnmarkNode removes the taint from a node that a later plan keeps.
+func (d *ClusterAutoscalerDriver) UnmarkNode(node *corev1.Node) bool {
+    if !hasScaleDownTaint(node) {
+        return true
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), autoscalerTimeout)
+    defer cancel()
+
+    nodes := d.Clientset.CoreV1().Nodes()
+    current, err := nodes.Get(ctx, node.Name, metav1.GetOptions{})
+    if err != nil {
+        log.Info(err)
+        return false
+    }
+
+    taints := make([]corev1.Taint, 0, len(current.Spec.Taints))
+    for _, taint := range current.Spec.Taints {
+        if taint.Key != ScaleDownCandidateTaint {
+            taints = append(taints, taint)
+        }
+    }
+    if len(taints) == len(current.Spec.Taints) {
+        return true
+    }
+
+    current.Spec.Taints = taints
+    if _, err := nodes.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+        log.Info(err)
+        return false
+    }
+    log.Info("Node ", node.Name, " is no longer a scale-down candidate")
+    return true
+}
+
+func hasScaleDownTaint(node *corev1.Node) bool {
+    for _, taint := range node.Spec.Taints {
+        if taint.Key == ScaleDownCandidateTaint {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+    "bytes"
+    "context"
+    "os/exec"
+    "strconv"
+    "strings"
+    "sync"
+    "text/template"
+    "time"
+
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultExecTimeout is enough for a cloud CLI to provision a node.
+const DefaultExecTimeout = time.Minute * 10
+
+// ExecDriver runs a command to add or delete nodes. Arguments are templates
+// filled with execData: {{.Id}} of the operation and the NodeRequest fields
+// such as {{.Pool}} and {{.Cpu}} when adding, {{.Node}} when deleting.
+// Commands adding nodes run in the background and are reported through
+// Operations.
+type ExecDriver struct {
+    Command    string
+    AddArgs    []string
+    DeleteArgs []string
+    // Timeout limits every command, DefaultExecTimeout if zero.
+    Timeout time.Duration
+
+    mu         sync.Mutex
+    operations []Operation
+}
+
+type execData struct {
+    NodeRequest
+    Id   string
+    Node string
+}
+
+// NewMinikubeDriver adds nodes of the shape of the minikube profile, so node
+// pools are not supported.
+func NewMinikubeDriver() *ExecDriver {
+    return &ExecDriver{
+        Command:    "minikube",
+        AddArgs:    []string{"node", "add"},
+        DeleteArgs: []string{"node", "delete", "{{.Node}}"},
+    }
+}
+
+func (d *ExecDriver) AddNode(node *corev1.Node) bool {
+    d.mu.Lock()
+    id := "add-" + strconv.Itoa(len(d.operations)+1)
+    d.operations = append(d.operations, Operation{Id: id, State: OperationPending})
+    i := len(d.operations) - 1
+    d.mu.Unlock()
+
+    ctx, cancel := context.WithTimeout(context.Background(), d.timeout())
+    output := &bytes.Buffer{}
+    cmd, err := d.command(ctx, d.AddArgs, execData{NodeRequest: newNodeRequest(node), Id: id})
+    if err == nil {
+        cmd.Stderr = output
+        err = cmd.Start()
+    }
+    if err != nil {
+        cancel()
+        log.Info(err)
+        d.finish(i, err, nil)
+        return false
+    }
+
+    go func() {
+        defer cancel()
+        d.finish(i, cmd.Wait(), output)
+    }()
+    return true
+}
+
+func (d *ExecDriver) DeleteNode(node *corev1.Node) bool {
+    ctx, cancel := context.WithTimeout(context.Background(), d.timeout())
+    defer cancel()
+
+    cmd, err := d.command(ctx, d.DeleteArgs, execData{Node: node.Name})
+    if err == nil {
+        var output []byte
+        if output, err = cmd.CombinedOutput(); err != nil {
+            log.Info(strings.TrimSpace(string(output)))
+        }
+    }
+    if err != nil {
+        log.Info(err)
+        return false
+    }
+    return true
+}
+
+// Operations returns the state of commands started by AddNode.
+func (d *ExecDriver) Operations() []Operation {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    return append([]Operation{}, d.operations...)
+}
+
+func (d *ExecDriver) timeout() time.Duration {
+    if d.Timeout > 0 {
+        return d.Timeout
+    }
+    return DefaultExecTimeout
+}
+
+func (d *ExecDriver) finish(i int, err error, output *bytes.Buffer) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    if err == nil {
+        d.operations[i].State = OperationDone
+        return
+    }
+    d.operations[i].State = OperationFailed
+    d.operations[i].Error = err.Error()
+    if output != nil && output.Len() > 0 {
+        d.operations[i].Error += ": " + strings.TrimSpace(output.String())
+    }
+}
+
+func (d *ExecDriver) command(ctx context.Context, args []string, data execData) (*exec.Cmd, error) {
+    rendered := make([]string, len(args))
+    for i, arg := range args {
+        tmpl, err := template.New("arg").Option("missingkey=error").Parse(arg)
+        if err != nil {
+            return nil, err
+        }
+        b := &strings.Builder{}
+        if err := tmpl.Execute(b, data); err != nil {
+            return nil, err
+        }
+        rendered[i] = b.String()
+    }
+    return exec.CommandContext(ctx, d.Command, rendered...), nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver_test
+
+import (
+    "testing"
+    "time"
+
+    driver "github.com/miha3009/planner/controllers/executor/driver"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// waitForOperations polls the driver until all its operations finish.
+func waitForOperations(d *driver.ExecDriver) []driver.Operation {
+    deadline := time.Now().Add(time.Second * 5)
+    ops := d.Operations()
+    for time.Now().Before(deadline) {
+        finished := true
+        for i := range ops {
+            finished = finished && ops[i].Finished()
+        }
+        if finished {
+            break
+        }
+        time.Sleep(time.Millisecond * 10)
+        ops = d.Operations()
+    }
+    return ops
+}
+
+func TestExecDriverReportsFailedCommands(t *testing.T) {
+    d := &driver.ExecDriver{Command: "sh", AddArgs: []string{"-c", "test {{.Id}}-{{.Pool}}-{{.Cpu}} = add-1-small-2 || (echo broken >&2; exit 1)"}}
+    if !d.AddNode(poolNode("small-0", "small", "2")) || !d.AddNode(poolNode("small-1", "small", "2")) {
+        t.Fatalf("expected commands to start")
+    }
+
+    ops := waitForOperations(d)
+    if ops[0].State != driver.OperationDone {
+        t.Errorf("expected first command to succeed, got %v", ops[0])
+    }
+    if ops[1].State != driver.OperationFailed || ops[1].Error != "exit status 1: broken" {
+        t.Errorf("expected second command to fail, got %v", ops[1])
+    }
+}
+
+func TestExecDriverStopsSlowCommands(t *testing.T) {
+    d := &driver.ExecDriver{Command: "sleep", AddArgs: []string{"5"}, DeleteArgs: []string{"5"}, Timeout: time.Millisecond * 50}
+
+    start := time.Now()
+    if !d.AddNode(&corev1.Node{}) {
+        t.Fatalf("expected command to start")
+    }
+    if ops := waitForOperations(d); ops[0].State != driver.OperationFailed {
+        t.Errorf("expected slow command to fail, got %v", ops[0])
+    }
+    if d.DeleteNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}}) {
+        t.Errorf("expected slow deletion to fail")
+    }
+    if time.Since(start) > time.Second*4 {
+        t.Errorf("expected commands to be stopped by the timeout")
+    }
+}
+
+func TestExecDriverDeletesNodes(t *testing.T) {
+    d := &driver.ExecDriver{Command: "true"}
+    if !d.DeleteNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}}) {
+        t.Errorf("expected deletion to succeed")
+    }
+    d = &driver.ExecDriver{Command: "false"}
+    if d.DeleteNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}}) {
+        t.Errorf("expected failed command to fail the deletion")
+    }
+}
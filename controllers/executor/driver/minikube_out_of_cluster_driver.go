@@ -1,48 +0,0 @@
-/*
-Copyright 2022.
-
-Licensed under the Apache License, Version 2.0 (the "License");
-you may not use this file except in compliance with the License.
-You may obtain a copy of the License at
-
-    http://www.apache.org/licenses/LICENSE-2.0
-
-Unless required by applicable law or agreed to in writing, software
-distributed under the License is distributed on an "AS IS" BASIS,
-WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-See the License for the specific language governing permissions and
-limitations under the License.
-*/
-
-package driver
-
-import (
-    "os/exec"
-
-    "github.com/prometheus/common/log"
-    corev1 "k8s.io/api/core/v1"
-)
-
-type MinikubeOutOfClusterDriver struct{}
-
-func (d *MinikubeOutOfClusterDriver) AddNode() bool {
-    cmd := exec.Command("minikube", "node", "add")
-    err := cmd.Run()
-
-    if err != nil {
-        log.Info(err)
-        return false
-    }
-    return true
-}
-
-func (d *MinikubeOutOfClusterDriver) DeleteNode(node *corev1.Node) bool {
-    cmd := exec.Command("minikube", "node", "delete", node.Name)
-    err := cmd.Run()
-
-    if err != nil {
-        log.Info(err.Error())
-        return false
-    }
-    return true
-}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+)
+
+const (
+    OperationPending = "pending"
+    OperationDone    = "done"
+    OperationFailed  = "failed"
+)
+
+// Operation is a node creation or deletion that a driver runs in the
+// background.
+type Operation struct {
+    Id    string `json:"id"`
+    State string `json:"state"`
+    // Node is the name of the created or deleted node, if known.
+    Node  string `json:"node,omitempty"`
+    Error string `json:"error,omitempty"`
+}
+
+func (op *Operation) Finished() bool {
+    return op.State == OperationDone || op.State == OperationFailed
+}
+
+// NodeRequest describes the node a driver is asked to create. Pool is empty
+// for nodes that do not belong to a node pool.
+type NodeRequest struct {
+    Name   string            `json:"name"`
+    Pool   string            `json:"pool,omitempty"`
+    Cpu    string            `json:"cpu,omitempty"`
+    Memory string            `json:"memory,omitempty"`
+    Labels map[string]string `json:"labels,omitempty"`
+    Taints []corev1.Taint    `json:"taints,omitempty"`
+}
+
+func newNodeRequest(node *corev1.Node) NodeRequest {
+    req := NodeRequest{
+        Name:   node.Name,
+        Pool:   node.Annotations[types.PoolAnnotation],
+        Labels: node.Labels,
+        Taints: node.Spec.Taints,
+    }
+    if cpu, ok := node.Status.Capacity[corev1.ResourceCPU]; ok {
+        req.Cpu = cpu.String()
+    }
+    if memory, ok := node.Status.Capacity[corev1.ResourceMemory]; ok {
+        req.Memory = memory.String()
+    }
+    return req
+}
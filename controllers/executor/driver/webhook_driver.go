@@ -0,0 +1,164 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/util/wait"
+)
+
+const webhookTimeout = time.Minute * 5
+
+// WebhookDriver provisions nodes through an HTTP service:
+//
+//   POST   {url}/nodes            starts creation of a node
+//   DELETE {url}/nodes/{name}     starts deletion of the node
+//   GET    {url}/operations/{id}  returns the state of an operation
+//
+// The body of POST is a NodeRequest with the pool and shape of the node. All
+// of them respond with an Operation in JSON. Deletion is awaited, while
+// creation is reported through Operations.
+type WebhookDriver struct {
+    URL          string
+    Client       *http.Client
+    PollInterval time.Duration
+
+    mu         sync.Mutex
+    operations []Operation
+}
+
+func NewWebhookDriver(url string) *WebhookDriver {
+    return &WebhookDriver{
+        URL:          strings.TrimSuffix(url, "/"),
+        Client:       &http.Client{Timeout: time.Second * 30},
+        PollInterval: time.Second * 5,
+    }
+}
+
+func (d *WebhookDriver) AddNode(node *corev1.Node) bool {
+    op, err := d.call(context.Background(), http.MethodPost, "/nodes", newNodeRequest(node))
+    if err != nil {
+        log.Info(err)
+        return false
+    }
+
+    d.mu.Lock()
+    d.operations = append(d.operations, *op)
+    d.mu.Unlock()
+    return op.State != OperationFailed
+}
+
+func (d *WebhookDriver) DeleteNode(node *corev1.Node) bool {
+    ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+    defer cancel()
+
+    op, err := d.call(ctx, http.MethodDelete, "/nodes/"+url.PathEscape(node.Name), nil)
+    if err == nil {
+        op, err = d.wait(ctx, op)
+    }
+    if err != nil {
+        log.Info(err)
+        return false
+    }
+    if op.State != OperationDone {
+        log.Info("Node ", node.Name, " is not deleted: ", op.Error)
+        return false
+    }
+    return true
+}
+
+// Operations refreshes and returns node creations started by AddNode.
+func (d *WebhookDriver) Operations() []Operation {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+
+    for i := range d.operations {
+        if d.operations[i].Finished() {
+            continue
+        }
+        op, err := d.status(context.Background(), d.operations[i].Id)
+        if err != nil {
+            log.Info(err)
+            continue
+        }
+        d.operations[i] = *op
+    }
+    return append([]Operation{}, d.operations...)
+}
+
+func (d *WebhookDriver) wait(ctx context.Context, op *Operation) (*Operation, error) {
+    err := wait.PollImmediateUntil(d.PollInterval, func() (bool, error) {
+        if op.Finished() {
+            return true, nil
+        }
+        var err error
+        op, err = d.status(ctx, op.Id)
+        return err == nil && op.Finished(), err
+    }, ctx.Done())
+    return op, err
+}
+
+func (d *WebhookDriver) status(ctx context.Context, id string) (*Operation, error) {
+    return d.call(ctx, http.MethodGet, "/operations/"+url.PathEscape(id), nil)
+}
+
+// call sends the body in JSON unless it is nil.
+func (d *WebhookDriver) call(ctx context.Context, method string, path string, body interface{}) (*Operation, error) {
+    payload := []byte{}
+    if body != nil {
+        var err error
+        if payload, err = json.Marshal(body); err != nil {
+            return nil, err
+        }
+    }
+    req, err := http.NewRequestWithContext(ctx, method, d.URL+path, bytes.NewReader(payload))
+    if err != nil {
+        return nil, err
+    }
+    if body != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := d.Client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode >= 300 {
+        return nil, fmt.Errorf("%s %s: unexpected status %s", method, path, resp.Status)
+    }
+
+    op := &Operation{}
+    if err := json.NewDecoder(resp.Body).Decode(op); err != nil {
+        return nil, fmt.Errorf("%s %s: %v", method, path, err)
+    }
+    if op.Id == "" {
+        return nil, fmt.Errorf("%s %s: operation has no id", method, path)
+    }
+    return op, nil
+}
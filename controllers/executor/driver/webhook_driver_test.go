@@ -0,0 +1,92 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver_test
+
+import (
+    "fmt"
+    "testing"
+    "time"
+
+    driver "github.com/miha3009/planner/controllers/executor/driver"
+    "github.com/miha3009/planner/controllers/executor/driver/webhookstub"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func poolNode(name string, pool string, cpu string) *corev1.Node {
+    node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+        Name:        name,
+        Labels:      map[string]string{"pool": pool},
+        Annotations: map[string]string{types.PoolAnnotation: pool},
+    }}
+    node.Status.Capacity = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}
+    return node
+}
+
+func TestWebhookDriverReportsOperations(t *testing.T) {
+    stub := webhookstub.New()
+    stub.PendingPolls = 2
+    stub.OnCreate = func(id string, req driver.NodeRequest) (string, error) {
+        if req.Pool != "small" || req.Labels["pool"] != "small" || req.Cpu != "2" {
+            return "", fmt.Errorf("no capacity in pool %s", req.Pool)
+        }
+        return "node-" + id, nil
+    }
+    server := stub.Start()
+    defer server.Close()
+
+    d := driver.NewWebhookDriver(server.URL + "/")
+    if !d.AddNode(poolNode("small-0", "small", "2")) || !d.AddNode(poolNode("large-0", "large", "8")) {
+        t.Fatalf("expected node creations to start")
+    }
+
+    ops := d.Operations()
+    if len(ops) != 2 || ops[0].State != driver.OperationPending {
+        t.Fatalf("expected pending operations, got %v", ops)
+    }
+    ops = d.Operations()
+    if ops[0].State != driver.OperationDone || ops[0].Node != "node-1" {
+        t.Errorf("expected node-1 to be created, got %v", ops[0])
+    }
+    if ops[1].State != driver.OperationFailed || ops[1].Error != "no capacity in pool large" {
+        t.Errorf("expected second creation to fail, got %v", ops[1])
+    }
+}
+
+func TestWebhookDriverWaitsForDeletion(t *testing.T) {
+    stub := webhookstub.New()
+    stub.PendingPolls = 3
+    stub.OnDelete = func(node string) error {
+        if node != "node-1" {
+            return fmt.Errorf("unknown node %s", node)
+        }
+        return nil
+    }
+    server := stub.Start()
+    defer server.Close()
+
+    d := driver.NewWebhookDriver(server.URL)
+    d.PollInterval = time.Millisecond
+    if !d.DeleteNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}) {
+        t.Errorf("expected node-1 to be deleted")
+    }
+    if d.DeleteNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}) {
+        t.Errorf("expected deletion of an unknown node to fail")
+    }
+}
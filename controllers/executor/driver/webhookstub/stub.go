@@ -0,0 +1,143 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhookstub serves the contract of driver.WebhookDriver from
+// memory, for tests and local runs.
+package webhookstub
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "sync"
+
+    driver "github.com/miha3009/planner/controllers/executor/driver"
+)
+
+// Stub finishes an operation after PendingPolls status requests. The result
+// is decided by OnCreate and OnDelete, which succeed if they are nil.
+type Stub struct {
+    PendingPolls int
+    // OnCreate returns the name of the node created for the request.
+    OnCreate func(id string, req driver.NodeRequest) (string, error)
+    OnDelete func(node string) error
+
+    mu         sync.Mutex
+    operations map[string]*driver.Operation
+    requests   map[string]driver.NodeRequest
+    polls      map[string]int
+}
+
+func New() *Stub {
+    return &Stub{
+        operations: make(map[string]*driver.Operation),
+        requests:   make(map[string]driver.NodeRequest),
+        polls:      make(map[string]int),
+    }
+}
+
+// Start serves the stub on a local port until Close is called on the
+// returned server.
+func (s *Stub) Start() *httptest.Server {
+    return httptest.NewServer(s)
+}
+
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    path := strings.Trim(r.URL.Path, "/")
+    switch {
+    case r.Method == http.MethodPost && path == "nodes":
+        req := driver.NodeRequest{}
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        op := &driver.Operation{Id: strconv.Itoa(len(s.operations) + 1)}
+        s.requests[op.Id] = req
+        writeOperation(w, http.StatusAccepted, s.start(op))
+    case r.Method == http.MethodDelete && strings.HasPrefix(path, "nodes/"):
+        op := &driver.Operation{Id: strconv.Itoa(len(s.operations) + 1), Node: strings.TrimPrefix(path, "nodes/")}
+        writeOperation(w, http.StatusAccepted, s.start(op))
+    case r.Method == http.MethodGet && strings.HasPrefix(path, "operations/"):
+        op, ok := s.operations[strings.TrimPrefix(path, "operations/")]
+        if !ok {
+            http.NotFound(w, r)
+            return
+        }
+        s.poll(op)
+        writeOperation(w, http.StatusOK, op)
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+// Operations returns all operations received by the stub.
+func (s *Stub) Operations() []driver.Operation {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    ops := make([]driver.Operation, 0, len(s.operations))
+    for i := 1; i <= len(s.operations); i++ {
+        ops = append(ops, *s.operations[strconv.Itoa(i)])
+    }
+    return ops
+}
+
+func (s *Stub) start(op *driver.Operation) *driver.Operation {
+    op.State = driver.OperationPending
+    s.operations[op.Id] = op
+    if s.PendingPolls == 0 {
+        s.finish(op)
+    }
+    return op
+}
+
+func (s *Stub) poll(op *driver.Operation) {
+    if op.Finished() {
+        return
+    }
+    s.polls[op.Id]++
+    if s.polls[op.Id] >= s.PendingPolls {
+        s.finish(op)
+    }
+}
+
+func (s *Stub) finish(op *driver.Operation) {
+    var err error
+    if op.Node == "" {
+        if s.OnCreate != nil {
+            op.Node, err = s.OnCreate(op.Id, s.requests[op.Id])
+        }
+    } else if s.OnDelete != nil {
+        err = s.OnDelete(op.Node)
+    }
+
+    op.State = driver.OperationDone
+    if err != nil {
+        op.State = driver.OperationFailed
+        op.Error = err.Error()
+    }
+}
+
+func writeOperation(w http.ResponseWriter, status int, op *driver.Operation) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(op)
+}
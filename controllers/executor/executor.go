@@ -18,13 +18,18 @@ package executor
 
 import (
     "context"
+    "encoding/json"
     "sort"
+    "sync"
     "time"
 
     appsv1 "github.com/miha3009/planner/api/v1"
+    helper "github.com/miha3009/planner/controllers/helper"
     types "github.com/miha3009/planner/controllers/types"
     corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    k8stypes "k8s.io/apimachinery/pkg/types"
     clientset "k8s.io/client-go/kubernetes"
 
     "sigs.k8s.io/controller-runtime/pkg/client"
@@ -32,75 +37,372 @@ import (
     "github.com/prometheus/common/log"
 )
 
+// NodeDriver adds and deletes nodes of the cluster. AddNode gets the planned
+// node: its labels, taints and capacity describe the node to create, and
+// nodes of a pool have the pool name in the types.PoolAnnotation annotation.
+// The name of a planned node is not a valid node name.
 type NodeDriver interface {
-    AddNode() bool
+    AddNode(node *corev1.Node) bool
     DeleteNode(node *corev1.Node) bool
 }
 
+// NodeMarker is implemented by drivers that leave node removal to an
+// external autoscaler. Their nodes are marked instead of being cordoned,
+// drained and deleted, and unmarked once a plan keeps them.
+type NodeMarker interface {
+    MarkNode(node *corev1.Node) bool
+    UnmarkNode(node *corev1.Node) bool
+}
+
 type Executor interface {
     ExecutePlan(ctx context.Context, events chan types.Event, cache *types.PlannerCache, clt client.Client, cltset *clientset.Clientset, planner appsv1.PlannerSpec)
 }
 
-type DefaultExecutor struct{}
+const (
+    defaultMovementTimeout = 300
+    cleanupTimeout         = time.Second * 30
+)
+
+type DefaultExecutor struct {
+    // Namespace of the execution journal. Defaults to JournalNamespace().
+    JournalNamespace string
+}
+
+func (exe *DefaultExecutor) journalNamespace() string {
+    if exe.JournalNamespace != "" {
+        return exe.JournalNamespace
+    }
+    return JournalNamespace()
+}
 
 func (exe *DefaultExecutor) ExecutePlan(ctx context.Context, events chan types.Event, cache *types.PlannerCache, clt client.Client, cltset *clientset.Clientset, planner appsv1.PlannerSpec) {
     plan := cache.Plan
-    movements := unite(cache.Nodes, plan.Movements, cache.UpdatedPods)
+    args := planner.Execution
+    if args == nil {
+        args = &appsv1.ExecutionArgs{}
+    }
+    timeout := time.Second * time.Duration(args.MovementTimeout)
+    if args.MovementTimeout == 0 {
+        timeout = time.Second * defaultMovementTimeout
+    }
+    nodeTimeout := time.Second * time.Duration(args.NodeCreationTimeout)
+    if args.NodeCreationTimeout == 0 {
+        nodeTimeout = time.Second * defaultNodeCreationTimeout
+    }
+    driver := getNodeDriver(args, clt, cltset)
+    placeholders := plan.NodesToCreate
+    scope, err := getNodeScope(planner.Scope)
+    if err != nil {
+        log.Info(err, ". Invalid node scope, nodes will not be created")
+        placeholders = nil
+    }
+
+    unmarkKeptNodes(driver, cache.Nodes, plan.NodesToDelete)
+    createdNodes := createNodes(ctx, cltset, driver, placeholders, scope, nodeTimeout)
+    if len(createdNodes) > 0 {
+        cache.RecordScaleUp(time.Now())
+        saveNodeChanges(cltset, exe.journalNamespace(), cache)
+    }
+    nodes := make([]corev1.Node, len(cache.Nodes), len(cache.Nodes)+len(createdNodes))
+    copy(nodes, cache.Nodes)
+    for _, node := range createdNodes {
+        nodes = append(nodes, *node)
+    }
+
+    resources := newResourceApplier(cltset, planner.ResourceApply)
+    recreated := resources.Prepare(ctx, cache.UpdatedPods)
+    movements := unite(cache.Nodes, plan.Movements, recreated)
     movements = prioritizeMovements(movements)
+    movements, unbound := bindNewNodes(movements, createdNodes)
+    plan.SetResults(append(make([]types.MovementResult, 0, len(movements)), unbound...))
 
-    for _, move := range movements {
-        movePod(ctx, cltset, move)
+    completed := executeMovements(ctx, cltset, exe.journalNamespace(), plan, movements, nodes, cache.Pods, args, timeout)
+    renameMovedPods(cache.Metrics, plan.Results)
+    if completed && !helper.ContextEnded(ctx) {
+        deleted := deleteNodes(ctx, cltset, driver, plan.NodesToDelete, plan.Results, timeout)
+        cache.RecordNodeDeletions(time.Now(), deleted)
+        if deleted > 0 {
+            saveNodeChanges(cltset, exe.journalNamespace(), cache)
+        }
+    }
+    if !helper.ContextEnded(ctx) {
+        resources.ApplyToOwners(ctx)
     }
 
     events <- types.ExecutingEnded
 }
 
-func movePod(ctx context.Context, cltset *clientset.Clientset, move types.Movement) bool {
-    newPod := &corev1.Pod{
-        ObjectMeta: metav1.ObjectMeta{
-            Namespace: move.Pod.Namespace,
-            Name:      NewNameForPod(move.Pod),
-        },
-        Spec: move.Pod.Spec,
+// renameMovedPods keeps metrics history of moved pods under their new names.
+func renameMovedPods(q types.MetricsQueue, results []types.MovementResult) {
+    for _, result := range results {
+        if result.Ok && result.NewPod != "" && result.NewPod != result.Movement.Pod.Name {
+            namespace := result.Movement.Pod.Namespace
+            q.Rename(types.PodKey(namespace, result.Movement.Pod.Name), types.PodKey(namespace, result.NewPod))
+        }
     }
+}
 
-    err := createPod(ctx, cltset, newPod, move.NewNode)
-    if err != nil {
-        log.Info(err)
+// executeMovements moves pods in a feasible order and appends the results
+// to the plan. Nothing is executed if the journal in namespace can not be
+// written or a journal of an earlier execution can not be recovered. It
+// returns false if execution was cancelled or did not start.
+func executeMovements(ctx context.Context, cltset clientset.Interface, namespace string, plan *types.Plan, movements []types.Movement, nodes []corev1.Node, pods [][]corev1.Pod, args *appsv1.ExecutionArgs, timeout time.Duration) bool {
+    if err := RecoverExecution(ctx, cltset, namespace); err != nil {
+        log.Info(err, ". Plan is not executed")
+        failMovements(plan, movements, "unfinished execution journal")
         return false
     }
 
-    for !isPodRunning(ctx, cltset, newPod) {
-        time.Sleep(time.Second)
+    maxParallel := args.MaxParallelMovements
+    if maxParallel == 0 {
+        maxParallel = 1
     }
 
-    deletePod(ctx, cltset, move.Pod)
+    excludedNodes := make(map[string]struct{})
+    for i := range plan.NodesToDelete {
+        excludedNodes[plan.NodesToDelete[i].Name] = struct{}{}
+    }
 
-    newPod.Labels = move.Pod.Labels
-    _, err = cltset.CoreV1().Pods("default").Update(ctx, newPod, metav1.UpdateOptions{})
+    model := newCapacityModel(nodes, pods)
+    steps, infeasible := orderMovements(model.copy(), movements, args.AllowDeleteBeforeCreate, excludedNodes)
+    journal := NewJournal(cltset, namespace)
+    if err := journal.Begin(steps); err != nil {
+        log.Info("Failed to write execution journal: ", err, ". Plan is not executed")
+        failMovements(plan, movements, "execution journal can not be written")
+        return false
+    }
+    for _, move := range infeasible {
+        plan.AddResults(types.MovementResult{Movement: move, Error: "no feasible execution order"})
+    }
+    runner := &stepRunner{cltset: cltset, journal: journal, timeout: timeout}
+
+    scheduler := newMovementScheduler(model, steps, args.MaxIncomingMovementsPerNode, args.MaxOutgoingMovementsPerNode)
+    for scheduler.HasPending() {
+        if helper.ContextEnded(ctx) {
+            break
+        }
+
+        wave, dropped := scheduler.NextWave()
+        plan.AddResults(dropped...)
+        results := runWave(ctx, runner.run, wave, maxParallel)
+        for i := range results {
+            scheduler.Complete(wave[i], results[i])
+        }
+        plan.AddResults(results...)
+    }
+
+    if scheduler.HasPending() {
+        // Execution was cancelled. Pods deleted before their copies were
+        // created must not be lost.
+        journal.Recover(context.Background(), timeout)
+        return false
+    }
+    journal.Finish(context.Background(), timeout)
+    return true
+}
+
+// failMovements appends a failed result for every movement.
+func failMovements(plan *types.Plan, movements []types.Movement, reason string) {
+    for _, move := range movements {
+        plan.AddResults(types.MovementResult{Movement: move, Error: reason})
+    }
+}
+
+// runWave executes steps of the wave with at most maxParallel steps at once.
+// Steps are started in the wave order, so the returned results belong to
+// the first steps of the wave.
+func runWave(ctx context.Context, run func(context.Context, executionStep) types.MovementResult, wave []executionStep, maxParallel int) []types.MovementResult {
+    results := make([]types.MovementResult, len(wave))
+    started := 0
+    slots := make(chan struct{}, maxParallel)
+    wg := sync.WaitGroup{}
+
+    for i := range wave {
+        slots <- struct{}{}
+        if helper.ContextEnded(ctx) {
+            <-slots
+            break
+        }
+
+        started++
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            results[i] = run(ctx, wave[i])
+            <-slots
+        }(i)
+    }
+    wg.Wait()
+
+    return results[:started]
+}
+
+// stepRunner executes steps and records their progress in the journal.
+type stepRunner struct {
+    cltset  clientset.Interface
+    journal *Journal
+    timeout time.Duration
+}
+
+func (r *stepRunner) run(ctx context.Context, step executionStep) types.MovementResult {
+    r.journal.SetPod(step.Id, step.Movement.Pod.Name)
+    var result types.MovementResult
+    switch step.Kind {
+    case deleteStep:
+        result = r.evictPod(ctx, step)
+    case createStep:
+        result = r.recreatePod(ctx, step)
+    default:
+        result = r.movePod(ctx, step)
+    }
+    return result
+}
+
+// movePod creates a copy of the pod on the new node and deletes the original
+// once the copy is ready. If the copy does not become ready in time, it is
+// deleted and the original is kept. If the original can not be deleted, the
+// step stays ready in the journal, so that recovery deletes it.
+func (r *stepRunner) movePod(ctx context.Context, step executionStep) types.MovementResult {
+    move := step.Movement
+    result := types.MovementResult{Movement: move}
+    newPod, err := r.createReadyCopy(ctx, step)
     if err != nil {
+        log.Info(err, ". Keeping pod ", move.Pod.Name)
+        result.Error = err.Error()
+        return result
+    }
+    result.NewPod = newPod.Name
+
+    // The copy is ready, so the movement is finished even if execution
+    // is cancelled meanwhile.
+    finishCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+    defer cancel()
+    if err := deletePod(finishCtx, r.cltset, move.Pod); err != nil {
+        log.Info(err, ". Pod ", move.Pod.Name, " is left on node ", move.OldNode.Name)
+        result.Error = err.Error()
+        return result
+    }
+    r.journal.SetState(step.Id, stateOldDeleted, "")
+
+    if err := setPodLabels(finishCtx, r.cltset, newPod, move.Pod.Labels); err != nil {
         log.Info(err)
     }
+    r.journal.SetState(step.Id, stateRelabeled, "")
 
-    return true
+    result.Ok = true
+    return result
 }
 
-func isPodRunning(ctx context.Context, cltset *clientset.Clientset, pod *corev1.Pod) bool {
-    pod, err := cltset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+// evictPod deletes the original pod of a delete-before-create movement and
+// waits until it is gone, so that its resources are free on the node.
+func (r *stepRunner) evictPod(ctx context.Context, step executionStep) types.MovementResult {
+    move := step.Movement
+    result := types.MovementResult{Movement: move}
+    err := r.cltset.CoreV1().Pods(move.Pod.Namespace).Delete(ctx, move.Pod.Name, metav1.DeleteOptions{})
+    if err == nil || errors.IsNotFound(err) {
+        r.journal.SetState(step.Id, stateOldDeleted, "")
+        err = waitForPodDeleted(ctx, r.cltset, move.Pod, r.timeout)
+    }
     if err != nil {
         log.Info(err)
+        result.Error = err.Error()
+        return result
     }
-    return pod.Status.Phase == corev1.PodRunning
+
+    result.Ok = true
+    return result
 }
 
-func deletePod(ctx context.Context, cltset *clientset.Clientset, pod *corev1.Pod) {
-    err := cltset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+// recreatePod creates a copy of a pod deleted by evictPod on the new node.
+// If the copy fails, the pod is returned to its old node, as the original
+// is already deleted. A pod that fails on both is left to the journal.
+func (r *stepRunner) recreatePod(ctx context.Context, step executionStep) types.MovementResult {
+    move := step.Movement
+    result := types.MovementResult{Movement: move}
+    newPod, err := r.createReadyCopy(ctx, step)
     if err != nil {
+        log.Info(err, ". Pod ", move.Pod.Name, " is already deleted, returning it to node ", move.OldNode.Name)
+        result.Error = err.Error()
+
+        fallback := step
+        fallback.Movement.NewNode = move.OldNode
+        if newPod, err = r.createReadyCopy(ctx, fallback); err != nil {
+            log.Info(err)
+            return result
+        }
+    } else {
+        result.Ok = true
+    }
+    result.NewPod = newPod.Name
+
+    if err := setPodLabels(ctx, r.cltset, newPod, move.Pod.Labels); err != nil {
         log.Info(err)
     }
+    r.journal.SetState(step.Id, stateRelabeled, "")
+    return result
+}
+
+// createReadyCopy creates a copy of the pod on the new node and waits until
+// it is ready. A copy that fails to become ready is deleted. The step is
+// marked as failed only when no copy is left, as a failed copy of a deleted
+// pod must be created again and a copy left running must be deleted by
+// recovery.
+func (r *stepRunner) createReadyCopy(ctx context.Context, step executionStep) (*corev1.Pod, error) {
+    move := step.Movement
+    newPod := &corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{
+            Namespace: move.Pod.Namespace,
+            Name:      NewNameForPod(move.Pod),
+        },
+        Spec: *move.Pod.Spec.DeepCopy(),
+    }
+
+    r.journal.SetState(step.Id, stateCreating, newPod.Name)
+    if err := createPod(ctx, r.cltset, newPod, move.NewNode); err != nil {
+        r.journal.SetState(step.Id, stateFailed, "")
+        return nil, err
+    }
+
+    if err := waitForPodReady(ctx, r.cltset, newPod, r.timeout); err != nil {
+        cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+        defer cancel()
+        if cleanupErr := deletePod(cleanupCtx, r.cltset, newPod); cleanupErr != nil {
+            log.Info(cleanupErr)
+        } else {
+            r.journal.SetState(step.Id, stateFailed, "")
+        }
+        return nil, err
+    }
+    r.journal.SetState(step.Id, stateReady, "")
+    return newPod, nil
+}
+
+func setPodLabels(ctx context.Context, cltset clientset.Interface, pod *corev1.Pod, labels map[string]string) error {
+    if len(labels) == 0 {
+        return nil
+    }
+
+    patch, err := json.Marshal(map[string]interface{}{
+        "metadata": map[string]interface{}{"labels": labels},
+    })
+    if err != nil {
+        return err
+    }
+
+    _, err = cltset.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+    return err
+}
+
+// deletePod deletes the pod. A pod that is already gone is not an error.
+func deletePod(ctx context.Context, cltset clientset.Interface, pod *corev1.Pod) error {
+    err := cltset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+    if errors.IsNotFound(err) {
+        return nil
+    }
+    return err
 }
 
-func createPod(ctx context.Context, cltset *clientset.Clientset, pod *corev1.Pod, node *corev1.Node) error {
+func createPod(ctx context.Context, cltset clientset.Interface, pod *corev1.Pod, node *corev1.Node) error {
     pod.Spec.NodeName = node.Name
     _, err := cltset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
     return err
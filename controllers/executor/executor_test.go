@@ -0,0 +1,238 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+)
+
+func testWave(size int) []executionStep {
+    wave := make([]executionStep, size)
+    for i := range wave {
+        pod := testPod("p"+strconv.Itoa(i), "a", "100m")
+        wave[i] = executionStep{Id: i, Movement: types.Movement{Pod: &pod, OldNode: &corev1.Node{}, NewNode: &corev1.Node{}}, Prev: -1}
+    }
+    return wave
+}
+
+func TestRunWaveLimitsParallelism(t *testing.T) {
+    mu := sync.Mutex{}
+    running, maxRunning := 0, 0
+    run := func(ctx context.Context, step executionStep) types.MovementResult {
+        mu.Lock()
+        running++
+        if running > maxRunning {
+            maxRunning = running
+        }
+        mu.Unlock()
+        time.Sleep(10 * time.Millisecond)
+        mu.Lock()
+        running--
+        mu.Unlock()
+        return types.MovementResult{Movement: step.Movement, Ok: true}
+    }
+
+    wave := testWave(6)
+    results := runWave(context.Background(), run, wave, 2)
+    if maxRunning != 2 {
+        t.Errorf("expected 2 steps at once, got %d", maxRunning)
+    }
+    if len(results) != len(wave) {
+        t.Fatalf("expected %d results, got %d", len(wave), len(results))
+    }
+    for i := range results {
+        if !results[i].Ok || results[i].Movement.Pod != wave[i].Movement.Pod {
+            t.Errorf("expected result %d to belong to step %d", i, i)
+        }
+    }
+}
+
+func TestRunWaveStopsOnCancel(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    run := func(ctx context.Context, step executionStep) types.MovementResult {
+        if step.Id == 1 {
+            cancel()
+        }
+        return types.MovementResult{Movement: step.Movement, Ok: step.Id != 1}
+    }
+
+    wave := testWave(4)
+    results := runWave(ctx, run, wave, 1)
+    if len(results) != 2 {
+        t.Fatalf("expected only started steps to have results, got %d", len(results))
+    }
+    if results[0].Movement.Pod.Name != "p0" || !results[0].Ok || results[1].Movement.Pod.Name != "p1" || results[1].Ok {
+        t.Errorf("expected results of the first two steps in wave order, got %+v", results)
+    }
+}
+
+func TestExecuteMovementsRecreatesPodWhenDeleteTimesOut(t *testing.T) {
+    ctx := context.Background()
+    nodes, pods, moves := swapCycle(false)
+    for i := range pods {
+        pods[i][0].Namespace = "default"
+    }
+    cltset := fake.NewSimpleClientset(&pods[0][0], &pods[1][0])
+    // The API server accepts the deletion, but the pod never goes away.
+    cltset.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        return true, nil, nil
+    })
+
+    plan := &types.Plan{}
+    args := &appsv1.ExecutionArgs{AllowDeleteBeforeCreate: true}
+    if !executeMovements(ctx, cltset, JournalNamespace(), plan, moves, nodes, pods, args, 50*time.Millisecond) {
+        t.Fatal("expected execution to complete")
+    }
+    for _, result := range plan.Results {
+        if result.Ok {
+            t.Errorf("expected no movement to succeed, pod %s moved", result.Movement.Pod.Name)
+        }
+    }
+
+    list, err := cltset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    recreated := false
+    for _, pod := range list.Items {
+        if strings.HasPrefix(pod.Name, "p1-") && pod.Spec.NodeName == "b" {
+            recreated = true
+        }
+    }
+    if !recreated {
+        t.Errorf("expected the deleted pod p1 to be recreated on node b")
+    }
+    if _, err := cltset.CoreV1().ConfigMaps(JournalNamespace()).Get(ctx, journalName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+        t.Errorf("expected journal to be removed after recovery")
+    }
+}
+
+func TestRecreatePodFallsBackToOldNode(t *testing.T) {
+    ctx := context.Background()
+    nodes := []corev1.Node{testNode("a", "1"), testNode("b", "1")}
+    pod := testPod("p1", "a", "1")
+    pod.Namespace = "default"
+    cltset := fake.NewSimpleClientset()
+    // Only copies on the old node become ready.
+    cltset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        created := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+        if created.Spec.NodeName == "a" {
+            created.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+        }
+        return false, nil, nil
+    })
+
+    runner := &stepRunner{cltset: cltset, journal: NewJournal(cltset, "planner-system"), timeout: 50 * time.Millisecond}
+    step := executionStep{Kind: createStep, Movement: types.Movement{Pod: &pod, OldNode: &nodes[0], NewNode: &nodes[1]}, Prev: -1}
+    result := runner.recreatePod(ctx, step)
+    if result.Ok || result.NewPod == "" {
+        t.Fatalf("expected failed movement with the pod returned, got %+v", result)
+    }
+
+    recreated, err := cltset.CoreV1().Pods("default").Get(ctx, result.NewPod, metav1.GetOptions{})
+    if err != nil || recreated.Spec.NodeName != "a" {
+        t.Errorf("expected the pod to be recreated on node a")
+    }
+}
+
+func TestMovePodKeepsJournalWhenOriginalIsNotDeleted(t *testing.T) {
+    ctx := context.Background()
+    pod := testPod("p", "a", "100m")
+    pod.Namespace = "default"
+    cltset := fake.NewSimpleClientset(&pod)
+    readyOnCreate(cltset)
+    failing := true
+    cltset.PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        if failing && action.(k8stesting.DeleteAction).GetName() == "p" {
+            return true, nil, errors.NewInternalError(context.DeadlineExceeded)
+        }
+        return false, nil, nil
+    })
+
+    steps := []executionStep{{Id: 0, Kind: moveStep, Prev: -1, Movement: types.Movement{
+        Pod: &pod, OldNode: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}}, NewNode: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+    }}}
+    journal := NewJournal(cltset, "planner-system")
+    if err := journal.Begin(steps); err != nil {
+        t.Fatal(err)
+    }
+    runner := &stepRunner{cltset: cltset, journal: journal, timeout: time.Second}
+    result := runner.run(ctx, steps[0])
+    if result.Ok || result.NewPod == "" {
+        t.Fatalf("expected the movement to fail with its copy kept, got %+v", result)
+    }
+    if journal.entries[0].State != stateReady {
+        t.Errorf("expected the step to stay ready, got %s", journal.entries[0].State)
+    }
+
+    journal.Finish(ctx, time.Second)
+    if _, err := cltset.CoreV1().ConfigMaps("planner-system").Get(ctx, journalName, metav1.GetOptions{}); err != nil {
+        t.Fatalf("expected journal to be kept while the original can not be deleted: %v", err)
+    }
+
+    failing = false
+    if err := RecoverExecution(ctx, cltset, "planner-system"); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := cltset.CoreV1().Pods("default").Get(ctx, "p", metav1.GetOptions{}); !errors.IsNotFound(err) {
+        t.Errorf("expected recovery to delete the original")
+    }
+    if _, err := cltset.CoreV1().ConfigMaps("planner-system").Get(ctx, journalName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+        t.Errorf("expected journal to be removed after recovery")
+    }
+}
+
+func TestExecuteMovementsNeedsJournal(t *testing.T) {
+    ctx := context.Background()
+    nodes, pods, moves := swapCycle(true)
+    pods[0][0].Namespace = "default"
+    pods[1][0].Namespace = "default"
+    cltset := fake.NewSimpleClientset(&pods[0][0], &pods[1][0])
+    cltset.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        return true, nil, errors.NewNotFound(corev1.Resource("namespaces"), "planner-system")
+    })
+
+    plan := &types.Plan{}
+    if executeMovements(ctx, cltset, "planner-system", plan, moves, nodes, pods, &appsv1.ExecutionArgs{}, 50*time.Millisecond) {
+        t.Fatal("expected execution not to start without a journal")
+    }
+    if len(plan.Results) != len(moves) {
+        t.Errorf("expected every movement to fail, got %d results", len(plan.Results))
+    }
+    list, err := cltset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(list.Items) != 2 {
+        t.Errorf("expected no pod to be moved, got %d pods", len(list.Items))
+    }
+}
@@ -0,0 +1,362 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientset "k8s.io/client-go/kubernetes"
+)
+
+type movementState string
+
+const (
+    statePending    movementState = "pending"
+    stateCreating   movementState = "creating"
+    stateReady      movementState = "ready"
+    stateOldDeleted movementState = "old-deleted"
+    stateRelabeled  movementState = "relabeled"
+    stateFailed     movementState = "failed"
+    stateRecovered  movementState = "recovered"
+)
+
+const (
+    journalName             = "planner-execution-journal"
+    journalKey              = "journal"
+    defaultJournalNamespace = "planner-system"
+)
+
+type journalEntry struct {
+    Step      int               `json:"step"`
+    Kind      stepKind          `json:"kind"`
+    Prev      int               `json:"prev"`
+    Namespace string            `json:"namespace"`
+    Pod       string            `json:"pod"`
+    NewPod    string            `json:"new_pod,omitempty"`
+    OldNode   string            `json:"old_node"`
+    NewNode   string            `json:"new_node"`
+    Labels    map[string]string `json:"labels,omitempty"`
+    // Spec is kept only for delete-before-create movements, because
+    // the original pod is gone before its copy exists.
+    Spec  *corev1.PodSpec `json:"spec,omitempty"`
+    State movementState   `json:"state"`
+}
+
+// Journal records the state of every execution step in a ConfigMap,
+// so that a plan interrupted by a controller restart can be reconciled.
+type Journal struct {
+    mutex     sync.Mutex
+    cltset    clientset.Interface
+    namespace string
+    entries   []journalEntry
+}
+
+// JournalNamespace is the namespace of the controller pod,
+// where the journal is stored.
+func JournalNamespace() string {
+    if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+        return namespace
+    }
+    return defaultJournalNamespace
+}
+
+func NewJournal(cltset clientset.Interface, namespace string) *Journal {
+    return &Journal{cltset: cltset, namespace: namespace}
+}
+
+// Begin writes all steps of the plan as pending.
+func (j *Journal) Begin(steps []executionStep) error {
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+
+    j.entries = make([]journalEntry, len(steps))
+    for i, step := range steps {
+        move := step.Movement
+        j.entries[i] = journalEntry{
+            Step:      step.Id,
+            Kind:      step.Kind,
+            Prev:      step.Prev,
+            Namespace: move.Pod.Namespace,
+            Pod:       move.Pod.Name,
+            OldNode:   move.OldNode.Name,
+            NewNode:   move.NewNode.Name,
+            Labels:    move.Pod.Labels,
+            State:     statePending,
+        }
+        if step.Kind != moveStep {
+            j.entries[i].Spec = move.Pod.Spec.DeepCopy()
+        }
+    }
+    return j.save()
+}
+
+// SetPod records the pod moved by the step. Later legs of a parked pod
+// move the copy created by the previous leg.
+func (j *Journal) SetPod(step int, pod string) {
+    j.update(step, func(entry *journalEntry) {
+        entry.Pod = pod
+    })
+}
+
+// SetState moves the step to the new state. newPod is the name of the copy
+// and is kept if empty.
+func (j *Journal) SetState(step int, state movementState, newPod string) {
+    j.update(step, func(entry *journalEntry) {
+        entry.State = state
+        if newPod != "" {
+            entry.NewPod = newPod
+        }
+    })
+}
+
+// End removes the journal once the plan has been executed.
+func (j *Journal) End(ctx context.Context) {
+    if j == nil {
+        return
+    }
+    err := j.cltset.CoreV1().ConfigMaps(j.namespace).Delete(ctx, journalName, metav1.DeleteOptions{})
+    if err != nil && !errors.IsNotFound(err) {
+        log.Info(err)
+    }
+}
+
+// Finish removes the journal after execution. Pods deleted before their
+// copies were created are recreated and pods left running twice are
+// deleted first.
+func (j *Journal) Finish(ctx context.Context, timeout time.Duration) {
+    if j == nil {
+        return
+    }
+    if j.unfinished() {
+        log.Info("Some movements were not finished, recovering")
+        j.Recover(ctx, timeout)
+        return
+    }
+    j.End(ctx)
+}
+
+// unfinished reports whether a pod was deleted by a delete step and its
+// copy was not created, or a move step left both the original and its copy.
+func (j *Journal) unfinished() bool {
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+    for i := range j.entries {
+        entry := &j.entries[i]
+        if entry.Kind == createStep && entry.State != stateRelabeled && j.prevDeleted(entry) {
+            return true
+        }
+        if entry.Kind == moveStep && (entry.State == stateCreating || entry.State == stateReady) {
+            return true
+        }
+    }
+    return false
+}
+
+func (j *Journal) update(step int, change func(entry *journalEntry)) {
+    if j == nil {
+        return
+    }
+
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+    if step < 0 || step >= len(j.entries) {
+        return
+    }
+    change(&j.entries[step])
+    if err := j.save(); err != nil {
+        log.Info("Failed to update execution journal: ", err)
+    }
+}
+
+// save writes entries to the ConfigMap. It does not depend on the execution
+// context, so that the last transitions are written even if it is cancelled.
+func (j *Journal) save() error {
+    data, err := json.Marshal(j.entries)
+    if err != nil {
+        return err
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+    defer cancel()
+    configMaps := j.cltset.CoreV1().ConfigMaps(j.namespace)
+    configMap := &corev1.ConfigMap{
+        ObjectMeta: metav1.ObjectMeta{Name: journalName, Namespace: j.namespace},
+        Data:       map[string]string{journalKey: string(data)},
+    }
+
+    _, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+    if errors.IsNotFound(err) {
+        _, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+    }
+    return err
+}
+
+// LoadJournal reads an unfinished journal. It returns nil if there is none.
+func LoadJournal(ctx context.Context, cltset clientset.Interface, namespace string) (*Journal, error) {
+    configMap, err := cltset.CoreV1().ConfigMaps(namespace).Get(ctx, journalName, metav1.GetOptions{})
+    if errors.IsNotFound(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    j := NewJournal(cltset, namespace)
+    if err := json.Unmarshal([]byte(configMap.Data[journalKey]), &j.entries); err != nil {
+        return nil, err
+    }
+    return j, nil
+}
+
+// RecoverExecution reconciles a journal left by an interrupted execution.
+// Movements that were in flight are finished when their copy is ready and
+// rolled back otherwise, so no pod is left duplicated. Pending movements
+// are not replayed, except copies of pods deleted before their creation.
+func RecoverExecution(ctx context.Context, cltset clientset.Interface, namespace string) error {
+    j, err := LoadJournal(ctx, cltset, namespace)
+    if err != nil || j == nil {
+        return err
+    }
+
+    log.Info("Found unfinished execution journal, recovering")
+    if !j.Recover(ctx, time.Second*defaultMovementTimeout) {
+        return fmt.Errorf("some pods could not be deleted, execution journal in namespace %s is kept", namespace)
+    }
+    return nil
+}
+
+// Recover finishes or rolls back every unfinished step and removes the journal.
+// Steps that could not delete a pod are kept in the journal for the next
+// recovery. It returns false if the journal is kept.
+func (j *Journal) Recover(ctx context.Context, timeout time.Duration) bool {
+    j.mutex.Lock()
+    defer j.mutex.Unlock()
+    // Entries are marked as recovered only after all of them, because
+    // create steps depend on the state of their delete steps.
+    recovered := make([]bool, len(j.entries))
+    for i := range j.entries {
+        recovered[i] = j.recoverEntry(ctx, &j.entries[i], timeout)
+    }
+
+    kept := false
+    for i := range j.entries {
+        if recovered[i] {
+            j.entries[i].State = stateRecovered
+        } else {
+            kept = true
+        }
+    }
+    if kept {
+        if err := j.save(); err != nil {
+            log.Info("Failed to update execution journal: ", err)
+        }
+        return false
+    }
+    j.End(ctx)
+    return true
+}
+
+// recoverEntry reconciles the step. It returns false if a pod of the step
+// could not be deleted.
+func (j *Journal) recoverEntry(ctx context.Context, entry *journalEntry, timeout time.Duration) bool {
+    pods := j.cltset.CoreV1().Pods(entry.Namespace)
+    original := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: entry.Namespace, Name: entry.Pod}}
+    newPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: entry.Namespace, Name: entry.NewPod}}
+
+    switch entry.State {
+    case statePending, stateFailed:
+        if entry.Kind == createStep && j.prevDeleted(entry) {
+            j.recreatePod(ctx, entry)
+        }
+    case stateCreating:
+        if entry.Kind == createStep {
+            // The original is gone, so the copy is kept whatever its state.
+            if _, err := pods.Get(ctx, entry.NewPod, metav1.GetOptions{}); errors.IsNotFound(err) {
+                j.recreatePod(ctx, entry)
+            } else {
+                j.relabel(ctx, newPod, entry.Labels)
+            }
+            return true
+        }
+        if entry.NewPod != "" {
+            log.Info("Rolling back movement of pod ", entry.Pod)
+            return j.deletePod(ctx, newPod)
+        }
+    case stateReady:
+        if entry.Kind == moveStep {
+            if err := waitForPodReady(ctx, j.cltset, newPod, timeout); err != nil {
+                log.Info(err, ". Rolling back movement of pod ", entry.Pod)
+                return j.deletePod(ctx, newPod)
+            }
+            log.Info("Finishing movement of pod ", entry.Pod)
+            if !j.deletePod(ctx, original) {
+                return false
+            }
+        }
+        j.relabel(ctx, newPod, entry.Labels)
+    case stateOldDeleted:
+        if entry.Kind == moveStep {
+            log.Info("Finishing movement of pod ", entry.Pod)
+            j.relabel(ctx, newPod, entry.Labels)
+        }
+    }
+    return true
+}
+
+func (j *Journal) recreatePod(ctx context.Context, entry *journalEntry) {
+    if entry.Spec == nil {
+        return
+    }
+
+    log.Info("Recreating deleted pod ", entry.Pod, " on node ", entry.NewNode)
+    pod := &corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Namespace: entry.Namespace, Name: entry.Pod, Labels: entry.Labels},
+        Spec:       *entry.Spec,
+    }
+    pod.Name = NewNameForPod(pod)
+    pod.Spec.NodeName = entry.NewNode
+    if _, err := j.cltset.CoreV1().Pods(entry.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+        log.Info(err)
+    }
+}
+
+func (j *Journal) deletePod(ctx context.Context, pod *corev1.Pod) bool {
+    if err := deletePod(ctx, j.cltset, pod); err != nil {
+        log.Info(err)
+        return false
+    }
+    return true
+}
+
+func (j *Journal) relabel(ctx context.Context, pod *corev1.Pod, labels map[string]string) {
+    if err := setPodLabels(ctx, j.cltset, pod, labels); err != nil {
+        log.Info(err)
+    }
+}
+
+func (j *Journal) prevDeleted(entry *journalEntry) bool {
+    return entry.Prev >= 0 && entry.Prev < len(j.entries) && j.entries[entry.Prev].State == stateOldDeleted
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes/fake"
+)
+
+func existingPod(name string, labels map[string]string) *corev1.Pod {
+    return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: labels}}
+}
+
+func TestRecoverExecution(t *testing.T) {
+    ctx := context.Background()
+    labels := map[string]string{"app": "web"}
+    cltset := fake.NewSimpleClientset(
+        existingPod("web-1", labels), existingPod("web-1-copy", nil),
+        existingPod("web-2-copy", nil),
+    )
+
+    j := NewJournal(cltset, "planner-system")
+    j.entries = []journalEntry{
+        // Crashed while the copy was starting: roll back.
+        {Step: 0, Kind: moveStep, Prev: -1, Namespace: "default", Pod: "web-1", NewPod: "web-1-copy", Labels: labels, State: stateCreating},
+        // Crashed after the original was deleted: finish.
+        {Step: 1, Kind: moveStep, Prev: -1, Namespace: "default", Pod: "web-2", NewPod: "web-2-copy", Labels: labels, State: stateOldDeleted},
+        // Deleted before its copy was created: recreate.
+        {Step: 2, Kind: deleteStep, Prev: -1, Namespace: "default", Pod: "web-3", Labels: labels, State: stateOldDeleted},
+        {Step: 3, Kind: createStep, Prev: 2, Namespace: "default", Pod: "web-3", NewNode: "b", Labels: labels,
+            Spec: &corev1.PodSpec{}, State: statePending},
+    }
+    if err := j.save(); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := RecoverExecution(ctx, cltset, "planner-system"); err != nil {
+        t.Fatal(err)
+    }
+
+    pods := cltset.CoreV1().Pods("default")
+    if _, err := pods.Get(ctx, "web-1-copy", metav1.GetOptions{}); !errors.IsNotFound(err) {
+        t.Errorf("expected unfinished copy to be deleted")
+    }
+    if _, err := pods.Get(ctx, "web-1", metav1.GetOptions{}); err != nil {
+        t.Errorf("expected original to be kept: %v", err)
+    }
+    if pod, err := pods.Get(ctx, "web-2-copy", metav1.GetOptions{}); err != nil || pod.Labels["app"] != "web" {
+        t.Errorf("expected copy to be relabeled")
+    }
+
+    list, err := pods.List(ctx, metav1.ListOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    recreated := false
+    for _, pod := range list.Items {
+        if pod.Spec.NodeName == "b" && pod.Labels["app"] == "web" {
+            recreated = true
+        }
+    }
+    if !recreated {
+        t.Errorf("expected deleted pod to be recreated on node b")
+    }
+
+    if _, err := cltset.CoreV1().ConfigMaps("planner-system").Get(ctx, journalName, metav1.GetOptions{}); !errors.IsNotFound(err) {
+        t.Errorf("expected journal to be removed")
+    }
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "encoding/json"
+    "time"
+
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientset "k8s.io/client-go/kubernetes"
+)
+
+const (
+    nodeChangesName = "planner-node-changes"
+    nodeChangesKey  = "changes"
+)
+
+// nodeChanges are the node changes of the cache that scale-down guards
+// look at. They are kept in a ConfigMap next to the journal, so that a
+// restart does not reset the cooldown after a scale-up and the deletion
+// budget.
+type nodeChanges struct {
+    LastScaleUp   time.Time   `json:"last_scale_up"`
+    NodeDeletions []time.Time `json:"node_deletions,omitempty"`
+}
+
+// SaveNodeChanges writes node changes of the cache to the namespace.
+func SaveNodeChanges(ctx context.Context, cltset clientset.Interface, namespace string, cache *types.PlannerCache) error {
+    data, err := json.Marshal(nodeChanges{LastScaleUp: cache.LastScaleUp, NodeDeletions: cache.NodeDeletions})
+    if err != nil {
+        return err
+    }
+
+    configMaps := cltset.CoreV1().ConfigMaps(namespace)
+    configMap := &corev1.ConfigMap{
+        ObjectMeta: metav1.ObjectMeta{Name: nodeChangesName, Namespace: namespace},
+        Data:       map[string]string{nodeChangesKey: string(data)},
+    }
+    _, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+    if errors.IsNotFound(err) {
+        _, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+    }
+    return err
+}
+
+// LoadNodeChanges restores node changes saved by SaveNodeChanges into the
+// cache. Nothing is restored if they were never saved.
+func LoadNodeChanges(ctx context.Context, cltset clientset.Interface, namespace string, cache *types.PlannerCache) error {
+    configMap, err := cltset.CoreV1().ConfigMaps(namespace).Get(ctx, nodeChangesName, metav1.GetOptions{})
+    if errors.IsNotFound(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    changes := nodeChanges{}
+    if err := json.Unmarshal([]byte(configMap.Data[nodeChangesKey]), &changes); err != nil {
+        return err
+    }
+    cache.LastScaleUp = changes.LastScaleUp
+    cache.NodeDeletions = changes.NodeDeletions
+    return nil
+}
+
+func saveNodeChanges(cltset clientset.Interface, namespace string, cache *types.PlannerCache) {
+    ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+    defer cancel()
+    if err := SaveNodeChanges(ctx, cltset, namespace, cache); err != nil {
+        log.Info("Failed to save node changes: ", err)
+    }
+}
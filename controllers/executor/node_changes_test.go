@@ -0,0 +1,53 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    types "github.com/miha3009/planner/controllers/types"
+    "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeChangesSurviveRestart(t *testing.T) {
+    ctx := context.Background()
+    cltset := fake.NewSimpleClientset()
+    now := time.Now()
+
+    cache := types.NewCache()
+    if err := LoadNodeChanges(ctx, cltset, "planner-system", cache); err != nil || !cache.LastScaleUp.IsZero() {
+        t.Fatalf("expected nothing to load before the first save, got %v, %v", cache.LastScaleUp, err)
+    }
+    cache.RecordScaleUp(now.Add(-time.Minute))
+    cache.RecordNodeDeletions(now, 2)
+    if err := SaveNodeChanges(ctx, cltset, "planner-system", cache); err != nil {
+        t.Fatal(err)
+    }
+
+    restarted := types.NewCache()
+    if err := LoadNodeChanges(ctx, cltset, "planner-system", restarted); err != nil {
+        t.Fatal(err)
+    }
+    if !restarted.LastScaleUp.Equal(cache.LastScaleUp) {
+        t.Errorf("expected the last scale-up to be restored, got %v", restarted.LastScaleUp)
+    }
+    if restarted.NodeDeletionsSince(now.Add(-time.Hour)) != 2 {
+        t.Errorf("expected the deletions of the last hour to be restored, got %v", restarted.NodeDeletions)
+    }
+}
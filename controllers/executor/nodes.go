@@ -0,0 +1,346 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "sort"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    driver "github.com/miha3009/planner/controllers/executor/driver"
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/util/wait"
+    clientset "k8s.io/client-go/kubernetes"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const defaultNodeCreationTimeout = 600
+
+var nodePollInterval = time.Second * 5
+
+// NodeStatusReporter is implemented by drivers that create nodes in the
+// background. Operations returns the state of every AddNode call, so that
+// the executor stops waiting for nodes that failed.
+type NodeStatusReporter interface {
+    Operations() []driver.Operation
+}
+
+func getNodeDriver(args *appsv1.ExecutionArgs, clt client.Client, cltset clientset.Interface) NodeDriver {
+    switch args.NodeDriver {
+    case "minikube":
+        return driver.NewMinikubeDriver()
+    case "cluster_api":
+        if args.ClusterAPI == nil {
+            log.Info("Cluster API driver is not configured")
+            return nil
+        }
+        return driver.NewClusterAPIDriver(clt, args.ClusterAPI.Namespace, args.ClusterAPI.MachineDeployment, args.ClusterAPI.MachineSet, args.ClusterAPI.Pools)
+    case "cluster_autoscaler":
+        return &driver.ClusterAutoscalerDriver{Clientset: cltset}
+    case "webhook":
+        if args.Webhook == nil {
+            log.Info("Webhook driver is not configured")
+            return nil
+        }
+        return driver.NewWebhookDriver(args.Webhook.URL)
+    case "exec":
+        if args.Exec == nil {
+            log.Info("Exec driver is not configured")
+            return nil
+        }
+        return &driver.ExecDriver{
+            Command:    args.Exec.Command,
+            AddArgs:    args.Exec.AddArgs,
+            DeleteArgs: args.Exec.DeleteArgs,
+            Timeout:    time.Duration(args.Exec.Timeout) * time.Second,
+        }
+    default:
+        return nil
+    }
+}
+
+// getNodeScope returns nil, i.e. all nodes, if the spec has no scope.
+func getNodeScope(args *appsv1.ScopeArgs) (*types.NodeScope, error) {
+    if args == nil {
+        return nil, nil
+    }
+    return types.NewNodeScope(args.NodeSelector, args.ExcludedNodes)
+}
+
+// createNodes asks the driver for a node per placeholder and waits until
+// the new nodes are Ready. Drivers get placeholders with the labels of the
+// scope, and new nodes out of the scope are not used. It returns
+// the new nodes by placeholder names.
+func createNodes(ctx context.Context, cltset clientset.Interface, drv NodeDriver, placeholders []corev1.Node, scope *types.NodeScope, timeout time.Duration) map[string]*corev1.Node {
+    created := make(map[string]*corev1.Node)
+    if len(placeholders) == 0 {
+        return created
+    }
+    if drv == nil {
+        log.Info("Node driver is not configured, ", len(placeholders), " nodes will not be created")
+        return created
+    }
+
+    nodes, err := cltset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+    if err != nil {
+        log.Info(err)
+        return created
+    }
+    known := make(map[string]struct{})
+    for i := range nodes.Items {
+        known[nodes.Items[i].Name] = struct{}{}
+    }
+
+    requested := 0
+    for i := range placeholders {
+        if drv.AddNode(scope.WithLabels(&placeholders[i])) {
+            requested++
+        }
+    }
+
+    failed := func() int { return 0 }
+    if reporter, ok := drv.(NodeStatusReporter); ok {
+        failed = func() int { return failedOperations(reporter.Operations()) }
+        defer logFailedOperations(reporter)
+    }
+
+    newNodes := waitForNewNodes(ctx, cltset, known, scope, requested, failed, timeout)
+    for name, node := range matchNewNodes(placeholders, newNodes) {
+        log.Info("Node ", node.Name, " is created for planned node ", name)
+        created[name] = node
+    }
+    return created
+}
+
+// matchNewNodes pairs new nodes with placeholders. A placeholder of a node
+// pool gets a node with the labels of the pool, others get the rest in
+// creation order. Pool placeholders without such a node are not created, as
+// pods planned for the pool may not fit a node of another kind.
+func matchNewNodes(placeholders []corev1.Node, newNodes []corev1.Node) map[string]*corev1.Node {
+    matched := make(map[string]*corev1.Node)
+    used := make([]bool, len(newNodes))
+    for i := range placeholders {
+        if len(placeholders[i].Labels) == 0 {
+            continue
+        }
+        for j := range newNodes {
+            if !used[j] && hasLabels(&newNodes[j], placeholders[i].Labels) {
+                matched[placeholders[i].Name] = &newNodes[j]
+                used[j] = true
+                break
+            }
+        }
+        if _, ok := matched[placeholders[i].Name]; !ok {
+            log.Info("No new node has labels of planned node ", placeholders[i].Name)
+        }
+    }
+
+    j := 0
+    for i := range placeholders {
+        if len(placeholders[i].Labels) != 0 {
+            continue
+        }
+        for j < len(newNodes) && used[j] {
+            j++
+        }
+        if j == len(newNodes) {
+            break
+        }
+        matched[placeholders[i].Name] = &newNodes[j]
+        used[j] = true
+    }
+    return matched
+}
+
+func hasLabels(node *corev1.Node, labels map[string]string) bool {
+    for key, value := range labels {
+        if node.Labels[key] != value {
+            return false
+        }
+    }
+    return true
+}
+
+// waitForNewNodes polls nodes until count Ready nodes of the scope missing
+// from known appear or the timeout expires. It stops earlier if the driver reports that
+// some nodes will never appear. New nodes out of the scope are logged and
+// added to known. Nodes are returned oldest first.
+func waitForNewNodes(ctx context.Context, cltset clientset.Interface, known map[string]struct{}, scope *types.NodeScope, count int, failed func() int, timeout time.Duration) []corev1.Node {
+    ready := make([]corev1.Node, 0)
+    if count == 0 {
+        return ready
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+    err := wait.PollImmediateUntil(nodePollInterval, func() (bool, error) {
+        nodes, err := cltset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+        if err != nil {
+            log.Info(err)
+            return false, nil
+        }
+
+        ready = ready[:0]
+        for i := range nodes.Items {
+            node := &nodes.Items[i]
+            if _, ok := known[node.Name]; ok || !isNodeReady(node) {
+                continue
+            }
+            if !scope.Contains(node) {
+                log.Info("New node ", node.Name, " is out of the scope and is not used")
+                known[node.Name] = struct{}{}
+                continue
+            }
+            ready = append(ready, *node)
+        }
+        return len(ready) >= count-failed(), nil
+    }, ctx.Done())
+    if err != nil {
+        log.Info("Only ", len(ready), " of ", count, " new nodes are ready after ", timeout)
+    }
+
+    sort.Slice(ready, func(i, j int) bool {
+        return ready[i].CreationTimestamp.Before(&ready[j].CreationTimestamp)
+    })
+    if len(ready) > count {
+        ready = ready[:count]
+    }
+    return ready
+}
+
+func failedOperations(operations []driver.Operation) int {
+    failed := 0
+    for _, op := range operations {
+        if op.State == driver.OperationFailed {
+            failed++
+        }
+    }
+    return failed
+}
+
+func logFailedOperations(reporter NodeStatusReporter) {
+    for _, op := range reporter.Operations() {
+        if op.State == driver.OperationFailed {
+            log.Info("Node creation ", op.Id, " failed: ", op.Error)
+        }
+    }
+}
+
+func isNodeReady(node *corev1.Node) bool {
+    for _, condition := range node.Status.Conditions {
+        if condition.Type == corev1.NodeReady {
+            return condition.Status == corev1.ConditionTrue
+        }
+    }
+    return false
+}
+
+// bindNewNodes replaces planned nodes in movements with the created ones.
+// Movements to nodes that were not created are returned as failed.
+func bindNewNodes(moves []types.Movement, created map[string]*corev1.Node) ([]types.Movement, []types.MovementResult) {
+    bound := make([]types.Movement, 0, len(moves))
+    failed := make([]types.MovementResult, 0)
+    for _, move := range moves {
+        if !types.IsNewNode(move.NewNode) {
+            bound = append(bound, move)
+            continue
+        }
+
+        if node, ok := created[move.NewNode.Name]; ok {
+            move.NewNode = node
+            bound = append(bound, move)
+        } else {
+            failed = append(failed, types.MovementResult{Movement: move, Error: "node " + move.NewNode.Name + " was not created"})
+        }
+    }
+    return bound, failed
+}
+
+// unmarkKeptNodes unmarks nodes marked by earlier plans that the plan does
+// not delete anymore.
+func unmarkKeptNodes(drv NodeDriver, nodes []corev1.Node, toDelete []corev1.Node) {
+    marker, ok := drv.(NodeMarker)
+    if !ok {
+        return
+    }
+
+    deleted := make(map[string]struct{})
+    for i := range toDelete {
+        deleted[toDelete[i].Name] = struct{}{}
+    }
+    for i := range nodes {
+        if _, ok := deleted[nodes[i].Name]; !ok {
+            marker.UnmarkNode(&nodes[i])
+        }
+    }
+}
+
+// deleteNodes drains and deletes nodes that all planned pods have left.
+// A node is uncordoned if it can not be drained or deleted. Drivers
+// implementing NodeMarker only mark such nodes. It returns the number of
+// deleted or marked nodes.
+func deleteNodes(ctx context.Context, cltset clientset.Interface, drv NodeDriver, nodes []corev1.Node, results []types.MovementResult, timeout time.Duration) int {
+    if len(nodes) == 0 {
+        return 0
+    }
+    if drv == nil {
+        log.Info("Node driver is not configured, ", len(nodes), " nodes will not be deleted")
+        return 0
+    }
+
+    notLeft := make(map[string]struct{})
+    for _, result := range results {
+        if !result.Ok {
+            notLeft[result.Movement.OldNode.Name] = struct{}{}
+        }
+    }
+
+    deleted := 0
+    drn := &drainer{cltset: cltset, timeout: timeout}
+    for i := range nodes {
+        node := &nodes[i]
+        if _, ok := notLeft[node.Name]; ok {
+            log.Info("Node ", node.Name, " will not be deleted, because some of its pods have not moved")
+            continue
+        }
+
+        if marker, ok := drv.(NodeMarker); ok {
+            if marker.MarkNode(node) {
+                log.Info("Node ", node.Name, " is marked for scale down")
+                deleted++
+            }
+            continue
+        }
+
+        if err := drn.Drain(ctx, node); err != nil {
+            log.Info(err)
+            continue
+        }
+        if !drv.DeleteNode(node) {
+            log.Info("Driver failed to delete node ", node.Name)
+            drn.Uncordon(node)
+            continue
+        }
+        log.Info("Node ", node.Name, " is deleted")
+        deleted++
+    }
+    return deleted
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "strconv"
+    "testing"
+    "time"
+
+    driver "github.com/miha3009/planner/controllers/executor/driver"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientset "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeNodeDriver struct {
+    cltset  clientset.Interface
+    added   int
+    planned []string
+    deleted []string
+}
+
+func (d *fakeNodeDriver) AddNode(planned *corev1.Node) bool {
+    d.added++
+    d.planned = append(d.planned, planned.Name)
+    node := &corev1.Node{
+        ObjectMeta: metav1.ObjectMeta{Name: "new-" + strconv.Itoa(d.added), Labels: planned.Labels},
+        Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+            {Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+        }},
+    }
+    _, err := d.cltset.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{})
+    return err == nil
+}
+
+func (d *fakeNodeDriver) DeleteNode(node *corev1.Node) bool {
+    d.deleted = append(d.deleted, node.Name)
+    return true
+}
+
+func TestCreateNodesBindsPlaceholders(t *testing.T) {
+    nodePollInterval = time.Millisecond
+    cltset := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}})
+    drv := &fakeNodeDriver{cltset: cltset}
+
+    placeholders := []corev1.Node{
+        {ObjectMeta: metav1.ObjectMeta{Name: types.NewNodeName("0")}},
+        {ObjectMeta: metav1.ObjectMeta{Name: types.NewNodeName("1")}},
+    }
+    created := createNodes(context.Background(), cltset, drv, placeholders[:1], nil, time.Second)
+    if len(created) != 1 || created[types.NewNodeName("0")] == nil {
+        t.Fatalf("expected placeholder 0 to be created, got %v", created)
+    }
+    if len(drv.planned) != 1 || drv.planned[0] != types.NewNodeName("0") {
+        t.Errorf("expected the driver to get placeholder 0, got %v", drv.planned)
+    }
+
+    pod := testPod("p", "a", "100m")
+    oldNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}}
+    moves := []types.Movement{
+        {Pod: &pod, OldNode: oldNode, NewNode: &placeholders[0]},
+        {Pod: &pod, OldNode: oldNode, NewNode: &placeholders[1]},
+    }
+    bound, failed := bindNewNodes(moves, created)
+    if len(bound) != 1 || bound[0].NewNode.Name != created[types.NewNodeName("0")].Name {
+        t.Errorf("expected movement to be bound to the created node")
+    }
+    if len(failed) != 1 || failed[0].Movement.NewNode.Name != types.NewNodeName("1") {
+        t.Errorf("expected movement to the missing node to fail")
+    }
+}
+
+func TestCreateNodesSkipsOutOfScopeNodes(t *testing.T) {
+    nodePollInterval = time.Millisecond
+    cltset := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}})
+    drv := &fakeNodeDriver{cltset: cltset}
+    scope, err := types.NewNodeScope(nil, []string{"new-1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    placeholders := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "0"}}}
+    created := createNodes(context.Background(), cltset, drv, placeholders, scope, 10*time.Millisecond)
+    if len(created) != 0 {
+        t.Errorf("expected out-of-scope node not to be used, got %v", created)
+    }
+}
+
+func TestCreateNodesLabelsNodesOfScope(t *testing.T) {
+    nodePollInterval = time.Millisecond
+    cltset := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}})
+    drv := &fakeNodeDriver{cltset: cltset}
+    scope, err := types.NewNodeScope(&metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    placeholders := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "0"}}}
+    created := createNodes(context.Background(), cltset, drv, placeholders, scope, time.Second)
+    if len(created) != 1 || created["0"].Labels["team"] != "web" {
+        t.Errorf("expected the new node to get labels of the scope, got %v", created)
+    }
+    if len(placeholders[0].Labels) != 0 {
+        t.Errorf("expected the placeholder to be kept as is")
+    }
+}
+
+func TestDeleteNodesOnlyWhenPodsMoved(t *testing.T) {
+    nodes := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "a"}}, {ObjectMeta: metav1.ObjectMeta{Name: "b"}}}
+    daemon := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+        Namespace: "default", Name: "agent",
+        OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "agent"}},
+    }, Spec: corev1.PodSpec{NodeName: "a"}}
+    cltset := fake.NewSimpleClientset(&nodes[0], &nodes[1], daemon)
+    drv := &fakeNodeDriver{cltset: cltset}
+
+    pod := testPod("p", "b", "100m")
+    results := []types.MovementResult{{Movement: types.Movement{Pod: &pod, OldNode: &nodes[1], NewNode: &nodes[0]}, Error: "timeout"}}
+    deleteNodes(context.Background(), cltset, drv, nodes, results, time.Second)
+
+    if len(drv.deleted) != 1 || drv.deleted[0] != "a" {
+        t.Fatalf("expected only node a to be deleted, got %v", drv.deleted)
+    }
+    node, err := cltset.CoreV1().Nodes().Get(context.Background(), "a", metav1.GetOptions{})
+    if err != nil || !node.Spec.Unschedulable {
+        t.Errorf("expected node a to be cordoned")
+    }
+    if _, err := cltset.CoreV1().Pods("default").Get(context.Background(), "agent", metav1.GetOptions{}); err != nil {
+        t.Errorf("expected DaemonSet pod to be kept: %v", err)
+    }
+}
+
+// failingNodeDriver creates only the first node and reports the others
+// as failed.
+type failingNodeDriver struct {
+    fakeNodeDriver
+    requested int
+}
+
+func (d *failingNodeDriver) AddNode(planned *corev1.Node) bool {
+    d.requested++
+    if d.requested > 1 {
+        return true
+    }
+    return d.fakeNodeDriver.AddNode(planned)
+}
+
+func (d *failingNodeDriver) Operations() []driver.Operation {
+    ops := []driver.Operation{{Id: "1", State: driver.OperationDone}}
+    for i := 2; i <= d.requested; i++ {
+        ops = append(ops, driver.Operation{Id: strconv.Itoa(i), State: driver.OperationFailed, Error: "no capacity"})
+    }
+    return ops
+}
+
+func TestCreateNodesStopsOnFailedOperations(t *testing.T) {
+    nodePollInterval = time.Millisecond
+    cltset := fake.NewSimpleClientset()
+    drv := &failingNodeDriver{fakeNodeDriver: fakeNodeDriver{cltset: cltset}}
+
+    placeholders := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "0"}}, {ObjectMeta: metav1.ObjectMeta{Name: "1"}}}
+    start := time.Now()
+    created := createNodes(context.Background(), cltset, drv, placeholders, nil, time.Minute)
+    if len(created) != 1 {
+        t.Errorf("expected one node to be created, got %v", created)
+    }
+    if time.Since(start) > time.Second*10 {
+        t.Errorf("expected waiting to stop when node creation fails")
+    }
+}
+
+func TestMatchNewNodesKeepsPools(t *testing.T) {
+    gpu := map[string]string{"pool": "gpu"}
+    placeholders := []corev1.Node{
+        {ObjectMeta: metav1.ObjectMeta{Name: "gpu-0", Labels: gpu}},
+        {ObjectMeta: metav1.ObjectMeta{Name: "gpu-1", Labels: gpu}},
+        {ObjectMeta: metav1.ObjectMeta{Name: "any"}},
+    }
+    newNodes := []corev1.Node{
+        {ObjectMeta: metav1.ObjectMeta{Name: "new-1"}},
+        {ObjectMeta: metav1.ObjectMeta{Name: "new-2", Labels: gpu}},
+        {ObjectMeta: metav1.ObjectMeta{Name: "new-3"}},
+    }
+
+    matched := matchNewNodes(placeholders, newNodes)
+    if matched["gpu-0"] == nil || matched["gpu-0"].Name != "new-2" {
+        t.Errorf("expected gpu-0 to get the gpu node, got %v", matched["gpu-0"])
+    }
+    if _, ok := matched["gpu-1"]; ok {
+        t.Errorf("expected gpu-1 not to get a node of another pool, got %s", matched["gpu-1"].Name)
+    }
+    if matched["any"] == nil || matched["any"].Name != "new-1" {
+        t.Errorf("expected the placeholder without labels to get the first node, got %v", matched["any"])
+    }
+}
+
+func TestUnmarkKeptNodes(t *testing.T) {
+    ctx := context.Background()
+    marked := func(name string) corev1.Node {
+        return corev1.Node{
+            ObjectMeta: metav1.ObjectMeta{Name: name},
+            Spec: corev1.NodeSpec{Taints: []corev1.Taint{
+                {Key: "dedicated", Value: "db", Effect: corev1.TaintEffectNoSchedule},
+                {Key: driver.ScaleDownCandidateTaint, Effect: corev1.TaintEffectPreferNoSchedule},
+            }},
+        }
+    }
+    nodes := []corev1.Node{marked("a"), marked("b"), {ObjectMeta: metav1.ObjectMeta{Name: "c"}}}
+    cltset := fake.NewSimpleClientset(&nodes[0], &nodes[1], &nodes[2])
+    drv := &driver.ClusterAutoscalerDriver{Clientset: cltset}
+
+    unmarkKeptNodes(drv, nodes, nodes[1:2])
+
+    a, _ := cltset.CoreV1().Nodes().Get(ctx, "a", metav1.GetOptions{})
+    if len(a.Spec.Taints) != 1 || a.Spec.Taints[0].Key != "dedicated" {
+        t.Errorf("expected only the scale-down taint to be removed from node a, got %v", a.Spec.Taints)
+    }
+    b, _ := cltset.CoreV1().Nodes().Get(ctx, "b", metav1.GetOptions{})
+    if len(b.Spec.Taints) != 2 {
+        t.Errorf("expected node b to stay marked, got %v", b.Spec.Taints)
+    }
+}
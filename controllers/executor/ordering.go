@@ -0,0 +1,426 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+)
+
+type stepKind int
+
+const (
+    // Create a copy of the pod on the new node, then delete the original.
+    moveStep stepKind = 0
+    // Delete the original only, its copy is created by the next createStep.
+    deleteStep stepKind = 1
+    // Create a copy of the pod deleted by the previous deleteStep.
+    createStep stepKind = 2
+)
+
+type executionStep struct {
+    Id       int
+    Kind     stepKind
+    Movement types.Movement
+    // Step that must succeed before this one starts, -1 if none.
+    Prev int
+}
+
+type resources struct {
+    Cpu    int64
+    Memory int64
+}
+
+func (r resources) fits(req resources) bool {
+    return req.Cpu <= r.Cpu && req.Memory <= r.Memory
+}
+
+type nodeState struct {
+    Node     *corev1.Node
+    Free     resources
+    Incoming int
+    Outgoing int
+}
+
+// capacityModel tracks free resources of nodes the same way as the Base
+// constraint does: allocatable minus requests of pods on the node.
+type capacityModel map[string]*nodeState
+
+func newCapacityModel(nodes []corev1.Node, pods [][]corev1.Pod) capacityModel {
+    model := make(capacityModel)
+    for i := range nodes {
+        free := resources{
+            Cpu:    nodes[i].Status.Allocatable.Cpu().MilliValue(),
+            Memory: nodes[i].Status.Allocatable.Memory().Value(),
+        }
+        if i < len(pods) {
+            for j := range pods[i] {
+                req := podRequests(&pods[i][j])
+                free.Cpu -= req.Cpu
+                free.Memory -= req.Memory
+            }
+        }
+        model[nodes[i].Name] = &nodeState{Node: &nodes[i], Free: free}
+    }
+    return model
+}
+
+func (m capacityModel) copy() capacityModel {
+    c := make(capacityModel)
+    for name, node := range m {
+        nodeCopy := *node
+        c[name] = &nodeCopy
+    }
+    return c
+}
+
+// fits reports whether the pod can be placed on the node. Nodes unknown to
+// the model (e.g. just created) are not limited.
+func (m capacityModel) fits(nodeName string, pod *corev1.Pod) bool {
+    node, ok := m[nodeName]
+    return !ok || node.Free.fits(podRequests(pod))
+}
+
+func (m capacityModel) take(nodeName string, pod *corev1.Pod) {
+    if node, ok := m[nodeName]; ok {
+        req := podRequests(pod)
+        node.Free.Cpu -= req.Cpu
+        node.Free.Memory -= req.Memory
+    }
+}
+
+func (m capacityModel) release(nodeName string, pod *corev1.Pod) {
+    if node, ok := m[nodeName]; ok {
+        req := podRequests(pod)
+        node.Free.Cpu += req.Cpu
+        node.Free.Memory += req.Memory
+    }
+}
+
+// orderMovements turns movements into steps such that every node keeps
+// enough resources after each step. Movements are taken in the given order
+// whenever they fit. When none fits, a pod of the cycle is parked on a node
+// with slack or, if allowDeleteBeforeCreate is set, deleted before its copy
+// is created. Movements that can not be ordered are returned separately.
+func orderMovements(model capacityModel, moves []types.Movement, allowDeleteBeforeCreate bool, excludedNodes map[string]struct{}) ([]executionStep, []types.Movement) {
+    steps := make([]executionStep, 0, len(moves))
+    infeasible := make([]types.Movement, 0)
+    pending := make([]executionStep, len(moves))
+    for i := range moves {
+        pending[i] = executionStep{Kind: moveStep, Movement: moves[i], Prev: -1}
+    }
+
+    addStep := func(step executionStep) int {
+        step.Id = len(steps)
+        steps = append(steps, step)
+        return step.Id
+    }
+
+    for len(pending) > 0 {
+        if i := firstFitting(model, pending); i != -1 {
+            step := pending[i]
+            model.take(step.Movement.NewNode.Name, step.Movement.Pod)
+            if step.Kind == moveStep {
+                model.release(step.Movement.OldNode.Name, step.Movement.Pod)
+            }
+            addStep(step)
+            pending = append(pending[:i], pending[i+1:]...)
+            continue
+        }
+
+        i := findCycleBreaker(model, pending)
+        if i == -1 {
+            log.Info("No feasible execution order for pod ", pending[0].Movement.Pod.Name)
+            infeasible = append(infeasible, pending[0].Movement)
+            pending = pending[1:]
+            continue
+        }
+
+        step := pending[i]
+        if parking := findParkingNode(model, step.Movement, excludedNodes); parking != nil {
+            log.Info("Parking pod ", step.Movement.Pod.Name, " on node ", parking.Name)
+            model.take(parking.Name, step.Movement.Pod)
+            model.release(step.Movement.OldNode.Name, step.Movement.Pod)
+            id := addStep(executionStep{
+                Kind:     moveStep,
+                Movement: types.Movement{Pod: step.Movement.Pod, OldNode: step.Movement.OldNode, NewNode: parking},
+                Prev:     step.Prev,
+            })
+            pending[i] = executionStep{
+                Kind:     moveStep,
+                Movement: types.Movement{Pod: step.Movement.Pod, OldNode: parking, NewNode: step.Movement.NewNode},
+                Prev:     id,
+            }
+        } else if allowDeleteBeforeCreate {
+            log.Info("Pod ", step.Movement.Pod.Name, " will be deleted before its copy is created")
+            model.release(step.Movement.OldNode.Name, step.Movement.Pod)
+            id := addStep(executionStep{Kind: deleteStep, Movement: step.Movement, Prev: step.Prev})
+            pending[i] = executionStep{Kind: createStep, Movement: step.Movement, Prev: id}
+        } else {
+            log.Info("No feasible execution order for pod ", step.Movement.Pod.Name)
+            infeasible = append(infeasible, step.Movement)
+            pending = append(pending[:i], pending[i+1:]...)
+        }
+    }
+
+    return steps, infeasible
+}
+
+func firstFitting(model capacityModel, pending []executionStep) int {
+    for i := range pending {
+        if model.fits(pending[i].Movement.NewNode.Name, pending[i].Movement.Pod) {
+            return i
+        }
+    }
+    return -1
+}
+
+// findCycleBreaker returns a pending movement whose pod, once gone from its
+// node, lets some pending movement fit there.
+func findCycleBreaker(model capacityModel, pending []executionStep) int {
+    for i := range pending {
+        if pending[i].Kind != moveStep {
+            continue
+        }
+        oldNode, ok := model[pending[i].Movement.OldNode.Name]
+        if !ok {
+            continue
+        }
+
+        free := oldNode.Free
+        req := podRequests(pending[i].Movement.Pod)
+        free.Cpu += req.Cpu
+        free.Memory += req.Memory
+        for j := range pending {
+            if pending[j].Movement.NewNode.Name == oldNode.Node.Name && free.fits(podRequests(pending[j].Movement.Pod)) {
+                return i
+            }
+        }
+    }
+    return -1
+}
+
+// findParkingNode returns the node with the most free cpu that can
+// temporarily host the pod.
+func findParkingNode(model capacityModel, move types.Movement, excludedNodes map[string]struct{}) *corev1.Node {
+    var best *nodeState
+    req := podRequests(move.Pod)
+    for name, node := range model {
+        if name == move.OldNode.Name || name == move.NewNode.Name {
+            continue
+        }
+        if _, ok := excludedNodes[name]; ok {
+            continue
+        }
+        if !node.Free.fits(req) || !canHostPod(node.Node, move.Pod) {
+            continue
+        }
+        if best == nil || node.Free.Cpu > best.Free.Cpu || (node.Free.Cpu == best.Free.Cpu && name < best.Node.Name) {
+            best = node
+        }
+    }
+
+    if best == nil {
+        return nil
+    }
+    return best.Node
+}
+
+func canHostPod(node *corev1.Node, pod *corev1.Pod) bool {
+    if node.Spec.Unschedulable {
+        return false
+    }
+
+    for i := range node.Spec.Taints {
+        taint := &node.Spec.Taints[i]
+        if taint.Effect != corev1.TaintEffectNoSchedule && taint.Effect != corev1.TaintEffectNoExecute {
+            continue
+        }
+        tolerated := false
+        for j := range pod.Spec.Tolerations {
+            if pod.Spec.Tolerations[j].ToleratesTaint(taint) {
+                tolerated = true
+                break
+            }
+        }
+        if !tolerated {
+            return false
+        }
+    }
+
+    for key, value := range pod.Spec.NodeSelector {
+        if node.Labels[key] != value {
+            return false
+        }
+    }
+    return true
+}
+
+// movementScheduler splits ordered steps into waves that can run in
+// parallel. A step joins a wave only when its new node has room for the pod
+// right now and no earlier step into the same node is still waiting, so
+// later steps never take space the order reserved for earlier ones.
+type movementScheduler struct {
+    model       capacityModel
+    steps       []executionStep
+    pending     []int
+    done        map[int]bool
+    failed      map[int]bool
+    maxIncoming int
+    maxOutgoing int
+}
+
+func newMovementScheduler(model capacityModel, steps []executionStep, maxIncoming int, maxOutgoing int) *movementScheduler {
+    s := &movementScheduler{
+        model:       model,
+        steps:       steps,
+        pending:     make([]int, len(steps)),
+        done:        make(map[int]bool),
+        failed:      make(map[int]bool),
+        maxIncoming: maxIncoming,
+        maxOutgoing: maxOutgoing,
+    }
+    for i := range steps {
+        s.pending[i] = i
+    }
+    return s
+}
+
+func (s *movementScheduler) HasPending() bool {
+    return len(s.pending) > 0
+}
+
+// NextWave returns the steps that can start now, keeping their order, and
+// results of the steps dropped because a step they depend on has failed.
+// If nothing fits, no running step can free space anymore, so the first
+// pending step is dropped as infeasible rather than overcommitting its node.
+func (s *movementScheduler) NextWave() ([]executionStep, []types.MovementResult) {
+    wave := make([]executionStep, 0)
+    dropped := make([]types.MovementResult, 0)
+    rest := make([]int, 0)
+    blocked := make(map[string]struct{})
+    for _, node := range s.model {
+        node.Incoming = 0
+        node.Outgoing = 0
+    }
+
+    for _, id := range s.pending {
+        step := s.steps[id]
+        if step.Prev != -1 && s.failed[step.Prev] {
+            s.failed[id] = true
+            dropped = append(dropped, types.MovementResult{Movement: step.Movement, Error: "previous step failed"})
+            continue
+        }
+
+        _, isBlocked := blocked[step.Movement.NewNode.Name]
+        if (step.Kind != deleteStep && isBlocked) || (step.Prev != -1 && !s.done[step.Prev]) || !s.canStart(step) {
+            if step.Kind != deleteStep {
+                blocked[step.Movement.NewNode.Name] = struct{}{}
+            }
+            rest = append(rest, id)
+            continue
+        }
+
+        s.start(step)
+        wave = append(wave, step)
+    }
+
+    if len(wave) == 0 && len(dropped) == 0 && len(rest) > 0 {
+        step := s.steps[rest[0]]
+        log.Info("No movement has enough space on its new node, pod ", step.Movement.Pod.Name, " will not be moved")
+        s.failed[step.Id] = true
+        dropped = append(dropped, types.MovementResult{Movement: step.Movement, Error: "not enough space on the new node"})
+        rest = rest[1:]
+    }
+
+    s.pending = rest
+    return wave, dropped
+}
+
+// Complete updates free resources after the step has finished.
+// A successful step frees space on the old node, a failed one
+// returns the space reserved on the new node.
+func (s *movementScheduler) Complete(step executionStep, result types.MovementResult) {
+    pod := step.Movement.Pod
+    if !result.Ok {
+        s.failed[step.Id] = true
+        if step.Kind != deleteStep {
+            s.model.release(step.Movement.NewNode.Name, pod)
+        }
+        // A deleted pod that failed on the new node is back on the old one.
+        if step.Kind == createStep && result.NewPod != "" {
+            s.model.take(step.Movement.OldNode.Name, pod)
+        }
+        return
+    }
+
+    s.done[step.Id] = true
+    if step.Kind != createStep {
+        s.model.release(step.Movement.OldNode.Name, pod)
+    }
+
+    if step.Kind != moveStep || result.NewPod == "" {
+        return
+    }
+    // The next leg of a parked pod moves the copy created by this step.
+    for _, id := range s.pending {
+        if s.steps[id].Prev == step.Id {
+            newPod := pod.DeepCopy()
+            newPod.Name = result.NewPod
+            newPod.Spec.NodeName = step.Movement.NewNode.Name
+            s.steps[id].Movement.Pod = newPod
+        }
+    }
+}
+
+func (s *movementScheduler) canStart(step executionStep) bool {
+    if step.Kind == deleteStep {
+        return true
+    }
+
+    if oldNode, ok := s.model[step.Movement.OldNode.Name]; ok && step.Kind == moveStep && s.maxOutgoing > 0 && oldNode.Outgoing >= s.maxOutgoing {
+        return false
+    }
+    if newNode, ok := s.model[step.Movement.NewNode.Name]; ok && s.maxIncoming > 0 && newNode.Incoming >= s.maxIncoming {
+        return false
+    }
+    return s.model.fits(step.Movement.NewNode.Name, step.Movement.Pod)
+}
+
+func (s *movementScheduler) start(step executionStep) {
+    if step.Kind == deleteStep {
+        return
+    }
+
+    if oldNode, ok := s.model[step.Movement.OldNode.Name]; ok && step.Kind == moveStep {
+        oldNode.Outgoing++
+    }
+    if newNode, ok := s.model[step.Movement.NewNode.Name]; ok {
+        newNode.Incoming++
+    }
+    s.model.take(step.Movement.NewNode.Name, step.Movement.Pod)
+}
+
+func podRequests(pod *corev1.Pod) resources {
+    req := resources{}
+    for _, container := range pod.Spec.Containers {
+        req.Cpu += container.Resources.Requests.Cpu().MilliValue()
+        req.Memory += container.Resources.Requests.Memory().Value()
+    }
+    return req
+}
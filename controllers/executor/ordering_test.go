@@ -0,0 +1,219 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "reflect"
+    "testing"
+
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testNode(name string, cpu string) corev1.Node {
+    return corev1.Node{
+        ObjectMeta: metav1.ObjectMeta{Name: name},
+        Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+            corev1.ResourceCPU:    resource.MustParse(cpu),
+            corev1.ResourceMemory: resource.MustParse("1Gi"),
+        }},
+    }
+}
+
+func testPod(name string, node string, cpu string) corev1.Pod {
+    return corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Name: name},
+        Spec: corev1.PodSpec{
+            NodeName: node,
+            Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+                Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+            }}},
+        },
+    }
+}
+
+// Two full nodes swap their pods, which is impossible without a third node
+// or deleting one pod first.
+func swapCycle(withSpareNode bool) ([]corev1.Node, [][]corev1.Pod, []types.Movement) {
+    nodes := []corev1.Node{testNode("a", "1"), testNode("b", "1")}
+    pods := [][]corev1.Pod{{testPod("p1", "a", "1")}, {testPod("p2", "b", "1")}}
+    if withSpareNode {
+        nodes = append(nodes, testNode("c", "1"))
+        pods = append(pods, []corev1.Pod{})
+    }
+    moves := []types.Movement{
+        {Pod: &pods[0][0], OldNode: &nodes[0], NewNode: &nodes[1]},
+        {Pod: &pods[1][0], OldNode: &nodes[1], NewNode: &nodes[0]},
+    }
+    return nodes, pods, moves
+}
+
+// checkCapacity replays the steps and fails if any node is overcommitted.
+func checkCapacity(t *testing.T, model capacityModel, steps []executionStep) {
+    for _, step := range steps {
+        if step.Kind != deleteStep {
+            model.take(step.Movement.NewNode.Name, step.Movement.Pod)
+        }
+        for name, node := range model {
+            if node.Free.Cpu < 0 || node.Free.Memory < 0 {
+                t.Fatalf("node %s is overcommitted after step %d", name, step.Id)
+            }
+        }
+        if step.Kind != createStep {
+            model.release(step.Movement.OldNode.Name, step.Movement.Pod)
+        }
+    }
+}
+
+func TestOrderMovementsParksPod(t *testing.T) {
+    nodes, pods, moves := swapCycle(true)
+    model := newCapacityModel(nodes, pods)
+    steps, infeasible := orderMovements(model.copy(), moves, false, nil)
+
+    if len(infeasible) != 0 {
+        t.Fatalf("expected no infeasible movements, got %d", len(infeasible))
+    }
+    if len(steps) != 3 {
+        t.Fatalf("expected 3 steps, got %d", len(steps))
+    }
+    if steps[0].Movement.NewNode.Name != "c" || steps[2].Prev != steps[0].Id {
+        t.Fatalf("expected the first pod to be parked on node c")
+    }
+    checkCapacity(t, model, steps)
+}
+
+func TestOrderMovementsDeleteBeforeCreate(t *testing.T) {
+    nodes, pods, moves := swapCycle(false)
+    model := newCapacityModel(nodes, pods)
+
+    steps, infeasible := orderMovements(model.copy(), moves, false, nil)
+    if len(steps) != 0 || len(infeasible) != 2 {
+        t.Fatalf("expected both movements to be infeasible, got %d steps", len(steps))
+    }
+
+    steps, infeasible = orderMovements(model.copy(), moves, true, nil)
+    if len(infeasible) != 0 {
+        t.Fatalf("expected no infeasible movements, got %d", len(infeasible))
+    }
+    if len(steps) != 3 || steps[0].Kind != deleteStep || steps[2].Kind != createStep {
+        t.Fatalf("expected delete, move and create steps")
+    }
+    checkCapacity(t, model, steps)
+}
+
+func TestMovementSchedulerWaitsForFreedSpace(t *testing.T) {
+    nodes, pods, moves := swapCycle(true)
+    model := newCapacityModel(nodes, pods)
+    steps, _ := orderMovements(model.copy(), moves, false, nil)
+    scheduler := newMovementScheduler(model, steps, 0, 0)
+
+    waves := 0
+    for scheduler.HasPending() {
+        wave, _ := scheduler.NextWave()
+        for _, step := range wave {
+            scheduler.Complete(step, types.MovementResult{Movement: step.Movement, NewPod: step.Movement.Pod.Name + "-new", Ok: true})
+        }
+        waves++
+    }
+
+    if waves != 3 {
+        t.Fatalf("expected 3 waves, got %d", waves)
+    }
+    if steps[2].Movement.Pod.Name != "p1-new" {
+        t.Fatalf("expected the parked copy to be moved, got %s", steps[2].Movement.Pod.Name)
+    }
+}
+
+func TestMovementSchedulerLimitsMovementsPerNode(t *testing.T) {
+    nodes := []corev1.Node{testNode("a", "4"), testNode("b", "4"), testNode("c", "4")}
+    pods := [][]corev1.Pod{
+        {testPod("p1", "a", "100m"), testPod("p2", "a", "100m"), testPod("p3", "a", "100m")},
+        {testPod("p4", "b", "100m")},
+        {},
+    }
+    moves := []types.Movement{
+        {Pod: &pods[0][0], OldNode: &nodes[0], NewNode: &nodes[2]},
+        {Pod: &pods[0][1], OldNode: &nodes[0], NewNode: &nodes[1]},
+        {Pod: &pods[0][2], OldNode: &nodes[0], NewNode: &nodes[2]},
+        {Pod: &pods[1][0], OldNode: &nodes[1], NewNode: &nodes[2]},
+    }
+    model := newCapacityModel(nodes, pods)
+    steps, _ := orderMovements(model.copy(), moves, false, nil)
+
+    waveNames := func(wave []executionStep) []string {
+        names := make([]string, len(wave))
+        for i := range wave {
+            names[i] = wave[i].Movement.Pod.Name
+        }
+        return names
+    }
+
+    tests := []struct {
+        maxIncoming int
+        maxOutgoing int
+        waves       [][]string
+    }{
+        {0, 0, [][]string{{"p1", "p2", "p3", "p4"}}},
+        {1, 0, [][]string{{"p1", "p2"}, {"p3"}, {"p4"}}},
+        {0, 1, [][]string{{"p1"}, {"p2"}, {"p3", "p4"}}},
+    }
+
+    for _, tt := range tests {
+        scheduler := newMovementScheduler(newCapacityModel(nodes, pods), steps, tt.maxIncoming, tt.maxOutgoing)
+        waves := make([][]string, 0)
+        for scheduler.HasPending() {
+            wave, _ := scheduler.NextWave()
+            for _, step := range wave {
+                scheduler.Complete(step, types.MovementResult{Movement: step.Movement, Ok: true})
+            }
+            waves = append(waves, waveNames(wave))
+        }
+        if !reflect.DeepEqual(waves, tt.waves) {
+            t.Errorf("expected waves %v with limits %d/%d, got %v", tt.waves, tt.maxIncoming, tt.maxOutgoing, waves)
+        }
+    }
+}
+
+func TestMovementSchedulerDropsStepsWithoutSpace(t *testing.T) {
+    nodes := []corev1.Node{testNode("a", "2"), testNode("b", "1"), testNode("c", "1")}
+    pods := [][]corev1.Pod{{testPod("p1", "a", "1"), testPod("p2", "a", "1")}, {testPod("p3", "b", "1")}, {}}
+    model := newCapacityModel(nodes, pods)
+    // Node b is full, e.g. because an earlier movement from it has failed.
+    steps := []executionStep{
+        {Id: 0, Kind: moveStep, Movement: types.Movement{Pod: &pods[0][0], OldNode: &nodes[0], NewNode: &nodes[1]}, Prev: -1},
+        {Id: 1, Kind: moveStep, Movement: types.Movement{Pod: &pods[0][0], OldNode: &nodes[1], NewNode: &nodes[2]}, Prev: 0},
+    }
+    scheduler := newMovementScheduler(model, steps, 0, 0)
+
+    wave, dropped := scheduler.NextWave()
+    if len(wave) != 0 || len(dropped) != 1 || dropped[0].Ok || dropped[0].Error == "" {
+        t.Fatalf("expected the step without space to be dropped, got %d steps and %d dropped", len(wave), len(dropped))
+    }
+    if node := model["b"]; node.Free.Cpu != 0 {
+        t.Errorf("expected no space to be taken on node b, got %d free", node.Free.Cpu)
+    }
+
+    wave, dropped = scheduler.NextWave()
+    if len(wave) != 0 || len(dropped) != 1 || dropped[0].Error != "previous step failed" {
+        t.Fatalf("expected the dependent step to be dropped, got %d steps and %d dropped", len(wave), len(dropped))
+    }
+    if scheduler.HasPending() {
+        t.Error("expected no pending steps")
+    }
+}
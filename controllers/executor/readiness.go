@@ -0,0 +1,126 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/fields"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/util/wait"
+    "k8s.io/apimachinery/pkg/watch"
+    clientset "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/cache"
+    watchtools "k8s.io/client-go/tools/watch"
+)
+
+const crashLoopBackOff = "CrashLoopBackOff"
+
+// waitForPodReady watches the pod until it reports the Ready condition.
+// It fails when the timeout expires, the context is cancelled, or the pod
+// is crash looping, failed or deleted.
+func waitForPodReady(ctx context.Context, cltset clientset.Interface, pod *corev1.Pod, timeout time.Duration) error {
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    lw := podListWatch(ctx, cltset, pod)
+    _, err := watchtools.UntilWithSync(ctx, lw, &corev1.Pod{}, nil, func(e watch.Event) (bool, error) {
+        if e.Type == watch.Deleted {
+            return false, fmt.Errorf("pod %s was deleted", pod.Name)
+        }
+
+        p, ok := e.Object.(*corev1.Pod)
+        if !ok {
+            return false, nil
+        }
+        if reason := podFailureReason(p); reason != "" {
+            return false, fmt.Errorf("pod %s failed: %s", pod.Name, reason)
+        }
+        return isPodReady(p), nil
+    })
+
+    if err == wait.ErrWaitTimeout {
+        if ctx.Err() == context.DeadlineExceeded {
+            return fmt.Errorf("pod %s is not ready after %v", pod.Name, timeout)
+        }
+        return fmt.Errorf("waiting for pod %s was interrupted", pod.Name)
+    }
+    return err
+}
+
+// waitForPodDeleted watches the pod until it is removed from the cluster.
+func waitForPodDeleted(ctx context.Context, cltset clientset.Interface, pod *corev1.Pod, timeout time.Duration) error {
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    lw := podListWatch(ctx, cltset, pod)
+    precondition := func(store cache.Store) (bool, error) {
+        return len(store.List()) == 0, nil
+    }
+
+    _, err := watchtools.UntilWithSync(ctx, lw, &corev1.Pod{}, precondition, func(e watch.Event) (bool, error) {
+        return e.Type == watch.Deleted, nil
+    })
+
+    if err == wait.ErrWaitTimeout {
+        if ctx.Err() == context.DeadlineExceeded {
+            return fmt.Errorf("pod %s is not deleted after %v", pod.Name, timeout)
+        }
+        return fmt.Errorf("waiting for pod %s was interrupted", pod.Name)
+    }
+    return err
+}
+
+func podListWatch(ctx context.Context, cltset clientset.Interface, pod *corev1.Pod) *cache.ListWatch {
+    fieldSelector := fields.OneTermEqualSelector("metadata.name", pod.Name).String()
+    return &cache.ListWatch{
+        ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+            options.FieldSelector = fieldSelector
+            return cltset.CoreV1().Pods(pod.Namespace).List(ctx, options)
+        },
+        WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+            options.FieldSelector = fieldSelector
+            return cltset.CoreV1().Pods(pod.Namespace).Watch(ctx, options)
+        },
+    }
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+    for _, condition := range pod.Status.Conditions {
+        if condition.Type == corev1.PodReady {
+            return condition.Status == corev1.ConditionTrue
+        }
+    }
+    return false
+}
+
+func podFailureReason(pod *corev1.Pod) string {
+    if pod.Status.Phase == corev1.PodFailed {
+        return "pod phase is Failed"
+    }
+
+    for _, status := range pod.Status.ContainerStatuses {
+        if status.State.Waiting != nil && status.State.Waiting.Reason == crashLoopBackOff {
+            return "container " + status.Name + " is in " + crashLoopBackOff
+        }
+    }
+    return ""
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes/fake"
+)
+
+func pendingPod(name string) *corev1.Pod {
+    return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+}
+
+// updateStatusLater changes the status of the pod once the watch is started.
+func updateStatusLater(cltset *fake.Clientset, pod *corev1.Pod, status corev1.PodStatus) {
+    go func() {
+        time.Sleep(20 * time.Millisecond)
+        p := pod.DeepCopy()
+        p.Status = status
+        cltset.CoreV1().Pods(p.Namespace).UpdateStatus(context.Background(), p, metav1.UpdateOptions{})
+    }()
+}
+
+func TestWaitForPodReady(t *testing.T) {
+    pod := pendingPod("p")
+    cltset := fake.NewSimpleClientset(pod)
+    updateStatusLater(cltset, pod, corev1.PodStatus{Conditions: []corev1.PodCondition{
+        {Type: corev1.PodReady, Status: corev1.ConditionTrue},
+    }})
+
+    if err := waitForPodReady(context.Background(), cltset, pod, time.Second); err != nil {
+        t.Errorf("expected pod to become ready, got %v", err)
+    }
+}
+
+func TestWaitForPodReadyFailsOnCrashLoop(t *testing.T) {
+    pod := pendingPod("p")
+    cltset := fake.NewSimpleClientset(pod)
+    updateStatusLater(cltset, pod, corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+        {Name: "app", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: crashLoopBackOff}}},
+    }})
+
+    err := waitForPodReady(context.Background(), cltset, pod, time.Second)
+    if err == nil || !strings.Contains(err.Error(), crashLoopBackOff) {
+        t.Errorf("expected crash loop to be reported, got %v", err)
+    }
+}
+
+func TestWaitForPodReadyTimeout(t *testing.T) {
+    pod := pendingPod("p")
+    cltset := fake.NewSimpleClientset(pod)
+
+    err := waitForPodReady(context.Background(), cltset, pod, 50*time.Millisecond)
+    if err == nil || !strings.Contains(err.Error(), "not ready after") {
+        t.Errorf("expected timeout, got %v", err)
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    err = waitForPodReady(ctx, cltset, pod, time.Second)
+    if err == nil || !strings.Contains(err.Error(), "interrupted") {
+        t.Errorf("expected interruption, got %v", err)
+    }
+}
+
+func TestWaitForPodReadyFailsOnDeletion(t *testing.T) {
+    pod := pendingPod("p")
+    cltset := fake.NewSimpleClientset(pod)
+    go func() {
+        time.Sleep(20 * time.Millisecond)
+        cltset.CoreV1().Pods(pod.Namespace).Delete(context.Background(), pod.Name, metav1.DeleteOptions{})
+    }()
+
+    err := waitForPodReady(context.Background(), cltset, pod, time.Second)
+    if err == nil || !strings.Contains(err.Error(), "was deleted") {
+        t.Errorf("expected deletion to be reported, got %v", err)
+    }
+}
+
+func TestPodFailureReason(t *testing.T) {
+    pod := pendingPod("p")
+    if reason := podFailureReason(pod); reason != "" {
+        t.Errorf("expected pending pod not to fail, got %q", reason)
+    }
+    pod.Status.Phase = corev1.PodFailed
+    if reason := podFailureReason(pod); reason == "" {
+        t.Error("expected failed pod to be reported")
+    }
+}
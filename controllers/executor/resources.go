@@ -0,0 +1,205 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    k8stypes "k8s.io/apimachinery/pkg/types"
+    clientset "k8s.io/client-go/kubernetes"
+)
+
+const (
+    applyPod     = "pod"
+    applyOwner   = "owner"
+    applyInPlace = "in_place"
+)
+
+// resourceApplier applies recommended requests of updated pods. Pods are
+// resized in place right away, owners are patched after the movements so
+// that their rollouts do not race with them, and the rest of the pods are
+// returned to be recreated by the executor.
+type resourceApplier struct {
+    cltset clientset.Interface
+    args   *appsv1.ResourceApplyArgs
+    owners map[types.Workload][]*corev1.Pod
+}
+
+func newResourceApplier(cltset clientset.Interface, args *appsv1.ResourceApplyArgs) *resourceApplier {
+    if args == nil {
+        args = &appsv1.ResourceApplyArgs{}
+    }
+    return &resourceApplier{cltset: cltset, args: args, owners: make(map[types.Workload][]*corev1.Pod)}
+}
+
+func (a *resourceApplier) method(namespace string) string {
+    if method, ok := a.args.Namespaces[namespace]; ok && method != "" {
+        return method
+    }
+    if a.args.Method == "" {
+        return applyPod
+    }
+    return a.args.Method
+}
+
+// Prepare resizes pods in place and remembers owners to patch. It returns
+// pods that have to be recreated.
+func (a *resourceApplier) Prepare(ctx context.Context, pods []corev1.Pod) []corev1.Pod {
+    recreate := make([]corev1.Pod, 0)
+    for i := range pods {
+        pod := &pods[i]
+        method := a.method(pod.Namespace)
+
+        if method == applyInPlace {
+            err := resizePod(ctx, a.cltset, pod)
+            if err == nil {
+                log.Info("Pod ", pod.Name, " is resized in place")
+                continue
+            }
+            log.Info("Pod ", pod.Name, " can not be resized in place: ", err)
+            method = applyOwner
+        }
+
+        if method == applyOwner {
+            owner, err := ownerOf(ctx, a.cltset, pod)
+            if err == nil {
+                a.owners[owner] = append(a.owners[owner], pod)
+                continue
+            }
+            log.Info("Pod ", pod.Name, " will be recreated: ", err)
+        }
+
+        recreate = append(recreate, *pod)
+    }
+    return recreate
+}
+
+// ApplyToOwners patches pod templates of owners with the largest requests
+// and limits recommended for their pods.
+func (a *resourceApplier) ApplyToOwners(ctx context.Context) {
+    for owner, pods := range a.owners {
+        patch, err := json.Marshal(map[string]interface{}{
+            "spec": map[string]interface{}{
+                "template": map[string]interface{}{"spec": containersPatch(pods)},
+            },
+        })
+        if err == nil {
+            err = patchWorkload(ctx, a.cltset, owner, patch)
+        }
+        if err != nil {
+            log.Info("Failed to update resources of ", owner.Kind, " ", owner.Name, ": ", err)
+            continue
+        }
+        log.Info("Resources of ", owner.Kind, " ", owner.Name, " are updated")
+    }
+}
+
+// resizePod changes requests and limits of the running pod. Clusters with in-place
+// resize accept it through the resize subresource or, in older versions,
+// through the pod itself. Others reject it as the fields are immutable.
+func resizePod(ctx context.Context, cltset clientset.Interface, pod *corev1.Pod) error {
+    patch, err := json.Marshal(map[string]interface{}{"spec": containersPatch([]*corev1.Pod{pod})})
+    if err != nil {
+        return err
+    }
+
+    pods := cltset.CoreV1().Pods(pod.Namespace)
+    _, err = pods.Patch(ctx, pod.Name, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{}, "resize")
+    if errors.IsNotFound(err) || errors.IsMethodNotSupported(err) {
+        _, err = pods.Patch(ctx, pod.Name, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{})
+    }
+    return err
+}
+
+// containersPatch sets requests and limits of every container to the
+// largest ones among the pods.
+func containersPatch(pods []*corev1.Pod) map[string]interface{} {
+    requests := make(map[string]corev1.ResourceList)
+    limits := make(map[string]corev1.ResourceList)
+    order := make([]string, 0)
+    for _, pod := range pods {
+        for _, container := range pod.Spec.Containers {
+            if _, ok := requests[container.Name]; !ok {
+                requests[container.Name] = corev1.ResourceList{}
+                limits[container.Name] = corev1.ResourceList{}
+                order = append(order, container.Name)
+            }
+            mergeLargest(requests[container.Name], container.Resources.Requests)
+            mergeLargest(limits[container.Name], container.Resources.Limits)
+        }
+    }
+
+    containers := make([]map[string]interface{}, 0, len(order))
+    for _, name := range order {
+        resources := map[string]interface{}{"requests": requests[name]}
+        if len(limits[name]) > 0 {
+            resources["limits"] = limits[name]
+        }
+        containers = append(containers, map[string]interface{}{
+            "name":      name,
+            "resources": resources,
+        })
+    }
+    return map[string]interface{}{"containers": containers}
+}
+
+func mergeLargest(dst corev1.ResourceList, src corev1.ResourceList) {
+    for name, quantity := range src {
+        if old, ok := dst[name]; !ok || quantity.Cmp(old) > 0 {
+            dst[name] = quantity
+        }
+    }
+}
+
+// ownerOf finds the Deployment, StatefulSet or DaemonSet of the pod.
+func ownerOf(ctx context.Context, cltset clientset.Interface, pod *corev1.Pod) (types.Workload, error) {
+    owner, err := types.OwnerOf(ctx, pod, func(ctx context.Context, namespace string, name string) (metav1.Object, error) {
+        return cltset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+    })
+    if err != nil {
+        return types.Workload{}, err
+    }
+
+    switch owner.Kind {
+    case "Deployment", "StatefulSet", "DaemonSet":
+        return owner, nil
+    }
+    return types.Workload{}, fmt.Errorf("owner %s %s of pod %s is not supported", owner.Kind, owner.Name, pod.Name)
+}
+
+func patchWorkload(ctx context.Context, cltset clientset.Interface, owner types.Workload, patch []byte) error {
+    var err error
+    switch owner.Kind {
+    case "Deployment":
+        _, err = cltset.AppsV1().Deployments(owner.Namespace).Patch(ctx, owner.Name, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{})
+    case "StatefulSet":
+        _, err = cltset.AppsV1().StatefulSets(owner.Namespace).Patch(ctx, owner.Name, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{})
+    case "DaemonSet":
+        _, err = cltset.AppsV1().DaemonSets(owner.Namespace).Patch(ctx, owner.Name, k8stypes.StrategicMergePatchType, patch, metav1.PatchOptions{})
+    default:
+        err = fmt.Errorf("unsupported owner kind %s", owner.Kind)
+    }
+    return err
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+    "context"
+    "testing"
+
+    planner "github.com/miha3009/planner/api/v1"
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+)
+
+func ownedPod(namespace string, name string, kind string, owner string, cpu string) corev1.Pod {
+    controller := true
+    pod := testPod(name, "a", cpu)
+    pod.Namespace = namespace
+    pod.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: owner, Controller: &controller}}
+    pod.Spec.Containers[0].Name = "main"
+    return pod
+}
+
+func TestResourceApplierPatchesOwners(t *testing.T) {
+    controller := true
+    deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"}}
+    deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: "main"}}
+    rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+        Namespace: "default", Name: "web-1",
+        OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", Controller: &controller}},
+    }}
+    cltset := fake.NewSimpleClientset(deployment, rs)
+
+    pods := []corev1.Pod{
+        ownedPod("default", "web-1-a", "ReplicaSet", "web-1", "100m"),
+        ownedPod("default", "web-1-b", "ReplicaSet", "web-1", "300m"),
+        ownedPod("default", "job-a", "Job", "job", "100m"),
+        ownedPod("batch", "web-1-c", "ReplicaSet", "web-1", "100m"),
+    }
+    pods[1].Spec.Containers[0].Resources.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("600m")}
+    a := newResourceApplier(cltset, &planner.ResourceApplyArgs{Method: applyOwner, Namespaces: map[string]string{"batch": applyPod}})
+    recreated := a.Prepare(context.Background(), pods)
+    if len(recreated) != 2 || recreated[0].Name != "job-a" || recreated[1].Name != "web-1-c" {
+        t.Fatalf("expected pods without supported owners to be recreated, got %v", recreated)
+    }
+
+    a.ApplyToOwners(context.Background())
+    updated, err := cltset.AppsV1().Deployments("default").Get(context.Background(), "web", metav1.GetOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    cpu := updated.Spec.Template.Spec.Containers[0].Resources.Requests[corev1.ResourceCPU]
+    if cpu.Cmp(resource.MustParse("300m")) != 0 {
+        t.Errorf("expected deployment to get the largest request, got %v", cpu.String())
+    }
+    limit := updated.Spec.Template.Spec.Containers[0].Resources.Limits[corev1.ResourceCPU]
+    if limit.Cmp(resource.MustParse("600m")) != 0 {
+        t.Errorf("expected deployment to get the limit, got %v", limit.String())
+    }
+}
+
+func TestResourceApplierFallsBackWithoutInPlaceResize(t *testing.T) {
+    pod := ownedPod("default", "p", "Job", "job", "200m")
+    cltset := fake.NewSimpleClientset(&pod)
+    cltset.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        gk := schema.GroupKind{Kind: "Pod"}
+        return true, nil, errors.NewInvalid(gk, pod.Name, nil)
+    })
+
+    a := newResourceApplier(cltset, &planner.ResourceApplyArgs{Method: applyInPlace})
+    if recreated := a.Prepare(context.Background(), []corev1.Pod{pod}); len(recreated) != 1 {
+        t.Errorf("expected pod to be recreated, got %v", recreated)
+    }
+}
+
+func TestResourceApplierResizesInPlace(t *testing.T) {
+    pod := ownedPod("default", "p", "Job", "job", "100m")
+    cltset := fake.NewSimpleClientset(pod.DeepCopy())
+    pod.Spec.Containers[0].Resources.Requests[corev1.ResourceCPU] = resource.MustParse("200m")
+
+    a := newResourceApplier(cltset, &planner.ResourceApplyArgs{Method: applyInPlace})
+    if recreated := a.Prepare(context.Background(), []corev1.Pod{pod}); len(recreated) != 0 {
+        t.Fatalf("expected pod to be resized, got %v", recreated)
+    }
+    resized, _ := cltset.CoreV1().Pods("default").Get(context.Background(), "p", metav1.GetOptions{})
+    if cpu := resized.Spec.Containers[0].Resources.Requests[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("200m")) != 0 {
+        t.Errorf("expected pod requests to be patched, got %v", cpu.String())
+    }
+}
@@ -19,6 +19,7 @@ package helper
 import (
     "context"
     "math"
+    "sort"
     "time"
 
     types "github.com/miha3009/planner/controllers/types"
@@ -119,3 +120,21 @@ func Variance(nums []float64) float64 {
     }
     return variance / float64(len(nums))
 }
+
+// Percentile returns the value of nums at the percentile by the nearest-rank
+// method.
+func Percentile(nums []float64, percentile float64) float64 {
+    if len(nums) == 0 {
+        return float64(0)
+    }
+
+    sorted := make([]float64, len(nums))
+    copy(sorted, nums)
+    sort.Float64s(sorted)
+
+    rank := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+    if rank < 0 {
+        rank = 0
+    }
+    return sorted[rank]
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informer
+
+import (
+    "bufio"
+    "context"
+    "regexp"
+    "strconv"
+    "strings"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+    defaultAutoscalerNamespace = "kube-system"
+    defaultAutoscalerConfigMap = "cluster-autoscaler-status"
+    autoscalerDeletionTaint    = "ToBeDeletedByClusterAutoscaler"
+)
+
+var (
+    nodeGroupNameRegexp   = regexp.MustCompile(`^\s*Name:\s*(\S+)`)
+    nodeGroupBoundsRegexp = regexp.MustCompile(`cloudProviderTarget=(\d+) \(minSize=(\d+), maxSize=(\d+)\)`)
+)
+
+// getNodeGroups reads node group bounds from the status ConfigMap
+// that cluster-autoscaler writes. The manager client reads ConfigMaps from
+// the API server, so no ConfigMap informer is started.
+func getNodeGroups(ctx context.Context, clt client.Client, args *appsv1.ClusterAutoscalerArgs) (map[string]types.NodeGroup, error) {
+    namespace := args.StatusNamespace
+    if namespace == "" {
+        namespace = defaultAutoscalerNamespace
+    }
+    name := args.StatusConfigMap
+    if name == "" {
+        name = defaultAutoscalerConfigMap
+    }
+
+    configMap := &corev1.ConfigMap{}
+    if err := clt.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, configMap); err != nil {
+        return nil, err
+    }
+    return parseAutoscalerStatus(configMap.Data["status"]), nil
+}
+
+func parseAutoscalerStatus(status string) map[string]types.NodeGroup {
+    groups := make(map[string]types.NodeGroup)
+    scanner := bufio.NewScanner(strings.NewReader(status))
+    inNodeGroups := false
+    name := ""
+    for scanner.Scan() {
+        line := scanner.Text()
+        if strings.HasPrefix(line, "NodeGroups:") {
+            inNodeGroups = true
+            continue
+        }
+        if !inNodeGroups {
+            continue
+        }
+
+        if m := nodeGroupNameRegexp.FindStringSubmatch(line); m != nil {
+            name = m[1]
+        } else if m := nodeGroupBoundsRegexp.FindStringSubmatch(line); m != nil && name != "" {
+            target, _ := strconv.Atoi(m[1])
+            minSize, _ := strconv.Atoi(m[2])
+            maxSize, _ := strconv.Atoi(m[3])
+            groups[name] = types.NodeGroup{Name: name, MinSize: minSize, MaxSize: maxSize, TargetSize: target}
+            name = ""
+        }
+    }
+    return groups
+}
+
+// withoutAutoscalerDeletions drops nodes that cluster-autoscaler is removing.
+func withoutAutoscalerDeletions(nodes []corev1.Node) []corev1.Node {
+    kept := make([]corev1.Node, 0, len(nodes))
+    for i := range nodes {
+        deleting := false
+        for _, taint := range nodes[i].Spec.Taints {
+            if taint.Key == autoscalerDeletionTaint {
+                deleting = true
+                break
+            }
+        }
+        if !deleting {
+            kept = append(kept, nodes[i])
+        }
+    }
+    return kept
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informer
+
+import "testing"
+
+const autoscalerStatus = `Cluster-autoscaler status at 2022-05-10 10:00:00.000000000 +0000 UTC:
+Cluster-wide:
+  Health:      Healthy (ready=4 unready=0 notStarted=0 longNotStarted=0 registered=4 longUnregistered=0)
+  ScaleUp:     NoActivity (ready=4 registered=4)
+  ScaleDown:   NoCandidates (candidates=0)
+
+NodeGroups:
+  Name:        workers
+  Health:      Healthy (ready=3 unready=0 notStarted=0 longNotStarted=0 registered=3 longUnregistered=0 cloudProviderTarget=3 (minSize=1, maxSize=10))
+  ScaleUp:     NoActivity (ready=3 cloudProviderTarget=3)
+  ScaleDown:   NoCandidates (candidates=0)
+
+  Name:        https://www.googleapis.com/compute/v1/projects/p/zones/z/instanceGroups/gpu
+  Health:      Healthy (ready=1 unready=0 notStarted=0 longNotStarted=0 registered=1 longUnregistered=0 cloudProviderTarget=1 (minSize=0, maxSize=2))
+`
+
+func TestParseAutoscalerStatus(t *testing.T) {
+    groups := parseAutoscalerStatus(autoscalerStatus)
+    if len(groups) != 2 {
+        t.Fatalf("expected 2 node groups, got %d", len(groups))
+    }
+
+    workers := groups["workers"]
+    if workers.MinSize != 1 || workers.MaxSize != 10 || workers.TargetSize != 3 {
+        t.Errorf("unexpected bounds of workers: %+v", workers)
+    }
+    gpu := groups["https://www.googleapis.com/compute/v1/projects/p/zones/z/instanceGroups/gpu"]
+    if gpu.MinSize != 0 || gpu.MaxSize != 2 || gpu.TargetSize != 1 {
+        t.Errorf("unexpected bounds of gpu: %+v", gpu)
+    }
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informer
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+)
+
+const (
+    defaultHistorySize = 1440
+    historyBatchSize   = 60
+    historyFilePrefix  = "metrics-"
+)
+
+// diskStore keeps metrics samples in a ring of files. Every file holds a
+// batch of samples, one JSON document per line, and samples are appended to
+// the newest file until the batch is full. Then the next file of the ring
+// is truncated, so the store holds at least the last size samples across
+// restarts.
+type diskStore struct {
+    dir   string
+    size  int
+    batch int
+    slots int
+    next  int
+    // count is the number of samples in the next slot.
+    count int
+}
+
+func newDiskStore(args *appsv1.MetricsSourceArgs) *diskStore {
+    if args == nil || args.HistoryDir == "" {
+        return nil
+    }
+    size := args.HistorySize
+    if size == 0 {
+        size = defaultHistorySize
+    }
+    batch := historyBatchSize
+    if size < batch {
+        batch = size
+    }
+    // An extra slot is being filled while the oldest ones still hold size
+    // samples.
+    slots := (size+batch-1)/batch + 1
+    return &diskStore{dir: args.HistoryDir, size: size, batch: batch, slots: slots, next: -1}
+}
+
+// Load returns the last size samples newer than since, oldest first, and
+// continues the ring at the batch of the newest one.
+func (s *diskStore) Load(since time.Time) ([]types.MetricsPackage, error) {
+    files, err := ioutil.ReadDir(s.dir)
+    if os.IsNotExist(err) {
+        s.next, s.count = 0, 0
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    packs := make([]types.MetricsPackage, 0, s.size)
+    s.next, s.count = 0, 0
+    newest := time.Time{}
+    broken := make(map[int]bool)
+    var loadErr error
+    for _, file := range files {
+        slot, ok := s.slot(file.Name())
+        if !ok {
+            continue
+        }
+        batch, err := readBatch(filepath.Join(s.dir, file.Name()))
+        if err != nil {
+            loadErr = err
+            broken[slot] = true
+        }
+        for i := range batch {
+            if batch[i].Timestamp.After(newest) {
+                newest = batch[i].Timestamp
+                s.next, s.count = slot, len(batch)
+            }
+        }
+        packs = append(packs, batch...)
+    }
+    // Samples are not appended after a partial line.
+    if s.count >= s.batch || broken[s.next] {
+        s.next, s.count = (s.next+1)%s.slots, 0
+    }
+
+    kept := make([]types.MetricsPackage, 0, len(packs))
+    for i := range packs {
+        if packs[i].Timestamp.After(since) {
+            kept = append(kept, packs[i])
+        }
+    }
+    sort.Slice(kept, func(i, j int) bool { return kept[i].Timestamp.Before(kept[j].Timestamp) })
+    if len(kept) > s.size {
+        kept = kept[len(kept)-s.size:]
+    }
+    return kept, loadErr
+}
+
+// Save appends the sample to the batch of the next slot. A crash may leave
+// a partial line, which Load skips.
+func (s *diskStore) Save(p types.MetricsPackage) error {
+    if s.next < 0 {
+        if _, err := s.Load(time.Time{}); err != nil {
+            return err
+        }
+    }
+    if err := os.MkdirAll(s.dir, 0755); err != nil {
+        return err
+    }
+
+    data, err := json.Marshal(p)
+    if err != nil {
+        return err
+    }
+    flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+    if s.count == 0 {
+        flags |= os.O_TRUNC
+    }
+    name := filepath.Join(s.dir, fmt.Sprintf("%s%06d.json", historyFilePrefix, s.next))
+    file, err := os.OpenFile(name, flags, 0644)
+    if err != nil {
+        return err
+    }
+    _, err = file.Write(append(data, '\n'))
+    if closeErr := file.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        return err
+    }
+
+    s.count++
+    if s.count == s.batch {
+        s.next, s.count = (s.next+1)%s.slots, 0
+    }
+    return nil
+}
+
+// slot parses the slot of a history file. Files of slots beyond the ring,
+// left by a larger one, are ignored.
+func (s *diskStore) slot(name string) (int, bool) {
+    if !strings.HasPrefix(name, historyFilePrefix) || !strings.HasSuffix(name, ".json") {
+        return 0, false
+    }
+    slot, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, historyFilePrefix), ".json"))
+    if err != nil || slot < 0 || slot >= s.slots {
+        return 0, false
+    }
+    return slot, true
+}
+
+// readBatch reads samples of a history file. Lines that can not be parsed
+// are skipped and reported by the error.
+func readBatch(path string) ([]types.MetricsPackage, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    packs := make([]types.MetricsPackage, 0)
+    var readErr error
+    for _, line := range bytes.Split(data, []byte("\n")) {
+        if len(bytes.TrimSpace(line)) == 0 {
+            continue
+        }
+        p := types.MetricsPackage{}
+        if err := json.Unmarshal(line, &p); err != nil {
+            readErr = fmt.Errorf("%s: %v", path, err)
+            continue
+        }
+        packs = append(packs, p)
+    }
+    return packs, readErr
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informer
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+)
+
+func TestDiskStoreRing(t *testing.T) {
+    dir, err := ioutil.TempDir("", "history")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    args := &appsv1.MetricsSourceArgs{HistoryDir: dir, HistorySize: 3}
+    start := time.Unix(1600000000, 0)
+    store := newDiskStore(args)
+    for i := 0; i < 5; i++ {
+        if err := store.Save(types.MetricsPackage{Timestamp: start.Add(time.Duration(i) * time.Minute)}); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // A new store reads what the old one left and continues the ring.
+    store = newDiskStore(args)
+    packs, err := store.Load(time.Time{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(packs) != 3 {
+        t.Fatalf("expected 3 samples, got %d", len(packs))
+    }
+    for i := range packs {
+        if expected := start.Add(time.Duration(i+2) * time.Minute); !packs[i].Timestamp.Equal(expected) {
+            t.Errorf("sample %d: expected %v, got %v", i, expected, packs[i].Timestamp)
+        }
+    }
+
+    if err := store.Save(types.MetricsPackage{Timestamp: start.Add(5 * time.Minute)}); err != nil {
+        t.Fatal(err)
+    }
+    packs, _ = store.Load(start.Add(3 * time.Minute))
+    if len(packs) != 2 || !packs[1].Timestamp.Equal(start.Add(5*time.Minute)) {
+        t.Errorf("unexpected samples after restart: %+v", packs)
+    }
+}
+
+func TestDiskStoreDisabled(t *testing.T) {
+    if newDiskStore(nil) != nil || newDiskStore(&appsv1.MetricsSourceArgs{}) != nil {
+        t.Error("expected no store without a history directory")
+    }
+}
+
+func TestDiskStoreBatchesSamples(t *testing.T) {
+    dir, err := ioutil.TempDir("", "history")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    args := &appsv1.MetricsSourceArgs{HistoryDir: dir, HistorySize: 2 * historyBatchSize}
+    start := time.Unix(1600000000, 0)
+    store := newDiskStore(args)
+    for i := 0; i < 2*historyBatchSize+10; i++ {
+        if err := store.Save(types.MetricsPackage{Timestamp: start.Add(time.Duration(i) * time.Minute)}); err != nil {
+            t.Fatal(err)
+        }
+    }
+    files, _ := ioutil.ReadDir(dir)
+    if len(files) != 3 {
+        t.Errorf("expected samples to be batched in 3 files, got %d", len(files))
+    }
+
+    // A partial line left by a crash is skipped.
+    file, err := os.OpenFile(filepath.Join(dir, files[2].Name()), os.O_WRONLY|os.O_APPEND, 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    file.WriteString(`{"Timestamp":`)
+    file.Close()
+
+    store = newDiskStore(args)
+    packs, err := store.Load(time.Time{})
+    if err == nil {
+        t.Errorf("expected the partial line to be reported")
+    }
+    last := start.Add(time.Duration(2*historyBatchSize+9) * time.Minute)
+    if len(packs) != 2*historyBatchSize || !packs[len(packs)-1].Timestamp.Equal(last) {
+        t.Errorf("expected the last %d samples, got %d", 2*historyBatchSize, len(packs))
+    }
+
+    if err := store.Save(types.MetricsPackage{Timestamp: last.Add(time.Minute)}); err != nil {
+        t.Fatal(err)
+    }
+    if packs, _ = store.Load(time.Time{}); !packs[len(packs)-1].Timestamp.Equal(last.Add(time.Minute)) {
+        t.Errorf("expected a sample saved after the partial line to be loaded")
+    }
+}
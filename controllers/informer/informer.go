@@ -41,16 +41,28 @@ type Informer interface {
     UpdatePlanner(ctx context.Context, clt client.Client, planner *appsv1.Planner)
 }
 
+const defaultMetricsMaxAge = time.Hour
+
 type DefaultInformer struct{}
 
 func (inf *DefaultInformer) GetInfo(ctx context.Context, events chan types.Event, cache *types.PlannerCache, clt client.Client, planner appsv1.PlannerSpec) {
-    nodes, err := getNodes(clt, ctx)
+    nodes, err := getNodes(&planner, clt, ctx)
     if err != nil {
         log.Error(err, ". Failed to get nodes")
         events <- types.PhaseEndedWithError
         return
     }
 
+    if args := planner.Execution; args != nil && args.NodeDriver == "cluster_autoscaler" && args.ClusterAutoscaler != nil {
+        nodes = withoutAutoscalerDeletions(nodes)
+        groups, err := getNodeGroups(ctx, clt, args.ClusterAutoscaler)
+        if err != nil {
+            log.Info(err, ". Failed to get cluster-autoscaler node groups, nodes will not be deleted")
+        } else {
+            cache.NodeGroups = groups
+        }
+    }
+
     pods, err := getPods(&planner, nodes, clt, ctx)
     if err != nil {
         log.Error(err, ". Failed to get pods")
@@ -60,6 +72,7 @@ func (inf *DefaultInformer) GetInfo(ctx context.Context, events chan types.Event
 
     cache.Nodes = nodes
     cache.Pods = pods
+    setOwners(cache.Metrics, pods)
 
     events <- types.InformingEnded
 }
@@ -70,33 +83,34 @@ func (inf *DefaultInformer) RunMetircsListener(ctx context.Context, cache *types
     }
 
     period := time.Second * time.Duration(planner.MeticsFetchPeriod)
+    maxAge := time.Second * time.Duration(planner.MetrcisMaxAge)
+    if planner.MetrcisMaxAge == 0 {
+        maxAge = defaultMetricsMaxAge
+    }
+    source := newMetricsSource(planner.MetricsSource, mclt)
+    store := newDiskStore(planner.MetricsSource)
+    namespaces := metricsNamespaces(&planner)
+    loadHistory(ctx, cache.Metrics, store, source, namespaces, maxAge, period)
+
     for {
         if helper.ContextEnded(ctx) {
             break
         }
 
-        nodeMetrics, err := getNodeMetrics(mclt, ctx)
-        if err != nil {
-            log.Warn(err, ". Failed to get node metrics")
-            helper.SleepWithContext(ctx, period)
-            continue
-        }
-
-        podMetrics, err := getPodMetrics(&planner, mclt, ctx)
+        p, err := source.Fetch(ctx, namespaces)
         if err != nil {
-            log.Warn(err, ". Failed to get pod metrics")
+            log.Warn(err, ". Failed to get metrics")
             helper.SleepWithContext(ctx, period)
             continue
         }
 
-        p := types.MetricsPackage{
-            NodeMetrics: nodeMetrics,
-            PodMetrics:  podMetrics,
-            Timestamp:   time.Now(),
-        }
-
         cache.Metrics.Push(p)
         cache.Metrics.Shrink()
+        if store != nil {
+            if err := store.Save(p); err != nil {
+                log.Warn(err, ". Failed to save metrics")
+            }
+        }
 
         helper.SleepWithContext(ctx, period)
     }
@@ -120,38 +134,49 @@ func (inf *DefaultInformer) UpdatePlanner(ctx context.Context, clt client.Client
     }
 }
 
-func getNodes(clt client.Client, ctx context.Context) ([]corev1.Node, error) {
+// getNodes lists nodes of the scope. Pods of other nodes are not listed
+// either, so the planner never touches them.
+func getNodes(planner *appsv1.PlannerSpec, clt client.Client, ctx context.Context) ([]corev1.Node, error) {
+    scope, err := newNodeScope(planner)
+    if err != nil {
+        return nil, err
+    }
+
     nodeList := &corev1.NodeList{}
     if err := clt.List(ctx, nodeList); err != nil {
         return nil, err
     }
 
-    return nodeList.Items, nil
+    return scope.Filter(nodeList.Items), nil
 }
 
+// getPods lists pods of the scope once and groups them by node. Pods of
+// other nodes are skipped.
 func getPods(planner *appsv1.PlannerSpec, nodes []corev1.Node, clt client.Client, ctx context.Context) ([][]corev1.Pod, error) {
     pods := make([][]corev1.Pod, len(nodes))
+    index := make(map[string]int, len(nodes))
 
     for i := range nodes {
         pods[i] = make([]corev1.Pod, 0)
+        index[nodes[i].Name] = i
     }
 
-    for _, namespace := range planner.Namespaces {
-        for i, node := range nodes {
-            podList := &corev1.PodList{}
+    scope, err := newPodScope(ctx, clt, planner)
+    if err != nil {
+        return nil, err
+    }
 
-            opts := []client.ListOption{
-                client.MatchingFields{"spec.nodeName": node.Name},
-                client.InNamespace(namespace),
-            }
+    podList := &corev1.PodList{}
+    if err := clt.List(ctx, podList, scope.listOptions()...); err != nil {
+        return nil, err
+    }
 
-            if err := clt.List(ctx, podList, opts...); err != nil {
-                return nil, err
-            }
-            for _, pod := range podList.Items {
-                pods[i] = append(pods[i], pod)
-            }
+    for _, pod := range podList.Items {
+        i, ok := index[pod.Spec.NodeName]
+        if !ok || !scope.Contains(&pod) {
+            continue
         }
+        pods[i] = append(pods[i], pod)
     }
 
     return pods, nil
@@ -171,13 +196,16 @@ func getNodeMetrics(mclt *metricsv.Clientset, ctx context.Context) (map[string]m
     return res, nil
 }
 
-func getPodMetrics(planner *appsv1.PlannerSpec, mclt *metricsv.Clientset, ctx context.Context) (map[string]metrics.PodMetrics, error) {
+func getPodMetrics(namespaces []string, mclt *metricsv.Clientset, ctx context.Context) (map[string]metrics.PodMetrics, error) {
     res := make(map[string]metrics.PodMetrics)
+    if len(namespaces) == 0 {
+        namespaces = []string{metav1.NamespaceAll}
+    }
 
-    for _, namespace := range planner.Namespaces {
+    for _, namespace := range namespaces {
         if m, err := mclt.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{}); err == nil {
             for j := range m.Items {
-                res[m.Items[j].Name] = m.Items[j]
+                res[types.PodKey(m.Items[j].Namespace, m.Items[j].Name)] = m.Items[j]
             }
         } else {
             return res, err
@@ -186,3 +214,15 @@ func getPodMetrics(planner *appsv1.PlannerSpec, mclt *metricsv.Clientset, ctx co
 
     return res, nil
 }
+
+// setOwners attributes pods to their workloads, so that metrics of pods
+// that are gone still count for the workload.
+func setOwners(q types.MetricsQueue, pods [][]corev1.Pod) {
+    for i := range pods {
+        for j := range pods[i] {
+            if workload := types.WorkloadKey(&pods[i][j]); workload != "" {
+                q.SetOwner(types.PodKey(pods[i][j].Namespace, pods[i][j].Name), workload)
+            }
+        }
+    }
+}
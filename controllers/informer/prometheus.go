@@ -0,0 +1,331 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informer
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "math"
+    "net/http"
+    "net/url"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    resource "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    metrics "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+const (
+    defaultRateWindow = "5m"
+    prometheusTimeout = time.Second * 30
+    defaultRangeStep  = time.Minute
+    // Prometheus rejects range queries of more points per series.
+    maxRangePoints = 11000
+
+    podCpuQuery        = `sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{container!="",container!="POD"%s}[%s]))`
+    podMemoryQuery     = `sum by (namespace, pod, container) (container_memory_working_set_bytes{container!="",container!="POD"%s})`
+    podThrottlingQuery = `sum by (namespace, pod, container) (rate(container_cpu_cfs_throttled_periods_total{container!=""%[1]s}[%[2]s])) / sum by (namespace, pod, container) (rate(container_cpu_cfs_periods_total{container!=""%[1]s}[%[2]s]))`
+    nodeCpuQuery       = `sum by (node) (rate(container_cpu_usage_seconds_total{id="/"}[%s]))`
+    nodeMemoryQuery    = `sum by (node) (container_memory_working_set_bytes{id="/"})`
+)
+
+// PrometheusSource reads cAdvisor metrics through the Prometheus HTTP API.
+type PrometheusSource struct {
+    URL        string
+    RateWindow string
+    Client     *http.Client
+}
+
+func NewPrometheusSource(url string, rateWindow string) *PrometheusSource {
+    if rateWindow == "" {
+        rateWindow = defaultRateWindow
+    }
+    return &PrometheusSource{
+        URL:        strings.TrimSuffix(url, "/"),
+        RateWindow: rateWindow,
+        Client:     &http.Client{Timeout: prometheusTimeout},
+    }
+}
+
+type promSample struct {
+    Labels map[string]string
+    Time   time.Time
+    Value  float64
+}
+
+type promResponse struct {
+    Status string `json:"status"`
+    Error  string `json:"error"`
+    Data   struct {
+        Result []struct {
+            Metric map[string]string `json:"metric"`
+            Value  []interface{}     `json:"value"`
+            Values [][]interface{}   `json:"values"`
+        } `json:"result"`
+    } `json:"data"`
+}
+
+func (s *PrometheusSource) Fetch(ctx context.Context, namespaces []string) (types.MetricsPackage, error) {
+    now := time.Now()
+    params := url.Values{"time": {formatPromTime(now)}}
+    packs, err := s.collect(ctx, "/api/v1/query", params, namespaces)
+    if err != nil {
+        return types.MetricsPackage{}, err
+    }
+    if len(packs) == 0 {
+        return newPackage(now), nil
+    }
+    packs[0].Timestamp = now
+    return packs[0], nil
+}
+
+func (s *PrometheusSource) FetchRange(ctx context.Context, namespaces []string, start time.Time, end time.Time, step time.Duration) ([]types.MetricsPackage, error) {
+    params := url.Values{
+        "start": {formatPromTime(start)},
+        "end":   {formatPromTime(end)},
+        "step":  {strconv.FormatFloat(rangeStep(start, end, step).Seconds(), 'f', -1, 64)},
+    }
+    return s.collect(ctx, "/api/v1/query_range", params, namespaces)
+}
+
+// rangeStep replaces a zero step with the default one and makes it long
+// enough for Prometheus to accept the range.
+func rangeStep(start time.Time, end time.Time, step time.Duration) time.Duration {
+    if step <= 0 {
+        step = defaultRangeStep
+    }
+    if min := end.Sub(start) / maxRangePoints; step < min {
+        step = min
+    }
+    return step
+}
+
+// collect runs every query and merges the samples into packages by time.
+func (s *PrometheusSource) collect(ctx context.Context, path string, params url.Values, namespaces []string) ([]types.MetricsPackage, error) {
+    selector := namespaceSelector(namespaces)
+    b := newPackBuilder()
+
+    queries := []struct {
+        query string
+        add   func([]promSample)
+    }{
+        {fmt.Sprintf(podCpuQuery, selector, s.RateWindow), b.podUsage(corev1.ResourceCPU)},
+        {fmt.Sprintf(podMemoryQuery, selector), b.podUsage(corev1.ResourceMemory)},
+        {fmt.Sprintf(podThrottlingQuery, selector, s.RateWindow), b.throttling},
+        {fmt.Sprintf(nodeCpuQuery, s.RateWindow), b.nodeUsage(corev1.ResourceCPU)},
+        {nodeMemoryQuery, b.nodeUsage(corev1.ResourceMemory)},
+    }
+    for _, q := range queries {
+        samples, err := s.query(ctx, path, q.query, params)
+        if err != nil {
+            return nil, err
+        }
+        q.add(samples)
+    }
+    return b.packages(), nil
+}
+
+func (s *PrometheusSource) query(ctx context.Context, path string, query string, params url.Values) ([]promSample, error) {
+    values := url.Values{"query": {query}}
+    for key, value := range params {
+        values[key] = value
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+path+"?"+values.Encode(), nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := s.Client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    body := promResponse{}
+    if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+        return nil, fmt.Errorf("prometheus returned %s: %v", resp.Status, err)
+    }
+    if body.Status != "success" {
+        return nil, fmt.Errorf("prometheus query failed: %s", body.Error)
+    }
+
+    samples := make([]promSample, 0, len(body.Data.Result))
+    for _, r := range body.Data.Result {
+        pairs := r.Values
+        if r.Value != nil {
+            pairs = append(pairs, r.Value)
+        }
+        for _, pair := range pairs {
+            t, value, err := parsePromPair(pair)
+            if err != nil {
+                return nil, err
+            }
+            samples = append(samples, promSample{Labels: r.Metric, Time: t, Value: value})
+        }
+    }
+    return samples, nil
+}
+
+func parsePromPair(pair []interface{}) (time.Time, float64, error) {
+    if len(pair) != 2 {
+        return time.Time{}, 0, fmt.Errorf("unexpected prometheus sample %v", pair)
+    }
+    ts, ok := pair[0].(float64)
+    str, ok2 := pair[1].(string)
+    if !ok || !ok2 {
+        return time.Time{}, 0, fmt.Errorf("unexpected prometheus sample %v", pair)
+    }
+    value, err := strconv.ParseFloat(str, 64)
+    if err != nil {
+        return time.Time{}, 0, err
+    }
+    sec, frac := math.Modf(ts)
+    return time.Unix(int64(sec), int64(frac*1e9)), value, nil
+}
+
+func formatPromTime(t time.Time) string {
+    return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+func namespaceSelector(namespaces []string) string {
+    if len(namespaces) == 0 {
+        return ""
+    }
+    quoted := make([]string, len(namespaces))
+    for i := range namespaces {
+        quoted[i] = regexp.QuoteMeta(namespaces[i])
+    }
+    return fmt.Sprintf(`,namespace=~"%s"`, strings.Join(quoted, "|"))
+}
+
+func newPackage(t time.Time) types.MetricsPackage {
+    return types.MetricsPackage{
+        NodeMetrics:   make(map[string]metrics.NodeMetrics),
+        PodMetrics:    make(map[string]metrics.PodMetrics),
+        CpuThrottling: make(map[string]map[string]float64),
+        Timestamp:     t,
+    }
+}
+
+// packBuilder groups samples of several queries into packages by time.
+type packBuilder struct {
+    packs map[int64]*types.MetricsPackage
+}
+
+func newPackBuilder() *packBuilder {
+    return &packBuilder{packs: make(map[int64]*types.MetricsPackage)}
+}
+
+func (b *packBuilder) pack(t time.Time) *types.MetricsPackage {
+    key := t.UnixNano() / int64(time.Millisecond)
+    p, ok := b.packs[key]
+    if !ok {
+        pack := newPackage(t)
+        p = &pack
+        b.packs[key] = p
+    }
+    return p
+}
+
+func (b *packBuilder) podUsage(name corev1.ResourceName) func([]promSample) {
+    return func(samples []promSample) {
+        for _, sample := range samples {
+            p := b.pack(sample.Time)
+            key := types.PodKey(sample.Labels["namespace"], sample.Labels["pod"])
+            podMetrics, ok := p.PodMetrics[key]
+            if !ok {
+                podMetrics = metrics.PodMetrics{
+                    ObjectMeta: metav1.ObjectMeta{Namespace: sample.Labels["namespace"], Name: sample.Labels["pod"]},
+                    Timestamp:  metav1.NewTime(sample.Time),
+                }
+            }
+            podMetrics.Containers = setContainerUsage(podMetrics.Containers, sample.Labels["container"], name, sample.Value)
+            p.PodMetrics[key] = podMetrics
+        }
+    }
+}
+
+func (b *packBuilder) throttling(samples []promSample) {
+    for _, sample := range samples {
+        if math.IsNaN(sample.Value) {
+            continue
+        }
+        p := b.pack(sample.Time)
+        key := types.PodKey(sample.Labels["namespace"], sample.Labels["pod"])
+        if p.CpuThrottling[key] == nil {
+            p.CpuThrottling[key] = make(map[string]float64)
+        }
+        p.CpuThrottling[key][sample.Labels["container"]] = sample.Value
+    }
+}
+
+func (b *packBuilder) nodeUsage(name corev1.ResourceName) func([]promSample) {
+    return func(samples []promSample) {
+        for _, sample := range samples {
+            p := b.pack(sample.Time)
+            node := sample.Labels["node"]
+            nodeMetrics, ok := p.NodeMetrics[node]
+            if !ok {
+                nodeMetrics = metrics.NodeMetrics{
+                    ObjectMeta: metav1.ObjectMeta{Name: node},
+                    Timestamp:  metav1.NewTime(sample.Time),
+                    Usage:      corev1.ResourceList{},
+                }
+            }
+            nodeMetrics.Usage[name] = usageQuantity(name, sample.Value)
+            p.NodeMetrics[node] = nodeMetrics
+        }
+    }
+}
+
+func (b *packBuilder) packages() []types.MetricsPackage {
+    packs := make([]types.MetricsPackage, 0, len(b.packs))
+    for _, p := range b.packs {
+        packs = append(packs, *p)
+    }
+    sort.Slice(packs, func(i, j int) bool { return packs[i].Timestamp.Before(packs[j].Timestamp) })
+    return packs
+}
+
+func setContainerUsage(containers []metrics.ContainerMetrics, container string, name corev1.ResourceName, value float64) []metrics.ContainerMetrics {
+    for i := range containers {
+        if containers[i].Name == container {
+            containers[i].Usage[name] = usageQuantity(name, value)
+            return containers
+        }
+    }
+    containers = append(containers, metrics.ContainerMetrics{
+        Name:  container,
+        Usage: corev1.ResourceList{name: usageQuantity(name, value)},
+    })
+    sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+    return containers
+}
+
+// usageQuantity converts cores and bytes to quantities.
+func usageQuantity(name corev1.ResourceName, value float64) resource.Quantity {
+    if name == corev1.ResourceCPU {
+        return *resource.NewMilliQuantity(int64(math.Round(value*1000)), resource.DecimalSI)
+    }
+    return *resource.NewQuantity(int64(math.Round(value)), resource.BinarySI)
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informer
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// fakePrometheus answers a query with the result stored under the first
+// selector it contains, or with an empty result.
+func fakePrometheus(results map[string]string) *httptest.Server {
+    selectors := []string{
+        "container_cpu_usage_seconds_total{id",
+        "container_memory_working_set_bytes{id",
+        "container_cpu_cfs_throttled_periods_total{",
+        "container_cpu_usage_seconds_total{",
+        "container_memory_working_set_bytes{",
+    }
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        query := r.URL.Query().Get("query")
+        resultType := "vector"
+        if r.URL.Path == "/api/v1/query_range" {
+            resultType = "matrix"
+        }
+        result := "[]"
+        for _, selector := range selectors {
+            if strings.Contains(query, selector) {
+                if r, ok := results[selector]; ok {
+                    result = r
+                }
+                break
+            }
+        }
+        fmt.Fprintf(w, `{"status":"success","data":{"resultType":"%s","result":%s}}`, resultType, result)
+    }))
+}
+
+func TestPrometheusFetch(t *testing.T) {
+    server := fakePrometheus(map[string]string{
+        "container_cpu_usage_seconds_total{":         `[{"metric":{"namespace":"default","pod":"web","container":"app"},"value":[1600000000,"0.25"]}]`,
+        "container_memory_working_set_bytes{":        `[{"metric":{"namespace":"default","pod":"web","container":"app"},"value":[1600000000,"1048576"]}]`,
+        "container_cpu_cfs_throttled_periods_total{": `[{"metric":{"namespace":"default","pod":"web","container":"app"},"value":[1600000000,"0.5"]}]`,
+        "container_cpu_usage_seconds_total{id":       `[{"metric":{"node":"node-1"},"value":[1600000000,"1.5"]}]`,
+        "container_memory_working_set_bytes{id":      `[{"metric":{"node":"node-1"},"value":[1600000000,"2147483648"]}]`,
+    })
+    defer server.Close()
+
+    p, err := NewPrometheusSource(server.URL, "").Fetch(context.Background(), []string{"default"})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    pod, ok := p.PodMetrics["default/web"]
+    if !ok || len(pod.Containers) != 1 {
+        t.Fatalf("unexpected pod metrics: %+v", p.PodMetrics)
+    }
+    usage := pod.Containers[0].Usage
+    if usage.Cpu().MilliValue() != 250 || usage.Memory().Value() != 1048576 {
+        t.Errorf("unexpected container usage: %v", usage)
+    }
+    if p.CpuThrottling["default/web"]["app"] != 0.5 {
+        t.Errorf("expected throttling 0.5, got %v", p.CpuThrottling["default/web"]["app"])
+    }
+    node := p.NodeMetrics["node-1"].Usage
+    if node.Cpu().MilliValue() != 1500 || node.Memory().Value() != 2147483648 {
+        t.Errorf("unexpected node usage: %v", node)
+    }
+}
+
+func TestPrometheusFetchRange(t *testing.T) {
+    server := fakePrometheus(map[string]string{
+        "container_cpu_usage_seconds_total{": `[{"metric":{"namespace":"default","pod":"web","container":"app"},"values":[[1600000060,"0.2"],[1600000000,"0.1"]]}]`,
+    })
+    defer server.Close()
+
+    end := time.Unix(1600000060, 0)
+    packs, err := NewPrometheusSource(server.URL, "1m").FetchRange(context.Background(), []string{"default"}, end.Add(-time.Minute), end, time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(packs) != 2 {
+        t.Fatalf("expected 2 packages, got %d", len(packs))
+    }
+    if !packs[0].Timestamp.Before(packs[1].Timestamp) {
+        t.Errorf("packages are not ordered by time")
+    }
+    if cpu := packs[1].PodMetrics["default/web"].Containers[0].Usage.Cpu().MilliValue(); cpu != 200 {
+        t.Errorf("expected 200m at the last sample, got %dm", cpu)
+    }
+}
+
+func TestRangeStep(t *testing.T) {
+    end := time.Unix(1600000000, 0)
+    cases := []struct {
+        span     time.Duration
+        step     time.Duration
+        expected time.Duration
+    }{
+        {time.Hour, 0, defaultRangeStep},
+        {time.Hour, time.Second * 15, time.Second * 15},
+        {time.Hour * 24 * 7, time.Second, time.Hour * 24 * 7 / maxRangePoints},
+    }
+    for _, c := range cases {
+        if step := rangeStep(end.Add(-c.span), end, c.step); step != c.expected {
+            t.Errorf("span %v, step %v: expected %v, got %v", c.span, c.step, c.expected, step)
+        }
+    }
+}
+
+func TestPrometheusError(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusBadRequest)
+        fmt.Fprint(w, `{"status":"error","error":"bad query"}`)
+    }))
+    defer server.Close()
+
+    if _, err := NewPrometheusSource(server.URL, "").Fetch(context.Background(), nil); err == nil {
+        t.Error("expected an error")
+    }
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informer
+
+import (
+    "context"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podScope tells which pods are planned.
+type podScope struct {
+    all        bool
+    namespaces map[string]bool
+    excluded   map[string]bool
+    pods       labels.Selector
+}
+
+// newPodScope resolves the scope of the spec. Without it only pods of the
+// namespaces list are planned.
+func newPodScope(ctx context.Context, clt client.Client, planner *appsv1.PlannerSpec) (*podScope, error) {
+    s := &podScope{
+        namespaces: make(map[string]bool),
+        excluded:   make(map[string]bool),
+        pods:       labels.Everything(),
+    }
+    for _, namespace := range planner.Namespaces {
+        s.namespaces[namespace] = true
+    }
+
+    scope := planner.Scope
+    if scope == nil {
+        return s, nil
+    }
+
+    for _, namespace := range scope.ExcludedNamespaces {
+        s.excluded[namespace] = true
+    }
+
+    if scope.PodSelector != nil {
+        selector, err := metav1.LabelSelectorAsSelector(scope.PodSelector)
+        if err != nil {
+            return nil, err
+        }
+        s.pods = selector
+    }
+
+    if scope.NamespaceSelector == nil {
+        s.all = len(planner.Namespaces) == 0
+        return s, nil
+    }
+
+    selector, err := metav1.LabelSelectorAsSelector(scope.NamespaceSelector)
+    if err != nil {
+        return nil, err
+    }
+    namespaceList := &corev1.NamespaceList{}
+    if err := clt.List(ctx, namespaceList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+        return nil, err
+    }
+    for _, namespace := range namespaceList.Items {
+        s.namespaces[namespace.Name] = true
+    }
+
+    return s, nil
+}
+
+func (s *podScope) Contains(pod *corev1.Pod) bool {
+    if s.excluded[pod.Namespace] {
+        return false
+    }
+    return (s.all || s.namespaces[pod.Namespace]) && s.pods.Matches(labels.Set(pod.Labels))
+}
+
+// listOptions narrows the pod List as far as a single request allows.
+func (s *podScope) listOptions() []client.ListOption {
+    opts := []client.ListOption{client.MatchingLabelsSelector{Selector: s.pods}}
+    if !s.all && len(s.namespaces) == 1 {
+        for namespace := range s.namespaces {
+            opts = append(opts, client.InNamespace(namespace))
+        }
+    }
+    return opts
+}
+
+// newNodeScope returns nil, i.e. all nodes, if the spec has no scope.
+func newNodeScope(planner *appsv1.PlannerSpec) (*types.NodeScope, error) {
+    if planner.Scope == nil {
+        return nil, nil
+    }
+    return types.NewNodeScope(planner.Scope.NodeSelector, planner.Scope.ExcludedNodes)
+}
+
+// metricsNamespaces returns the namespaces to fetch pod metrics from. Empty
+// means all namespaces, as selected namespaces are known only on informing.
+func metricsNamespaces(planner *appsv1.PlannerSpec) []string {
+    scope := planner.Scope
+    if scope == nil {
+        return planner.Namespaces
+    }
+    if scope.NamespaceSelector != nil || len(planner.Namespaces) == 0 {
+        return nil
+    }
+
+    excluded := make(map[string]bool)
+    for _, namespace := range scope.ExcludedNamespaces {
+        excluded[namespace] = true
+    }
+    namespaces := make([]string, 0, len(planner.Namespaces))
+    for _, namespace := range planner.Namespaces {
+        if !excluded[namespace] {
+            namespaces = append(namespaces, namespace)
+        }
+    }
+    return namespaces
+}
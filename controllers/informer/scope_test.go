@@ -0,0 +1,169 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informer
+
+import (
+    "context"
+    "reflect"
+    "testing"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes/scheme"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+    return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func scopedPod(namespace string, name string, node string, labels map[string]string) *corev1.Pod {
+    return &corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+        Spec:       corev1.PodSpec{NodeName: node},
+    }
+}
+
+func podNames(pods []corev1.Pod) []string {
+    names := make([]string, 0, len(pods))
+    for i := range pods {
+        names = append(names, pods[i].Namespace+"/"+pods[i].Name)
+    }
+    return names
+}
+
+func TestGetPodsScope(t *testing.T) {
+    clt := fake.NewFakeClientWithScheme(scheme.Scheme,
+        namespace("default", nil),
+        namespace("team-a", map[string]string{"planned": "yes"}),
+        namespace("team-b", map[string]string{"planned": "yes"}),
+        namespace("kube-system", nil),
+        scopedPod("default", "web", "a", map[string]string{"app": "web"}),
+        scopedPod("team-a", "api", "b", map[string]string{"app": "api"}),
+        scopedPod("team-b", "db", "a", map[string]string{"app": "db", "tier": "critical"}),
+        scopedPod("kube-system", "dns", "b", nil),
+        scopedPod("team-a", "pending", "", nil),
+        scopedPod("team-a", "elsewhere", "c", nil),
+    )
+    nodes := []corev1.Node{
+        {ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+        {ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+    }
+
+    tests := []struct {
+        name    string
+        planner appsv1.PlannerSpec
+        pods    [][]string
+    }{
+        {
+            name:    "namespaces list",
+            planner: appsv1.PlannerSpec{Namespaces: []string{"default", "team-a"}},
+            pods:    [][]string{{"default/web"}, {"team-a/api"}},
+        },
+        {
+            name: "namespace selector",
+            planner: appsv1.PlannerSpec{Scope: &appsv1.ScopeArgs{
+                NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"planned": "yes"}},
+            }},
+            pods: [][]string{{"team-b/db"}, {"team-a/api"}},
+        },
+        {
+            name: "all namespaces except",
+            planner: appsv1.PlannerSpec{Scope: &appsv1.ScopeArgs{
+                ExcludedNamespaces: []string{"kube-system", "team-a"},
+            }},
+            pods: [][]string{{"default/web", "team-b/db"}, {}},
+        },
+        {
+            name: "pod selector",
+            planner: appsv1.PlannerSpec{Scope: &appsv1.ScopeArgs{
+                PodSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+                    {Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"critical"}},
+                    {Key: "app", Operator: metav1.LabelSelectorOpExists},
+                }},
+            }},
+            pods: [][]string{{"default/web"}, {"team-a/api"}},
+        },
+    }
+
+    for _, tt := range tests {
+        pods, err := getPods(&tt.planner, nodes, clt, context.Background())
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        for i := range nodes {
+            if names := podNames(pods[i]); !reflect.DeepEqual(names, tt.pods[i]) {
+                t.Errorf("%s: expected pods %v on node %s, got %v", tt.name, tt.pods[i], nodes[i].Name, names)
+            }
+        }
+    }
+}
+
+func TestGetNodesScope(t *testing.T) {
+    master := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "master", Labels: map[string]string{"node-role.kubernetes.io/master": ""}}}
+    clt := fake.NewFakeClientWithScheme(scheme.Scheme,
+        master,
+        &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+        &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+        scopedPod("default", "web", "a", nil),
+        scopedPod("default", "etcd", "master", nil),
+    )
+    planner := appsv1.PlannerSpec{
+        Namespaces: []string{"default"},
+        Scope: &appsv1.ScopeArgs{
+            NodeSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+                {Key: "node-role.kubernetes.io/master", Operator: metav1.LabelSelectorOpDoesNotExist},
+            }},
+            ExcludedNodes: []string{"b"},
+        },
+    }
+
+    nodes, err := getNodes(&planner, clt, context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(nodes) != 1 || nodes[0].Name != "a" {
+        t.Fatalf("expected only node a in scope, got %v", nodes)
+    }
+
+    pods, err := getPods(&planner, nodes, clt, context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if names := podNames(pods[0]); !reflect.DeepEqual(names, []string{"default/web"}) {
+        t.Errorf("expected pods of out-of-scope nodes to be skipped, got %v", names)
+    }
+}
+
+func TestMetricsNamespaces(t *testing.T) {
+    planner := appsv1.PlannerSpec{Namespaces: []string{"default", "team-a"}}
+    if ns := metricsNamespaces(&planner); !reflect.DeepEqual(ns, []string{"default", "team-a"}) {
+        t.Errorf("expected the namespaces list, got %v", ns)
+    }
+
+    planner.Scope = &appsv1.ScopeArgs{ExcludedNamespaces: []string{"team-a"}}
+    if ns := metricsNamespaces(&planner); !reflect.DeepEqual(ns, []string{"default"}) {
+        t.Errorf("expected excluded namespaces to be removed, got %v", ns)
+    }
+
+    planner.Scope.NamespaceSelector = &metav1.LabelSelector{}
+    if ns := metricsNamespaces(&planner); len(ns) != 0 {
+        t.Errorf("expected all namespaces with a selector, got %v", ns)
+    }
+}
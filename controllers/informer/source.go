@@ -0,0 +1,105 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informer
+
+import (
+    "context"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// MetricsSource provides samples of node and pod usage. Empty namespaces
+// mean all namespaces.
+type MetricsSource interface {
+    Fetch(ctx context.Context, namespaces []string) (types.MetricsPackage, error)
+}
+
+// HistorySource is implemented by sources that keep past samples, so that
+// the planner does not start without history.
+type HistorySource interface {
+    FetchRange(ctx context.Context, namespaces []string, start time.Time, end time.Time, step time.Duration) ([]types.MetricsPackage, error)
+}
+
+type metricsServerSource struct {
+    mclt *metricsv.Clientset
+}
+
+func (s *metricsServerSource) Fetch(ctx context.Context, namespaces []string) (types.MetricsPackage, error) {
+    nodeMetrics, err := getNodeMetrics(s.mclt, ctx)
+    if err != nil {
+        return types.MetricsPackage{}, err
+    }
+
+    podMetrics, err := getPodMetrics(namespaces, s.mclt, ctx)
+    if err != nil {
+        return types.MetricsPackage{}, err
+    }
+
+    return types.MetricsPackage{
+        NodeMetrics: nodeMetrics,
+        PodMetrics:  podMetrics,
+        Timestamp:   time.Now(),
+    }, nil
+}
+
+func newMetricsSource(args *appsv1.MetricsSourceArgs, mclt *metricsv.Clientset) MetricsSource {
+    if args != nil && args.Type == "prometheus" {
+        if args.Prometheus == nil {
+            log.Info("Prometheus metrics source is not configured, metrics-server is used")
+        } else {
+            return NewPrometheusSource(args.Prometheus.URL, args.Prometheus.RateWindow)
+        }
+    }
+    return &metricsServerSource{mclt: mclt}
+}
+
+// loadHistory fills the empty queue from the disk store or, if it has
+// nothing, from the source.
+func loadHistory(ctx context.Context, q types.MetricsQueue, store *diskStore, source MetricsSource, namespaces []string, maxAge time.Duration, period time.Duration) {
+    if q.Size() > 0 {
+        return
+    }
+
+    now := time.Now()
+    history := make([]types.MetricsPackage, 0)
+    if store != nil {
+        packs, err := store.Load(now.Add(-maxAge))
+        if err != nil {
+            log.Info("Failed to load metrics history: ", err)
+        }
+        history = packs
+    }
+
+    if h, ok := source.(HistorySource); ok && len(history) == 0 {
+        packs, err := h.FetchRange(ctx, namespaces, now.Add(-maxAge), now, period)
+        if err != nil {
+            log.Info("Failed to load metrics history: ", err)
+        }
+        history = packs
+    }
+
+    for i := range history {
+        q.Push(history[i])
+    }
+    if len(history) > 0 {
+        log.Info(len(history), " metrics samples are loaded from history")
+    }
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package messages holds the JSON shapes served by the control server, so
+// that clients such as kubectl-planner can decode them without pulling in
+// the planning code.
+package messages
+
+import (
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    corev1 "k8s.io/api/core/v1"
+)
+
+type MoveMessage struct {
+    Pod     string
+    OldNode string
+    NewNode string
+}
+
+type MoveResultMessage struct {
+    Pod     string
+    NewPod  string
+    NewNode string
+    Ok      bool
+    Error   string
+}
+
+type PlanMessage struct {
+    NodesChange    int
+    Moves          []MoveMessage
+    Results        []MoveResultMessage
+    MonthlySavings float64
+}
+
+type StatusMessage struct {
+    Active    bool
+    Phase     string
+    LastStart time.Time
+    HasPlan   bool
+    Plan      PlanMessage
+    // Status of every cluster, including the local one, if the planner
+    // plans several clusters.
+    Clusters []ClusterStatusMessage `json:",omitempty"`
+}
+
+// ClusterStatusMessage is the status of a cluster. Utilization is requested
+// resources in percents of allocatable. NodeShift is the number of nodes the
+// cluster should get, or give away if negative, to even utilization across
+// clusters. It is reported only if balance_clusters is set.
+type ClusterStatusMessage struct {
+    Name              string
+    Phase             string
+    LastStart         time.Time
+    HasPlan           bool
+    Plan              PlanMessage
+    Nodes             int
+    CpuUtilization    float64
+    MemoryUtilization float64
+    NodeShift         int
+}
+
+type NodeUsageMessage struct {
+    Node         string
+    CpuBefore    float64
+    CpuAfter     float64
+    MemoryBefore float64
+    MemoryAfter  float64
+    PodsBefore   int
+    PodsAfter    int
+}
+
+type ExplainMessage struct {
+    Plan  PlanMessage
+    Nodes []NodeUsageMessage
+}
+
+type HistoryMessage struct {
+    CreatedAt time.Time
+    Status    string
+    Plan      PlanMessage
+}
+
+// Snapshot is a cluster state that the planner can plan against without
+// touching the real cluster. Pods are bound to nodes by spec.nodeName.
+type Snapshot struct {
+    Spec  appsv1.PlannerSpec `json:"spec,omitempty"`
+    Nodes []corev1.Node      `json:"nodes"`
+    Pods  []corev1.Pod       `json:"pods"`
+}
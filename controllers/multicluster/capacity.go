@@ -0,0 +1,113 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+    "math"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+// Capacity is the allocatable and requested resources of a cluster in
+// millicores and bytes.
+type Capacity struct {
+    Nodes             int
+    AllocatableCpu    int64
+    AllocatableMemory int64
+    RequestedCpu      int64
+    RequestedMemory   int64
+}
+
+func NewCapacity(nodes []corev1.Node, pods [][]corev1.Pod) Capacity {
+    c := Capacity{Nodes: len(nodes)}
+    for i := range nodes {
+        c.AllocatableCpu += nodes[i].Status.Allocatable.Cpu().MilliValue()
+        c.AllocatableMemory += nodes[i].Status.Allocatable.Memory().Value()
+    }
+    for i := range pods {
+        for j := range pods[i] {
+            for _, container := range pods[i][j].Spec.Containers {
+                c.RequestedCpu += container.Resources.Requests.Cpu().MilliValue()
+                c.RequestedMemory += container.Resources.Requests.Memory().Value()
+            }
+        }
+    }
+    return c
+}
+
+// CpuUtilization returns requested cpu in percents of allocatable.
+func (c Capacity) CpuUtilization() float64 {
+    return percent(c.RequestedCpu, c.AllocatableCpu)
+}
+
+// MemoryUtilization returns requested memory in percents of allocatable.
+func (c Capacity) MemoryUtilization() float64 {
+    return percent(c.RequestedMemory, c.AllocatableMemory)
+}
+
+func percent(x int64, total int64) float64 {
+    if total == 0 {
+        return 0
+    }
+    return float64(x) * 100 / float64(total)
+}
+
+// Balance returns how many nodes every cluster should get, or give away if
+// negative, so that its utilization matches the utilization of all clusters
+// together. Nodes are counted in the average node size of the cluster, and
+// the scarcer of cpu and memory decides.
+func Balance(capacities map[string]Capacity) map[string]int {
+    total := Capacity{}
+    for _, c := range capacities {
+        total.AllocatableCpu += c.AllocatableCpu
+        total.AllocatableMemory += c.AllocatableMemory
+        total.RequestedCpu += c.RequestedCpu
+        total.RequestedMemory += c.RequestedMemory
+    }
+
+    shifts := make(map[string]int, len(capacities))
+    for name, c := range capacities {
+        if c.Nodes == 0 {
+            shifts[name] = 0
+            continue
+        }
+        shift := math.Inf(-1)
+        if cpu, ok := nodeShift(c.RequestedCpu, c.AllocatableCpu, c.Nodes, total.RequestedCpu, total.AllocatableCpu); ok {
+            shift = cpu
+        }
+        if memory, ok := nodeShift(c.RequestedMemory, c.AllocatableMemory, c.Nodes, total.RequestedMemory, total.AllocatableMemory); ok {
+            shift = math.Max(shift, memory)
+        }
+        if math.IsInf(shift, -1) {
+            shift = 0
+        }
+        shifts[name] = int(math.Round(shift))
+    }
+    return shifts
+}
+
+// nodeShift returns the number of nodes that brings requested/allocatable
+// to totalRequested/totalAllocatable. It returns false if the resource is
+// not requested or not known.
+func nodeShift(requested int64, allocatable int64, nodes int, totalRequested int64, totalAllocatable int64) (float64, bool) {
+    if totalRequested == 0 || totalAllocatable == 0 || allocatable == 0 {
+        return 0, false
+    }
+    target := float64(totalRequested) / float64(totalAllocatable)
+    nodeSize := float64(allocatable) / float64(nodes)
+    return (float64(requested)/target - float64(allocatable)) / nodeSize, true
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    resource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func node(cpu string, memory string) corev1.Node {
+    return corev1.Node{Status: corev1.NodeStatus{Allocatable: corev1.ResourceList{
+        corev1.ResourceCPU:    resource.MustParse(cpu),
+        corev1.ResourceMemory: resource.MustParse(memory),
+    }}}
+}
+
+func pod(cpu string, memory string) corev1.Pod {
+    return corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+        Requests: corev1.ResourceList{
+            corev1.ResourceCPU:    resource.MustParse(cpu),
+            corev1.ResourceMemory: resource.MustParse(memory),
+        },
+    }}}}}
+}
+
+func TestNewCapacity(t *testing.T) {
+    c := NewCapacity(
+        []corev1.Node{node("2", "4Gi"), node("2", "4Gi")},
+        [][]corev1.Pod{{pod("1", "1Gi"), pod("500m", "1Gi")}, {pod("500m", "2Gi")}},
+    )
+    if c.Nodes != 2 || c.AllocatableCpu != 4000 || c.RequestedCpu != 2000 {
+        t.Errorf("unexpected capacity: %+v", c)
+    }
+    if c.CpuUtilization() != 50 || c.MemoryUtilization() != 50 {
+        t.Errorf("expected 50%% utilization, got %v and %v", c.CpuUtilization(), c.MemoryUtilization())
+    }
+}
+
+func TestBalance(t *testing.T) {
+    capacities := map[string]Capacity{
+        // 80% of 10 nodes of 1 cpu.
+        "busy": {Nodes: 10, AllocatableCpu: 10000, AllocatableMemory: 10, RequestedCpu: 8000, RequestedMemory: 8},
+        // 20% of 10 nodes of 1 cpu.
+        "idle": {Nodes: 10, AllocatableCpu: 10000, AllocatableMemory: 10, RequestedCpu: 2000, RequestedMemory: 2},
+        "empty": {},
+    }
+    shifts := Balance(capacities)
+    if shifts["busy"] != 6 || shifts["idle"] != -6 || shifts["empty"] != 0 {
+        t.Errorf("expected 6 nodes to move from idle to busy, got %v", shifts)
+    }
+
+    // Memory decides when it is scarcer than cpu.
+    capacities["idle"] = Capacity{Nodes: 10, AllocatableCpu: 10000, AllocatableMemory: 10, RequestedCpu: 2000, RequestedMemory: 9}
+    capacities["busy"] = Capacity{Nodes: 10, AllocatableCpu: 10000, AllocatableMemory: 10, RequestedCpu: 8000, RequestedMemory: 1}
+    if shifts := Balance(capacities); shifts["idle"] != 8 || shifts["busy"] != 6 {
+        t.Errorf("expected idle to need nodes for memory, got %v", shifts)
+    }
+}
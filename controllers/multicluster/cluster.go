@@ -0,0 +1,348 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    executor "github.com/miha3009/planner/controllers/executor"
+    informer "github.com/miha3009/planner/controllers/informer"
+    rescheduler "github.com/miha3009/planner/controllers/rescheduler"
+    resourceupdater "github.com/miha3009/planner/controllers/resourceupdater"
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    "k8s.io/apimachinery/pkg/runtime"
+    clientset "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/clientcmd"
+    metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const defaultJournalNamespace = "default"
+
+// Cluster is a remote cluster planned by the planner. It runs the same
+// phases as the local one, but on its own cache and without the event loop
+// of the reconciler, so clusters are planned independently.
+type Cluster struct {
+    Name          string
+    Client        client.Client
+    Clientset     *clientset.Clientset
+    MetricsClient *metricsv.Clientset
+    Cache         *types.PlannerCache
+    Informer      informer.Informer
+    Executor      executor.Executor
+
+    args appsv1.ClusterArgs
+
+    mu            sync.Mutex
+    busy          bool
+    lastStart     time.Time
+    capacity      Capacity
+    ctx           context.Context
+    spec          appsv1.PlannerSpec
+    metrics       context.Context
+    stopMetrics   context.CancelFunc
+    stopExecution context.CancelFunc
+}
+
+// Connect creates clients of the cluster from its kubeconfig context.
+func Connect(args appsv1.ClusterArgs, scheme *runtime.Scheme) (*Cluster, error) {
+    rules := clientcmd.NewDefaultClientConfigLoadingRules()
+    if args.Kubeconfig != "" {
+        rules.ExplicitPath = args.Kubeconfig
+    }
+    overrides := &clientcmd.ConfigOverrides{CurrentContext: args.Context}
+    config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+    if err != nil {
+        return nil, err
+    }
+
+    clt, err := client.New(config, client.Options{Scheme: scheme})
+    if err != nil {
+        return nil, err
+    }
+    cltset, err := clientset.NewForConfig(config)
+    if err != nil {
+        return nil, err
+    }
+    mclt, err := metricsv.NewForConfig(config)
+    if err != nil {
+        return nil, err
+    }
+
+    return &Cluster{
+        Name:          args.Name,
+        Client:        clt,
+        Clientset:     cltset,
+        MetricsClient: mclt,
+        Cache:         types.NewCache(),
+        Informer:      &informer.DefaultInformer{},
+        Executor:      &executor.DefaultExecutor{JournalNamespace: journalNamespace(args)},
+        args:          args,
+    }, nil
+}
+
+// journalNamespace returns the namespace of the execution journal in the
+// cluster. The namespace of the controller may not exist there, so it
+// defaults to "default".
+func journalNamespace(args appsv1.ClusterArgs) string {
+    if args.JournalNamespace != "" {
+        return args.JournalNamespace
+    }
+    return defaultJournalNamespace
+}
+
+// specFor returns the spec the cluster is planned with.
+func (c *Cluster) specFor(spec appsv1.PlannerSpec) appsv1.PlannerSpec {
+    if c.args.MetricsSource != nil {
+        spec.MetricsSource = c.args.MetricsSource
+    }
+    spec.Clusters = nil
+    return spec
+}
+
+// StartMetrics runs the metrics listener of the cluster unless it is
+// already running. The listener stops with ctx or Stop.
+func (c *Cluster) StartMetrics(ctx context.Context, spec appsv1.PlannerSpec) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.metrics != nil && c.metrics.Err() == nil {
+        return
+    }
+
+    ctx, cancel := context.WithCancel(ctx)
+    c.metrics = ctx
+    c.stopMetrics = cancel
+    c.Cache.Metrics.SetMaxAge(time.Second * time.Duration(spec.MetrcisMaxAge))
+    c.Cache.Metrics.SetDownsampling(time.Second*time.Duration(spec.MetricsDownsampleAfter), time.Second*time.Duration(spec.MetricsDownsampleStep))
+    go c.Informer.RunMetircsListener(ctx, c.Cache, c.MetricsClient, c.specFor(spec))
+}
+
+// Stop stops the metrics listener and an executing plan.
+func (c *Cluster) Stop() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.stopMetrics != nil {
+        c.stopMetrics()
+        c.stopMetrics = nil
+    }
+    if c.stopExecution != nil {
+        c.stopExecution()
+    }
+}
+
+// Recover finishes or rolls back an execution that a previous run of the
+// planner left in the journal of the cluster and loads the node changes
+// saved by it. The cluster is busy until then, so no cycle starts before
+// the journal is recovered, and Stop cancels the recovery.
+func (c *Cluster) Recover() {
+    ctx, cancel := context.WithCancel(context.Background())
+    c.mu.Lock()
+    c.busy = true
+    c.Cache.SetPhase("Recovering")
+    c.stopExecution = cancel
+    c.mu.Unlock()
+
+    go func() {
+        defer c.release()
+        defer func() {
+            c.mu.Lock()
+            c.stopExecution = nil
+            c.mu.Unlock()
+            cancel()
+        }()
+        if err := executor.RecoverExecution(ctx, c.Clientset, journalNamespace(c.args)); err != nil {
+            log.Info("Failed to recover execution of cluster ", c.Name, ": ", err)
+        }
+        if err := executor.LoadNodeChanges(ctx, c.Clientset, journalNamespace(c.args), c.Cache); err != nil {
+            log.Info("Failed to load node changes of cluster ", c.Name, ": ", err)
+        }
+    }()
+}
+
+// StartCycle plans the cluster in the background unless a cycle is
+// already running. It returns false if the cluster is busy.
+func (c *Cluster) StartCycle(ctx context.Context, spec appsv1.PlannerSpec) bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.busy {
+        return false
+    }
+    c.busy = true
+    c.lastStart = time.Now()
+    c.ctx = ctx
+    c.spec = c.specFor(spec)
+    go c.runCycle(ctx, c.spec)
+    return true
+}
+
+func (c *Cluster) runCycle(ctx context.Context, spec appsv1.PlannerSpec) {
+    defer c.release()
+    events := make(chan types.Event, 1)
+
+    c.mu.Lock()
+    c.Cache.Clear()
+    c.Cache.SetPhase("Collecting info")
+    c.mu.Unlock()
+    go c.Informer.GetInfo(ctx, events, c.Cache, c.Client, spec)
+    if !c.wait(ctx, events, types.InformingEnded) {
+        return
+    }
+    c.mu.Lock()
+    c.capacity = NewCapacity(c.Cache.Nodes, c.Cache.Pods)
+    c.mu.Unlock()
+
+    c.setPhase("Resource updating")
+    go resourceupdater.UpdatePodResources(ctx, events, c.Cache, c.Client, spec)
+    if !c.wait(ctx, events, types.ResourceUpdatingEnded) {
+        return
+    }
+
+    c.setPhase("Plan generating")
+    go rescheduler.GenPlan(ctx, events, c.Cache, spec)
+    if !c.wait(ctx, events, types.PlanningEnded) {
+        return
+    }
+
+    if spec.RequireApproval {
+        c.Cache.AddToHistory(c.Cache.Plan, types.PlanStatusPendingApproval)
+        c.setPhase("Waiting for approval")
+        log.Info("Plan of cluster ", c.Name, " is waiting for approval")
+        return
+    }
+    c.Cache.AddToHistory(c.Cache.Plan, types.PlanStatusExecuting)
+    c.execute(ctx, spec)
+}
+
+// Approve executes the plan waiting for approval.
+func (c *Cluster) Approve() bool {
+    c.mu.Lock()
+    if c.busy || c.Cache.LastPlanStatus() != types.PlanStatusPendingApproval {
+        c.mu.Unlock()
+        return false
+    }
+    c.busy = true
+    ctx, spec := c.ctx, c.spec
+    c.mu.Unlock()
+
+    c.Cache.SetLastPlanStatus(types.PlanStatusExecuting)
+    go func() {
+        defer c.release()
+        c.execute(ctx, spec)
+    }()
+    return true
+}
+
+// Abort drops the plan waiting for approval or stops the executing one.
+func (c *Cluster) Abort() bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    switch c.Cache.LastPlanStatus() {
+    case types.PlanStatusPendingApproval:
+        if c.busy {
+            return false
+        }
+        c.Cache.SetLastPlanStatus(types.PlanStatusAborted)
+        c.Cache.SetPhase("Waiting")
+        return true
+    case types.PlanStatusExecuting:
+        if c.stopExecution == nil {
+            return false
+        }
+        c.Cache.SetLastPlanStatus(types.PlanStatusAborted)
+        c.stopExecution()
+        return true
+    }
+    return false
+}
+
+func (c *Cluster) execute(ctx context.Context, spec appsv1.PlannerSpec) {
+    events := make(chan types.Event, 1)
+    ctx, cancel := context.WithCancel(ctx)
+    c.mu.Lock()
+    c.stopExecution = cancel
+    c.mu.Unlock()
+    defer func() {
+        c.mu.Lock()
+        c.stopExecution = nil
+        c.mu.Unlock()
+        cancel()
+    }()
+
+    c.setPhase("Plan executing")
+    go c.Executor.ExecutePlan(ctx, events, c.Cache, c.Client, c.Clientset, spec)
+    // The executor reports the end even if it is cancelled.
+    <-events
+    if c.Cache.LastPlanStatus() == types.PlanStatusExecuting {
+        c.Cache.SetLastPlanStatus(types.PlanStatusExecuted)
+    }
+}
+
+// wait waits for the end of a phase. The cycle stops on errors and when
+// the planner stops.
+func (c *Cluster) wait(ctx context.Context, events chan types.Event, expected types.Event) bool {
+    select {
+    case e := <-events:
+        if e != expected {
+            log.Info("Error. Planning of cluster ", c.Name, " will restart at the next cycle")
+            return false
+        }
+        return true
+    case <-ctx.Done():
+        return false
+    }
+}
+
+func (c *Cluster) release() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.busy = false
+    if phase, _ := c.Cache.Status(); phase != "Waiting for approval" {
+        c.Cache.SetPhase("Waiting")
+    }
+}
+
+// setPhase sets the phase of the cluster. The phase is changed only under
+// c.mu, so Status sees it together with the plan of the same cycle.
+func (c *Cluster) setPhase(phase string) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.Cache.SetPhase(phase)
+}
+
+// Status returns the phase and the plan of the cluster.
+func (c *Cluster) Status() (string, *types.Plan) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.Cache.Status()
+}
+
+func (c *Cluster) LastStart() time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.lastStart
+}
+
+// Capacity returns the capacity seen at the last planning cycle.
+func (c *Cluster) Capacity() Capacity {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.capacity
+}
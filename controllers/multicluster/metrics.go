@@ -0,0 +1,62 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+    "github.com/prometheus/client_golang/prometheus"
+    "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+    nodesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "planner_cluster_nodes",
+        Help: "Number of nodes of a cluster at the last planning cycle.",
+    }, []string{"cluster"})
+    utilizationGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "planner_cluster_utilization",
+        Help: "Requested resources of a cluster in percents of allocatable.",
+    }, []string{"cluster", "resource"})
+    shiftGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "planner_cluster_node_shift",
+        Help: "Nodes a cluster should get, or give away if negative, to even utilization across clusters.",
+    }, []string{"cluster"})
+)
+
+func init() {
+    metrics.Registry.MustRegister(nodesGauge, utilizationGauge, shiftGauge)
+}
+
+// Report exposes capacities by cluster and, if shifts is not nil, the node
+// shifts that balance them.
+func Report(capacities map[string]Capacity, shifts map[string]int) {
+    for name, c := range capacities {
+        nodesGauge.WithLabelValues(name).Set(float64(c.Nodes))
+        utilizationGauge.WithLabelValues(name, "cpu").Set(c.CpuUtilization())
+        utilizationGauge.WithLabelValues(name, "memory").Set(c.MemoryUtilization())
+        if shifts != nil {
+            shiftGauge.WithLabelValues(name).Set(float64(shifts[name]))
+        }
+    }
+}
+
+// Forget drops metrics of a cluster that is no longer planned.
+func Forget(name string) {
+    nodesGauge.DeleteLabelValues(name)
+    utilizationGauge.DeleteLabelValues(name, "cpu")
+    utilizationGauge.DeleteLabelValues(name, "memory")
+    shiftGauge.DeleteLabelValues(name)
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+    "sort"
+    "sync"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    "github.com/prometheus/common/log"
+    "k8s.io/apimachinery/pkg/runtime"
+)
+
+// LocalCluster names the cluster the planner runs in.
+const LocalCluster = "local"
+
+const (
+    minConnectRetry = time.Second * 10
+    maxConnectRetry = time.Minute * 5
+)
+
+// Set holds the remote clusters of a planner. It is shared by the reconciler
+// and the control server, so all methods are safe for concurrent use.
+type Set struct {
+    mu         sync.Mutex
+    clusters   map[string]*Cluster
+    failed     map[string]*connectFailure
+    connecting map[string]struct{}
+    wanted     map[string]struct{}
+    local      Capacity
+    balance    bool
+    connect    func(args appsv1.ClusterArgs, scheme *runtime.Scheme) (*Cluster, error)
+    recover    func(c *Cluster)
+}
+
+// connectFailure delays the next connection to a cluster. Failures with
+// the same kubeconfig and context double the delay.
+type connectFailure struct {
+    key      string
+    attempts int
+    retryAt  time.Time
+}
+
+func NewSet() *Set {
+    return &Set{
+        clusters:   make(map[string]*Cluster),
+        failed:     make(map[string]*connectFailure),
+        connecting: make(map[string]struct{}),
+        wanted:     make(map[string]struct{}),
+        connect:    Connect,
+        recover:    (*Cluster).Recover,
+    }
+}
+
+// Sync connects clusters added to the spec and stops removed ones. A
+// cluster that fails to connect is retried with a growing delay. Clusters
+// are connected without holding the lock, so a slow API server does not
+// block the control server.
+func (s *Set) Sync(args []appsv1.ClusterArgs, scheme *runtime.Scheme) {
+    for _, a := range s.update(args) {
+        c, err := s.connect(a, scheme)
+        if s.add(a, c, err) {
+            s.recover(c)
+        }
+    }
+}
+
+// update applies the spec to connected clusters and returns the clusters
+// to connect.
+func (s *Set) update(args []appsv1.ClusterArgs) []appsv1.ClusterArgs {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    pending := make([]appsv1.ClusterArgs, 0)
+    s.wanted = make(map[string]struct{}, len(args))
+    for _, a := range args {
+        if a.Name == LocalCluster {
+            log.Info("Cluster name ", LocalCluster, " is reserved for the local cluster")
+            continue
+        }
+        s.wanted[a.Name] = struct{}{}
+
+        key := clusterKey(a)
+        if c, ok := s.clusters[a.Name]; ok && clusterKey(c.args) == key {
+            c.mu.Lock()
+            c.args = a
+            c.mu.Unlock()
+            continue
+        }
+        if _, ok := s.connecting[a.Name]; ok {
+            continue
+        }
+        if f, ok := s.failed[a.Name]; ok && f.key == key && now.Before(f.retryAt) {
+            continue
+        }
+        s.connecting[a.Name] = struct{}{}
+        pending = append(pending, a)
+    }
+
+    for name, c := range s.clusters {
+        if _, ok := s.wanted[name]; !ok {
+            c.Stop()
+            delete(s.clusters, name)
+            Forget(name)
+            log.Info("Cluster ", name, " is disconnected")
+        }
+    }
+    for name := range s.failed {
+        if _, ok := s.wanted[name]; !ok {
+            delete(s.failed, name)
+        }
+    }
+    return pending
+}
+
+// add stores the result of a connection. It returns true if the cluster is
+// added.
+func (s *Set) add(a appsv1.ClusterArgs, c *Cluster, err error) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    delete(s.connecting, a.Name)
+
+    if _, ok := s.wanted[a.Name]; !ok {
+        if c != nil {
+            c.Stop()
+        }
+        return false
+    }
+    if err != nil {
+        f := &connectFailure{key: clusterKey(a), attempts: 1}
+        if old, ok := s.failed[a.Name]; ok && old.key == f.key {
+            f.attempts = old.attempts + 1
+        }
+        delay := connectRetryDelay(f.attempts)
+        f.retryAt = time.Now().Add(delay)
+        s.failed[a.Name] = f
+        log.Info("Failed to connect to cluster ", a.Name, ": ", err, ", retrying in ", delay)
+        return false
+    }
+
+    if old, ok := s.clusters[a.Name]; ok {
+        old.Stop()
+    }
+    delete(s.failed, a.Name)
+    s.clusters[a.Name] = c
+    log.Info("Cluster ", a.Name, " is connected")
+    return true
+}
+
+func clusterKey(a appsv1.ClusterArgs) string {
+    return a.Kubeconfig + "|" + a.Context
+}
+
+func connectRetryDelay(attempts int) time.Duration {
+    delay := minConnectRetry
+    for i := 1; i < attempts && delay < maxConnectRetry; i++ {
+        delay *= 2
+    }
+    if delay > maxConnectRetry {
+        delay = maxConnectRetry
+    }
+    return delay
+}
+
+// List returns the clusters ordered by name.
+func (s *Set) List() []*Cluster {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    res := make([]*Cluster, 0, len(s.clusters))
+    for _, c := range s.clusters {
+        res = append(res, c)
+    }
+    sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+    return res
+}
+
+func (s *Set) Get(name string) (*Cluster, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    c, ok := s.clusters[name]
+    return c, ok
+}
+
+// SetLocalCapacity records the capacity of the local cluster.
+func (s *Set) SetLocalCapacity(c Capacity) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.local = c
+}
+
+// Capacities returns capacities of all clusters, including the local one.
+func (s *Set) Capacities() map[string]Capacity {
+    clusters := s.List()
+    s.mu.Lock()
+    res := map[string]Capacity{LocalCluster: s.local}
+    s.mu.Unlock()
+    for _, c := range clusters {
+        res[c.Name] = c.Capacity()
+    }
+    return res
+}
+
+// SetBalance turns reporting of node shifts on or off.
+func (s *Set) SetBalance(balance bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.balance = balance
+}
+
+// Shifts returns the node shifts that even utilization of the clusters, or
+// nil if balancing is off.
+func (s *Set) Shifts(capacities map[string]Capacity) map[string]int {
+    s.mu.Lock()
+    balance := s.balance
+    s.mu.Unlock()
+    if !balance {
+        return nil
+    }
+    return Balance(capacities)
+}
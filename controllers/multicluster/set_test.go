@@ -0,0 +1,186 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+    "fmt"
+    "testing"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    "k8s.io/apimachinery/pkg/runtime"
+)
+
+func fakeConnect(connected *int) func(appsv1.ClusterArgs, *runtime.Scheme) (*Cluster, error) {
+    return func(args appsv1.ClusterArgs, scheme *runtime.Scheme) (*Cluster, error) {
+        *connected++
+        if args.Kubeconfig == "broken" {
+            return nil, fmt.Errorf("no such file")
+        }
+        return &Cluster{Name: args.Name, Cache: types.NewCache(), args: args}, nil
+    }
+}
+
+// newTestSet connects clusters with fakeConnect and records recovered
+// clusters instead of reading their journals.
+func newTestSet(connected *int, recovered *[]string) *Set {
+    s := NewSet()
+    s.connect = fakeConnect(connected)
+    s.recover = func(c *Cluster) {
+        *recovered = append(*recovered, c.Name)
+    }
+    return s
+}
+
+func TestSync(t *testing.T) {
+    connected := 0
+    recovered := []string{}
+    s := newTestSet(&connected, &recovered)
+
+    s.Sync([]appsv1.ClusterArgs{{Name: "b"}, {Name: "a"}, {Name: LocalCluster}, {Name: "c", Kubeconfig: "broken"}}, nil)
+    clusters := s.List()
+    if len(clusters) != 2 || clusters[0].Name != "a" || clusters[1].Name != "b" {
+        t.Fatalf("expected clusters a and b, got %d clusters", len(clusters))
+    }
+
+    if len(recovered) != 2 {
+        t.Errorf("expected journals of connected clusters to be recovered, got %v", recovered)
+    }
+
+    // Connected clusters and failed ones before their retry are not
+    // connected again.
+    s.Sync([]appsv1.ClusterArgs{{Name: "a"}, {Name: "b"}, {Name: "c", Kubeconfig: "broken"}}, nil)
+    if connected != 3 || len(recovered) != 2 {
+        t.Errorf("expected 3 connections, got %d", connected)
+    }
+
+    s.Sync([]appsv1.ClusterArgs{{Name: "a", Context: "other"}}, nil)
+    if _, ok := s.Get("b"); ok {
+        t.Error("expected cluster b to be removed")
+    }
+    if c, _ := s.Get("a"); c == nil || c.args.Context != "other" || connected != 4 {
+        t.Errorf("expected cluster a to reconnect to the new context")
+    }
+}
+
+func TestSyncRetriesFailedClusters(t *testing.T) {
+    connected := 0
+    recovered := []string{}
+    s := newTestSet(&connected, &recovered)
+    args := []appsv1.ClusterArgs{{Name: "c", Kubeconfig: "broken"}}
+
+    s.Sync(args, nil)
+    first := s.failed["c"].retryAt
+    s.failed["c"].retryAt = time.Now().Add(-time.Second)
+    s.Sync(args, nil)
+    if connected != 2 || s.failed["c"].attempts != 2 {
+        t.Fatalf("expected the failed cluster to be retried, got %d connections", connected)
+    }
+    if delay := time.Until(s.failed["c"].retryAt); delay <= time.Until(first) {
+        t.Errorf("expected the retry delay to grow, got %v", delay)
+    }
+
+    s.failed["c"].retryAt = time.Now().Add(-time.Second)
+    args[0].Kubeconfig = ""
+    s.Sync(args, nil)
+    if _, ok := s.Get("c"); !ok || len(s.failed) != 0 || len(recovered) != 1 {
+        t.Errorf("expected cluster c to be connected once it is fixed")
+    }
+    if connectRetryDelay(100) != maxConnectRetry {
+        t.Errorf("expected the retry delay to be capped")
+    }
+}
+
+func TestSyncConnectsWithoutLock(t *testing.T) {
+    s := NewSet()
+    s.recover = func(c *Cluster) {}
+    s.connect = func(args appsv1.ClusterArgs, scheme *runtime.Scheme) (*Cluster, error) {
+        // The control server reads the set while a cluster is connecting.
+        s.List()
+        return &Cluster{Name: args.Name, Cache: types.NewCache(), args: args}, nil
+    }
+
+    done := make(chan struct{})
+    go func() {
+        s.Sync([]appsv1.ClusterArgs{{Name: "a"}}, nil)
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(time.Second * 5):
+        t.Fatal("expected connect to run without the lock of the set")
+    }
+}
+
+func TestCapacities(t *testing.T) {
+    connected := 0
+    recovered := []string{}
+    s := newTestSet(&connected, &recovered)
+    s.Sync([]appsv1.ClusterArgs{{Name: "remote"}}, nil)
+
+    remote, _ := s.Get("remote")
+    remote.capacity = Capacity{Nodes: 2, AllocatableCpu: 2000, RequestedCpu: 1800}
+    s.SetLocalCapacity(Capacity{Nodes: 2, AllocatableCpu: 2000, RequestedCpu: 200})
+
+    capacities := s.Capacities()
+    if capacities[LocalCluster].Nodes != 2 || capacities["remote"].RequestedCpu != 1800 {
+        t.Errorf("unexpected capacities: %+v", capacities)
+    }
+    if s.Shifts(capacities) != nil {
+        t.Error("expected no shifts without balancing")
+    }
+    s.SetBalance(true)
+    if shifts := s.Shifts(capacities); shifts["remote"] != 2 || shifts[LocalCluster] != -2 {
+        t.Errorf("unexpected shifts: %v", shifts)
+    }
+}
+
+func TestApproveAndAbort(t *testing.T) {
+    c := &Cluster{Name: "remote", Cache: types.NewCache()}
+    if c.Approve() || c.Abort() {
+        t.Fatal("expected nothing to approve or abort without a plan")
+    }
+
+    c.Cache.AddToHistory(&types.Plan{}, types.PlanStatusPendingApproval)
+    if !c.Abort() || c.Cache.LastPlanStatus() != types.PlanStatusAborted {
+        t.Errorf("expected the pending plan to be aborted")
+    }
+    if c.Approve() {
+        t.Error("expected an aborted plan not to be approved")
+    }
+}
+
+func TestStatusWhileCycleRuns(t *testing.T) {
+    c := &Cluster{Name: "remote", Cache: types.NewCache()}
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        for i := 0; i < 100; i++ {
+            c.setPhase("Plan generating")
+            c.release()
+        }
+    }()
+    for i := 0; i < 100; i++ {
+        c.Status()
+    }
+    <-done
+
+    if phase, plan := c.Status(); phase != "Waiting" || plan != nil {
+        t.Errorf("expected a waiting cluster without a plan, got %s and %v", phase, plan)
+    }
+}
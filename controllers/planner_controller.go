@@ -33,6 +33,7 @@ import (
 
     executor "github.com/miha3009/planner/controllers/executor"
     informer "github.com/miha3009/planner/controllers/informer"
+    multicluster "github.com/miha3009/planner/controllers/multicluster"
     rescheduler "github.com/miha3009/planner/controllers/rescheduler"
     resourceupdater "github.com/miha3009/planner/controllers/resourceupdater"
     types "github.com/miha3009/planner/controllers/types"
@@ -45,25 +46,37 @@ type Process struct {
 
 // PlannerReconciler reconciles a Planner object
 type PlannerReconciler struct {
-    Client         client.Client
-    Clientset      *clientset.Clientset
-    Log            logr.Logger
-    Scheme         *runtime.Scheme
-    MetricsClient  *metricsv.Clientset
-    Events         chan types.Event
-    Cache          *types.PlannerCache
-    MainProcess    *Process
-    MetricsProcess *Process
-    LastStart      time.Time
-    Informer       informer.Informer // for testing purpose
-    Executor       executor.Executor // for testing purpose
+    Client           client.Client
+    Clientset        *clientset.Clientset
+    Log              logr.Logger
+    Scheme           *runtime.Scheme
+    MetricsClient    *metricsv.Clientset
+    Events           chan types.Event
+    Cache            *types.PlannerCache
+    MainProcess      *Process
+    MetricsProcess   *Process
+    ExecutionProcess *Process
+    LastStart        time.Time
+    Clusters         *multicluster.Set
+    Informer         informer.Informer // for testing purpose
+    Executor         executor.Executor // for testing purpose
 }
 
 //+kubebuilder:rbac:groups=apps.hse.ru,resources=planners,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps.hse.ru,resources=planners/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;delete;patch
+//+kubebuilder:rbac:groups=core,resources=pods/eviction,verbs=create
+//+kubebuilder:rbac:groups=core,resources=pods/resize,verbs=patch
+//+kubebuilder:rbac:groups=apps,resources=statefulsets;daemonsets,verbs=get;patch
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get
+//+kubebuilder:rbac:groups=autoscaling.k8s.io,resources=verticalpodautoscalers,verbs=list;update
+//+kubebuilder:rbac:groups=autoscaling.k8s.io,resources=verticalpodautoscalers/status,verbs=update
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;create;update;delete
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;patch;update
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinedeployments;machinesets;machines,verbs=get;list;update
 
 func (r *PlannerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
     _ = r.Log.WithValues("planner", req.NamespacedName)
@@ -100,13 +113,16 @@ func (r *PlannerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 
     if r.Cache != nil {
         r.Cache.Metrics.SetMaxAge(time.Second * time.Duration(planner.Spec.MetrcisMaxAge))
+        r.Cache.Metrics.SetDownsampling(time.Second*time.Duration(planner.Spec.MetricsDownsampleAfter), time.Second*time.Duration(planner.Spec.MetricsDownsampleStep))
     }
+    r.syncClusters(planner)
 
     if planner.Status.Phase == appsv1.Waiting {
         nextStart := r.LastStart.Add(time.Second * time.Duration(planner.Spec.PlanningInterval))
         if nextStart.Before(time.Now()) {
             r.Cache.Clear()
             go r.Informer.GetInfo(r.MainProcess.Context, r.Events, r.Cache, r.Client, planner.Spec)
+            r.startClusterCycles(planner)
             r.LastStart = time.Now()
             r.UpdatePhase(planner, appsv1.Waiting)
             r.Informer.UpdatePlanner(ctx, r.Client, planner)
@@ -156,11 +172,15 @@ func (r *PlannerReconciler) ProcessEvent(ctx context.Context, planner *appsv1.Pl
                 r.MetricsProcess.CancelFunc()
                 r.MetricsProcess = nil
             }
+            r.ExecutionProcess = nil
             log.Info("Planner stopped")
             return true
         }
     case types.InformingEnded:
-        go resourceupdater.UpdatePodResources(r.MainProcess.Context, r.Events, r.Cache, planner.Spec)
+        if r.Clusters != nil {
+            r.Clusters.SetLocalCapacity(multicluster.NewCapacity(r.Cache.Nodes, r.Cache.Pods))
+        }
+        go resourceupdater.UpdatePodResources(r.MainProcess.Context, r.Events, r.Cache, r.Client, planner.Spec)
         r.UpdatePhase(planner, appsv1.ResourcesUpdating)
         return true
     case types.ResourceUpdatingEnded:
@@ -168,10 +188,43 @@ func (r *PlannerReconciler) ProcessEvent(ctx context.Context, planner *appsv1.Pl
         r.UpdatePhase(planner, appsv1.Planning)
         return true
     case types.PlanningEnded:
-        go r.Executor.ExecutePlan(r.MainProcess.Context, r.Events, r.Cache, r.Client, r.Clientset, planner.Spec)
-        r.UpdatePhase(planner, appsv1.Executing)
+        if planner.Spec.RequireApproval {
+            r.Cache.AddToHistory(r.Cache.Plan, types.PlanStatusPendingApproval)
+            r.UpdatePhase(planner, appsv1.WaitingApproval)
+            log.Info("Plan is waiting for approval")
+            return true
+        }
+        r.Cache.AddToHistory(r.Cache.Plan, types.PlanStatusExecuting)
+        r.StartExecutionProcess(planner)
         return true
+    case types.PlanApproved:
+        if planner.Status.Phase == appsv1.WaitingApproval {
+            r.Cache.SetLastPlanStatus(types.PlanStatusExecuting)
+            r.StartExecutionProcess(planner)
+            log.Info("Plan approved")
+            return true
+        }
+    case types.PlanAborted:
+        if planner.Status.Phase == appsv1.WaitingApproval {
+            r.Cache.SetLastPlanStatus(types.PlanStatusAborted)
+            r.UpdatePhase(planner, appsv1.Waiting)
+            log.Info("Plan aborted")
+            return true
+        }
+        if planner.Status.Phase == appsv1.Executing && r.ExecutionProcess != nil {
+            // The executor stops between movements and reports ExecutingEnded.
+            r.Cache.SetLastPlanStatus(types.PlanStatusAborted)
+            r.ExecutionProcess.CancelFunc()
+            log.Info("Plan execution aborted")
+        }
     case types.ExecutingEnded:
+        if r.Cache.LastPlanStatus() == types.PlanStatusExecuting {
+            r.Cache.SetLastPlanStatus(types.PlanStatusExecuted)
+        }
+        if r.ExecutionProcess != nil {
+            r.ExecutionProcess.CancelFunc()
+            r.ExecutionProcess = nil
+        }
         r.UpdatePhase(planner, appsv1.Waiting)
         return true
     case types.PhaseEndedWithError:
@@ -192,19 +245,31 @@ func (r *PlannerReconciler) StartMetricsProcess(ctx context.Context, planner *ap
     go r.Informer.RunMetircsListener(r.MetricsProcess.Context, r.Cache, r.MetricsClient, planner.Spec)
 }
 
+func (r *PlannerReconciler) StartExecutionProcess(planner *appsv1.Planner) {
+    context, cancelFunc := context.WithCancel(r.MainProcess.Context)
+    r.ExecutionProcess = &Process{
+        Context:    context,
+        CancelFunc: cancelFunc,
+    }
+    go r.Executor.ExecutePlan(r.ExecutionProcess.Context, r.Events, r.Cache, r.Client, r.Clientset, planner.Spec)
+    r.UpdatePhase(planner, appsv1.Executing)
+}
+
 func (r *PlannerReconciler) UpdatePhase(planner *appsv1.Planner, phase appsv1.PlannerPhase) {
     planner.Status.Phase = phase
     switch phase {
         case appsv1.Waiting:
-            r.Cache.Phase = "Waiting"
+            r.Cache.SetPhase("Waiting")
         case appsv1.Informing:
-            r.Cache.Phase = "Collecting info"
+            r.Cache.SetPhase("Collecting info")
         case appsv1.ResourcesUpdating:
-            r.Cache.Phase = "Resource updating"
+            r.Cache.SetPhase("Resource updating")
         case appsv1.Planning:
-            r.Cache.Phase = "Plan generating"
+            r.Cache.SetPhase("Plan generating")
         case appsv1.Executing:
-            r.Cache.Phase = "Plan executing"
+            r.Cache.SetPhase("Plan executing")
+        case appsv1.WaitingApproval:
+            r.Cache.SetPhase("Waiting for approval")
     }
 }
 
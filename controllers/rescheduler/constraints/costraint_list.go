@@ -19,6 +19,7 @@ package constraints
 import (
     appsv1 "github.com/miha3009/planner/api/v1"
     base "github.com/miha3009/planner/controllers/rescheduler/constraints/base"
+    overcommit "github.com/miha3009/planner/controllers/rescheduler/constraints/overcommit"
     podaffinity "github.com/miha3009/planner/controllers/rescheduler/constraints/podaffinity"
     podscount "github.com/miha3009/planner/controllers/rescheduler/constraints/podscount"
     ports "github.com/miha3009/planner/controllers/rescheduler/constraints/ports"
@@ -51,6 +52,10 @@ func ConvertArgs(cst *appsv1.ConstraintArgsList) ConstraintList {
         cl = append(cl, podscount.PodsCount{Args: *cst.PodsCount})
     }
 
+    if cst.Overcommit != nil {
+        cl = append(cl, overcommit.Overcommit{Args: *cst.Overcommit})
+    }
+
     return ConstraintList{Items: cl}
 }
 
@@ -0,0 +1,63 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overcommit
+
+import (
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+)
+
+type Overcommit struct {
+    Args appsv1.OvercommitArgs
+}
+
+func (r Overcommit) Init(node *types.NodeInfo) {
+}
+
+func (r Overcommit) AddPod(node *types.NodeInfo, pod *types.PodInfo) {
+}
+
+func (r Overcommit) RemovePod(node *types.NodeInfo, pod *types.PodInfo) {
+}
+
+func (r Overcommit) Check(node *types.NodeInfo) bool {
+    usageCpu, usageMemory, requestCpu, requestMemory := int64(0), int64(0), int64(0), int64(0)
+    for _, pod := range node.Pods {
+        usageCpu += pod.UsageCpu
+        usageMemory += pod.UsageMemory
+        requestCpu += pod.RequestCpu
+        requestMemory += pod.RequestMemory
+    }
+
+    return withinRatio(usageCpu, node.AvalibleCpu, r.Args.MaxUsage) &&
+        withinRatio(usageMemory, node.AvalibleMemory, r.Args.MaxUsage) &&
+        withinRatio(requestCpu, node.AvalibleCpu, r.maxRequests()) &&
+        withinRatio(requestMemory, node.AvalibleMemory, r.maxRequests())
+}
+
+// maxRequests is the cap on requests. The kubelet rejects pods whose requests
+// exceed allocatable resources, so it is never above 100.
+func (r Overcommit) maxRequests() int64 {
+    if r.Args.MaxRequests <= 0 || r.Args.MaxRequests > 100 {
+        return 100
+    }
+    return r.Args.MaxRequests
+}
+
+func withinRatio(sum int64, avalible int64, ratio int64) bool {
+    return ratio == 0 || sum <= avalible*ratio/100
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package overcommit
+
+import (
+    "testing"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+)
+
+func TestOvercommitCapsAreIndependent(t *testing.T) {
+    node := &types.NodeInfo{AvalibleCpu: 1000, AvalibleMemory: 1000}
+    node.AddPod(types.PodInfo{Name: "a", RequestCpu: 500, RequestMemory: 100, UsageCpu: 300, UsageMemory: 100})
+    node.AddPod(types.PodInfo{Name: "b", RequestCpu: 400, RequestMemory: 100, UsageCpu: 400, UsageMemory: 100})
+
+    cases := []struct {
+        args appsv1.OvercommitArgs
+        ok   bool
+    }{
+        {appsv1.OvercommitArgs{}, true},
+        {appsv1.OvercommitArgs{MaxRequests: 90}, true},
+        {appsv1.OvercommitArgs{MaxRequests: 80}, false},
+        {appsv1.OvercommitArgs{MaxUsage: 70, MaxRequests: 90}, true},
+        {appsv1.OvercommitArgs{MaxUsage: 60, MaxRequests: 90}, false},
+    }
+    for _, c := range cases {
+        if ok := (Overcommit{Args: c.args}).Check(node); ok != c.ok {
+            t.Errorf("%+v: expected %v, got %v", c.args, c.ok, ok)
+        }
+    }
+}
+
+func TestOvercommitKeepsRequestsWithinAllocatable(t *testing.T) {
+    node := &types.NodeInfo{AvalibleCpu: 1000, AvalibleMemory: 1000}
+    node.AddPod(types.PodInfo{Name: "a", RequestCpu: 1100, RequestMemory: 100, UsageCpu: 300, UsageMemory: 100})
+
+    for _, args := range []appsv1.OvercommitArgs{{}, {MaxRequests: 150}} {
+        if (Overcommit{Args: args}).Check(node) {
+            t.Errorf("%+v: expected requests above allocatable to be rejected", args)
+        }
+    }
+}
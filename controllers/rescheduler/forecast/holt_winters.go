@@ -0,0 +1,137 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package forecast
+
+import (
+    "math"
+)
+
+const (
+    DefaultAlpha = 0.5
+    DefaultBeta  = 0.1
+    DefaultGamma = 0.3
+)
+
+// HoltWinters is additive triple exponential smoothing. Alpha, Beta and
+// Gamma smooth the level, the trend and the season. SeasonLength is the
+// number of samples in a season, zero disables the season.
+type HoltWinters struct {
+    Alpha        float64
+    Beta         float64
+    Gamma        float64
+    SeasonLength int
+}
+
+// Quality of one-step-ahead forecasts over the history. MAPE skips zero
+// samples.
+type Quality struct {
+    MAE     float64
+    RMSE    float64
+    MAPE    float64
+    Samples int
+}
+
+type state struct {
+    level  float64
+    trend  float64
+    season []float64
+}
+
+// Forecast returns horizon values following the series and the quality of
+// the model on the series. Series shorter than two seasons are forecast
+// without the season. Forecasts are never negative.
+func (m HoltWinters) Forecast(series []float64, horizon int) ([]float64, Quality) {
+    if len(series) == 0 {
+        return make([]float64, horizon), Quality{}
+    }
+
+    seasonLength := m.SeasonLength
+    if len(series) < 2*seasonLength {
+        seasonLength = 0
+    }
+    s, start := initState(series, seasonLength)
+
+    var absSum, sqSum, pctSum float64
+    quality := Quality{}
+    pctSamples := 0
+    for t := start; t < len(series); t++ {
+        x := series[t]
+        seasonal := s.seasonal(t)
+        err := x - (s.level + s.trend + seasonal)
+        absSum += math.Abs(err)
+        sqSum += err * err
+        if x != 0 {
+            pctSum += math.Abs(err / x)
+            pctSamples++
+        }
+        quality.Samples++
+
+        level := m.Alpha*(x-seasonal) + (1-m.Alpha)*(s.level+s.trend)
+        s.trend = m.Beta*(level-s.level) + (1-m.Beta)*s.trend
+        s.level = level
+        if len(s.season) > 0 {
+            s.season[t%len(s.season)] = m.Gamma*(x-level) + (1-m.Gamma)*seasonal
+        }
+    }
+
+    if quality.Samples > 0 {
+        quality.MAE = absSum / float64(quality.Samples)
+        quality.RMSE = math.Sqrt(sqSum / float64(quality.Samples))
+    }
+    if pctSamples > 0 {
+        quality.MAPE = pctSum / float64(pctSamples)
+    }
+
+    values := make([]float64, horizon)
+    for h := 1; h <= horizon; h++ {
+        values[h-1] = math.Max(0, s.level+float64(h)*s.trend+s.seasonal(len(series)+h-1))
+    }
+    return values, quality
+}
+
+func (s *state) seasonal(t int) float64 {
+    if len(s.season) == 0 {
+        return 0
+    }
+    return s.season[t%len(s.season)]
+}
+
+// initState starts the level at the mean of the first season and the
+// trend at the average change between the first two seasons. Without a
+// season the first two samples are used. It returns the first sample to
+// smooth.
+func initState(series []float64, seasonLength int) (*state, int) {
+    if seasonLength == 0 {
+        s := &state{level: series[0]}
+        if len(series) > 1 {
+            s.trend = series[1] - series[0]
+        }
+        return s, 1
+    }
+
+    s := &state{season: make([]float64, seasonLength)}
+    for i := 0; i < seasonLength; i++ {
+        s.level += series[i]
+        s.trend += (series[i+seasonLength] - series[i]) / float64(seasonLength)
+    }
+    s.level /= float64(seasonLength)
+    s.trend /= float64(seasonLength)
+    for i := 0; i < seasonLength; i++ {
+        s.season[i] = series[i] - s.level
+    }
+    return s, seasonLength
+}
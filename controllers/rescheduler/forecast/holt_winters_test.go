@@ -0,0 +1,65 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package forecast
+
+import (
+    "math"
+    "testing"
+)
+
+func TestForecastFollowsTrend(t *testing.T) {
+    series := make([]float64, 20)
+    for i := range series {
+        series[i] = float64(100 + 10*i)
+    }
+
+    values, quality := HoltWinters{Alpha: DefaultAlpha, Beta: DefaultBeta}.Forecast(series, 3)
+    for h, v := range values {
+        if expected := float64(100 + 10*(20+h)); math.Abs(v-expected) > 1 {
+            t.Errorf("step %d: expected %v, got %v", h+1, expected, v)
+        }
+    }
+    if quality.Samples != 19 || quality.MAPE > 0.01 {
+        t.Errorf("expected an exact fit, got %+v", quality)
+    }
+}
+
+func TestForecastRepeatsSeason(t *testing.T) {
+    const seasonLength = 24
+    series := make([]float64, 4*seasonLength)
+    for i := range series {
+        series[i] = 500 + 300*math.Sin(2*math.Pi*float64(i)/seasonLength)
+    }
+
+    model := HoltWinters{Alpha: DefaultAlpha, Beta: DefaultBeta, Gamma: DefaultGamma, SeasonLength: seasonLength}
+    values, quality := model.Forecast(series, seasonLength)
+    for h, v := range values {
+        expected := 500 + 300*math.Sin(2*math.Pi*float64(len(series)+h)/seasonLength)
+        if math.Abs(v-expected) > 50 {
+            t.Errorf("step %d: expected about %v, got %v", h+1, expected, v)
+        }
+    }
+    if quality.MAPE > 0.1 {
+        t.Errorf("expected a good fit, got %+v", quality)
+    }
+
+    // Without two seasons of history the season is ignored.
+    values, _ = model.Forecast(series[:seasonLength], 1)
+    if len(values) != 1 || values[0] < 0 {
+        t.Errorf("expected a non-negative forecast, got %v", values)
+    }
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package forecast
+
+import (
+    "github.com/prometheus/client_golang/prometheus"
+    "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+    mapeGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "planner_forecast_mape",
+        Help: "Mean absolute percentage error of one-step-ahead usage forecasts, averaged over pods.",
+    }, []string{"resource"})
+    rmseGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "planner_forecast_rmse",
+        Help: "Root mean squared error of one-step-ahead usage forecasts in millicores or bytes, averaged over pods.",
+    }, []string{"resource"})
+    podsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+        Name: "planner_forecast_pods",
+        Help: "Number of pods sized by usage forecasts in the last plan.",
+    })
+)
+
+func init() {
+    metrics.Registry.MustRegister(mapeGauge, rmseGauge, podsGauge)
+}
+
+// Report exposes the average quality of forecasts of a resource.
+func Report(resource string, qualities []Quality) {
+    mape, rmse := float64(0), float64(0)
+    for _, q := range qualities {
+        mape += q.MAPE
+        rmse += q.RMSE
+    }
+    if len(qualities) > 0 {
+        mape /= float64(len(qualities))
+        rmse /= float64(len(qualities))
+    }
+    mapeGauge.WithLabelValues(resource).Set(mape)
+    rmseGauge.WithLabelValues(resource).Set(rmse)
+}
+
+func ReportPods(count int) {
+    podsGauge.Set(float64(count))
+}
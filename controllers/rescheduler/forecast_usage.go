@@ -0,0 +1,132 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rescheduler
+
+import (
+    "math"
+    "sort"
+    "strconv"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    helper "github.com/miha3009/planner/controllers/helper"
+    "github.com/miha3009/planner/controllers/rescheduler/forecast"
+    "github.com/prometheus/common/log"
+)
+
+// A forecast needs a trend, which takes a few samples.
+const minForecastSamples = 4
+
+// forecastUsage returns the peak of usage forecast over the horizon for
+// pods with enough history and reports the quality of the forecasts.
+func forecastUsage(series map[string]*usageSeries, args *appsv1.ForecastArgs, horizon time.Duration) map[string]podUsage {
+    if args == nil {
+        args = &appsv1.ForecastArgs{}
+    }
+    model := forecast.HoltWinters{
+        Alpha: parseSmoothing("alpha", args.Alpha, forecast.DefaultAlpha),
+        Beta:  parseSmoothing("beta", args.Beta, forecast.DefaultBeta),
+        Gamma: parseSmoothing("gamma", args.Gamma, forecast.DefaultGamma),
+    }
+
+    usage := make(map[string]podUsage)
+    cpuQuality := make([]forecast.Quality, 0)
+    memoryQuality := make([]forecast.Quality, 0)
+    for name, s := range series {
+        step := gridStep(s.Times)
+        if len(s.Cpu) < minForecastSamples || step <= 0 {
+            continue
+        }
+        cpuSeries := resample(s.Times, s.Cpu, step, helper.Mean)
+        memorySeries := resample(s.Times, s.Memory, step, helper.Max)
+        if len(cpuSeries) < minForecastSamples {
+            continue
+        }
+
+        m := model
+        m.SeasonLength = int(math.Round(float64(args.Season) * float64(time.Second) / float64(step)))
+        steps := int(math.Ceil(float64(horizon) / float64(step)))
+        if steps < 1 {
+            steps = 1
+        }
+
+        cpu, cpuQ := m.Forecast(cpuSeries, steps)
+        memory, memoryQ := m.Forecast(memorySeries, steps)
+        usage[name] = podUsage{Cpu: int64(math.Ceil(helper.Max(cpu))), Memory: int64(math.Ceil(helper.Max(memory)))}
+        cpuQuality = append(cpuQuality, cpuQ)
+        memoryQuality = append(memoryQuality, memoryQ)
+    }
+
+    forecast.Report("cpu", cpuQuality)
+    forecast.Report("memory", memoryQuality)
+    forecast.ReportPods(len(usage))
+    return usage
+}
+
+func parseSmoothing(name string, value string, defaultValue float64) float64 {
+    if value == "" {
+        return defaultValue
+    }
+    factor, err := strconv.ParseFloat(value, 64)
+    if err != nil || factor < 0 || factor > 1 {
+        log.Info("Forecast ", name, " must be between 0 and 1, ", defaultValue, " is used")
+        return defaultValue
+    }
+    return factor
+}
+
+// gridStep is the step of the grid that series are resampled onto, as the
+// model needs equally spaced samples. It is the median interval of the older
+// half of the series, because old samples may be merged or loaded at a
+// coarser step than recent ones.
+func gridStep(times []time.Time) time.Duration {
+    if len(times) < 2 {
+        return 0
+    }
+    older := times[:len(times)/2+1]
+    intervals := make([]time.Duration, len(older)-1)
+    for i := 1; i < len(older); i++ {
+        intervals[i-1] = older[i].Sub(older[i-1])
+    }
+    sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+    return intervals[len(intervals)/2]
+}
+
+// resample puts values onto a grid of the step starting at the first sample.
+// Samples within one step are combined by merge, and steps without samples
+// are interpolated from their neighbours.
+func resample(times []time.Time, values []float64, step time.Duration, merge func([]float64) float64) []float64 {
+    buckets := make([][]float64, int(times[len(times)-1].Sub(times[0])/step)+1)
+    for i := range times {
+        k := int(times[i].Sub(times[0]) / step)
+        buckets[k] = append(buckets[k], values[i])
+    }
+
+    res := make([]float64, len(buckets))
+    last := -1
+    for k := range buckets {
+        if len(buckets[k]) == 0 {
+            continue
+        }
+        res[k] = merge(buckets[k])
+        for j := last + 1; j < k; j++ {
+            res[j] = res[last] + (res[k]-res[last])*float64(j-last)/float64(k-last)
+        }
+        last = k
+    }
+    return res
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodepolicies
+
+import (
+    "strings"
+    "time"
+
+    types "github.com/miha3009/planner/controllers/types"
+)
+
+const scaleDownDisabledAnnotation = "cluster-autoscaler.kubernetes.io/scale-down-disabled"
+
+// DeletionGuard decides whether a node may be deleted
+// in addition to the nodes already chosen for deletion.
+type DeletionGuard interface {
+    CanDelete(node *types.NodeInfo, deleted []types.NodeInfo) bool
+}
+
+func canDelete(guards []DeletionGuard, node *types.NodeInfo, deleted []types.NodeInfo) bool {
+    for _, guard := range guards {
+        if !guard.CanDelete(node, deleted) {
+            return false
+        }
+    }
+    return true
+}
+
+// NodeGroupGuard keeps cluster-autoscaler node groups at or above their
+// minimum size. Nodes outside of known groups and nodes with scale-down
+// disabled are never deleted, because the autoscaler would not remove them.
+type NodeGroupGuard struct {
+    Groups map[string]types.NodeGroup
+    Label  string
+}
+
+func (g *NodeGroupGuard) CanDelete(node *types.NodeInfo, deleted []types.NodeInfo) bool {
+    group, ok := g.groupOf(node)
+    if !ok || node.Node.Annotations[scaleDownDisabledAnnotation] == "true" {
+        return false
+    }
+
+    count := 0
+    for i := range deleted {
+        if other, ok := g.groupOf(&deleted[i]); ok && other.Name == group.Name {
+            count++
+        }
+    }
+    return group.TargetSize-count-1 >= group.MinSize
+}
+
+// groupOf finds the group by the node label. Groups of some cloud providers
+// are named by URLs, so the label may also match the last part of the name.
+func (g *NodeGroupGuard) groupOf(node *types.NodeInfo) (types.NodeGroup, bool) {
+    if node.Node == nil {
+        return types.NodeGroup{}, false
+    }
+    value := node.Node.Labels[g.Label]
+    if value == "" {
+        return types.NodeGroup{}, false
+    }
+
+    if group, ok := g.Groups[value]; ok {
+        return group, true
+    }
+    for name, group := range g.Groups {
+        if strings.HasSuffix(name, "/"+value) {
+            return group, true
+        }
+    }
+    return types.NodeGroup{}, false
+}
+
+// NodeAgeGuard keeps nodes created less than MinAge before Now.
+type NodeAgeGuard struct {
+    MinAge time.Duration
+    Now    time.Time
+}
+
+func (g *NodeAgeGuard) CanDelete(node *types.NodeInfo, deleted []types.NodeInfo) bool {
+    if node.Node == nil {
+        return false
+    }
+    return g.Now.Sub(node.Node.CreationTimestamp.Time) >= g.MinAge
+}
+
+// UtilizationGuard keeps nodes whose usage is at or above Threshold,
+// which is a share from 0 to 1.
+type UtilizationGuard struct {
+    Threshold float64
+}
+
+func (g *UtilizationGuard) CanDelete(node *types.NodeInfo, deleted []types.NodeInfo) bool {
+    return node.Usage() < g.Threshold
+}
+
+// ProtectedLabelGuard keeps nodes that have the label.
+type ProtectedLabelGuard struct {
+    Label string
+}
+
+func (g *ProtectedLabelGuard) CanDelete(node *types.NodeInfo, deleted []types.NodeInfo) bool {
+    if node.Node == nil {
+        return true
+    }
+    _, ok := node.Node.Labels[g.Label]
+    return !ok
+}
+
+// DeletionBudgetGuard limits the number of nodes deleted by a plan.
+type DeletionBudgetGuard struct {
+    Remaining int
+}
+
+func (g *DeletionBudgetGuard) CanDelete(node *types.NodeInfo, deleted []types.NodeInfo) bool {
+    return len(deleted) < g.Remaining
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodepolicies
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func nodeCreatedAt(name string, created time.Time, labels map[string]string) types.NodeInfo {
+    node := testNode(name, 1000, nil)
+    node.Node = &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+        Name:              name,
+        Labels:            labels,
+        CreationTimestamp: metav1.NewTime(created),
+    }}
+    return node
+}
+
+func TestScaleDownGuards(t *testing.T) {
+    now := time.Now()
+    old := nodeCreatedAt("old", now.Add(-time.Hour), nil)
+    young := nodeCreatedAt("young", now.Add(-time.Minute), nil)
+    protected := nodeCreatedAt("protected", now.Add(-time.Hour), map[string]string{"planner.hse.ru/protected": ""})
+    busy := nodeCreatedAt("busy", now.Add(-time.Hour), nil)
+    busy.AddPod(types.PodInfo{Cpu: 800})
+
+    guards := []DeletionGuard{
+        &NodeAgeGuard{MinAge: time.Minute * 10, Now: now},
+        &UtilizationGuard{Threshold: 0.5},
+        &ProtectedLabelGuard{Label: "planner.hse.ru/protected"},
+        &DeletionBudgetGuard{Remaining: 1},
+    }
+
+    if !canDelete(guards, &old, nil) {
+        t.Errorf("expected old idle node to be deletable")
+    }
+    if canDelete(guards, &old, []types.NodeInfo{young}) {
+        t.Errorf("expected deletion budget to be respected")
+    }
+    for _, node := range []types.NodeInfo{young, protected, busy} {
+        if canDelete(guards, &node, nil) {
+            t.Errorf("expected node %s to be kept", node.Name)
+        }
+    }
+}
+
+func TestShrinkKeepsGuardedNodes(t *testing.T) {
+    now := time.Now()
+    nodes := []types.NodeInfo{
+        nodeCreatedAt("a", now.Add(-time.Hour), nil),
+        nodeCreatedAt("b", now, nil),
+        nodeCreatedAt("c", now, nil),
+    }
+    nodes[0].AddPod(types.PodInfo{Cpu: 100})
+
+    policy := &ShrinkNodePolicy{MaxNodes: 10, Guards: []DeletionGuard{&NodeAgeGuard{MinAge: time.Minute, Now: now}}}
+    _, _, nodesToDelete := policy.Run(context.Background(), &firstFitAlgorithm{}, nodes)
+    if len(nodesToDelete) != 1 || nodesToDelete[0].Name != "a" {
+        t.Errorf("expected only the old node to be deleted, got %v", nodesToDelete)
+    }
+}
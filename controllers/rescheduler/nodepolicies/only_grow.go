@@ -27,6 +27,7 @@ import (
 
 type OnlyGrowNodePolicy struct{
     MaxNodes int
+    Pools []types.NodePool
 }
 
 func (a *OnlyGrowNodePolicy) Run(ctx context.Context, algo algorithm.Algorithm, nodes []types.NodeInfo) ([]types.NodeInfo, []types.NodeInfo, []types.NodeInfo) {
@@ -35,20 +36,45 @@ func (a *OnlyGrowNodePolicy) Run(ctx context.Context, algo algorithm.Algorithm,
     }
 
     newNodes, ok := algo.Run(ctx, nodes, []types.PodInfo{})
-    if !ok {
-        return grow(ctx, algo, newNodes, a.MaxNodes)
+    if !ok || underfilledPools(newNodes, a.Pools) {
+        return grow(ctx, algo, newNodes, a.MaxNodes, a.Pools)
     }
 
     return newNodes, nil, nil
 }
 
-func grow(ctx context.Context, algo algorithm.Algorithm, nodes []types.NodeInfo, maxNodes int) ([]types.NodeInfo, []types.NodeInfo, []types.NodeInfo) {
-    nodesToCreate := make([]types.NodeInfo, 0)
+// grow adds nodes until all pods fit. With node pools it first brings every
+// pool to its minimum size, then every new node is taken from the pool chosen
+// by addPoolNode, otherwise it is a copy of the first node.
+func grow(ctx context.Context, algo algorithm.Algorithm, nodes []types.NodeInfo, maxNodes int, pools []types.NodePool) ([]types.NodeInfo, []types.NodeInfo, []types.NodeInfo) {
+    nodes, nodesToCreate := fillPools(nodes, pools, maxNodes)
+    if len(nodesToCreate) > 0 {
+        newNodes, ok := algo.Run(ctx, nodes, []types.PodInfo{})
+        if ok {
+            return newNodes, nodesToCreate, nil
+        }
+        nodes = newNodes
+    }
+
     for {
         if helper.ContextEnded(ctx) || len(nodes) >= maxNodes {
             return nodes, nodesToCreate, nil
         }
 
+        if len(pools) > 0 {
+            growable := growablePools(nodes, pools)
+            if len(growable) == 0 {
+                return nodes, nodesToCreate, nil
+            }
+            newNodes, newNode, ok := addPoolNode(ctx, algo, nodes, growable, len(nodesToCreate))
+            nodesToCreate = append(nodesToCreate, newNode)
+            if ok {
+                return newNodes, nodesToCreate, nil
+            }
+            nodes = newNodes
+            continue
+        }
+
         newNode := genNewNode(nodes, len(nodesToCreate))
         nodesToCreate = append(nodesToCreate, newNode)
         nodes = append(nodes, newNode)
@@ -63,11 +89,12 @@ func grow(ctx context.Context, algo algorithm.Algorithm, nodes []types.NodeInfo,
 
 func genNewNode(nodes []types.NodeInfo, num int) types.NodeInfo {
     return types.NodeInfo{
-        Name:           strconv.Itoa(num),
+        Name:           types.NewNodeName(strconv.Itoa(num)),
         MaxCpu:         nodes[0].MaxCpu,
         MaxMemory:      nodes[0].MaxMemory,
         AvalibleCpu:    nodes[0].MaxCpu,
         AvalibleMemory: nodes[0].MaxMemory,
         Pods:           []types.PodInfo{},
+        HourlyCost:     nodes[0].HourlyCost,
     }
 }
@@ -0,0 +1,186 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodepolicies
+
+import (
+    "context"
+    "strconv"
+
+    "github.com/miha3009/planner/controllers/helper"
+    algorithm "github.com/miha3009/planner/controllers/rescheduler/algorithm"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// newPoolNode builds a node of the pool. It carries labels and taints of
+// the pool, so constraints evaluate it like a real node, and the pool name,
+// so node drivers know which pool to grow.
+func newPoolNode(pool *types.NodePool, num int) types.NodeInfo {
+    name := types.NewNodeName(pool.Name + "-" + strconv.Itoa(num))
+    capacity := corev1.ResourceList{
+        corev1.ResourceCPU:    *resource.NewMilliQuantity(pool.Cpu, resource.DecimalSI),
+        corev1.ResourceMemory: *resource.NewQuantity(pool.Memory, resource.BinarySI),
+    }
+
+    node := &corev1.Node{}
+    node.Name = name
+    node.Annotations = map[string]string{types.PoolAnnotation: pool.Name}
+    node.Labels = make(map[string]string)
+    for key, value := range pool.Labels {
+        node.Labels[key] = value
+    }
+    node.Spec.Taints = append([]corev1.Taint{}, pool.Taints...)
+    node.Status.Capacity = capacity
+    node.Status.Allocatable = capacity.DeepCopy()
+
+    return types.NodeInfo{
+        Node:           node,
+        Name:           name,
+        MaxCpu:         pool.Cpu,
+        MaxMemory:      pool.Memory,
+        AvalibleCpu:    pool.Cpu,
+        AvalibleMemory: pool.Memory,
+        Pods:           []types.PodInfo{},
+        Pool:           pool,
+        HourlyCost:     pool.HourlyCost,
+    }
+}
+
+func poolSize(nodes []types.NodeInfo, pool *types.NodePool) int {
+    size := 0
+    for i := range nodes {
+        if nodes[i].Pool != nil && nodes[i].Pool.Name == pool.Name {
+            size++
+        }
+    }
+    return size
+}
+
+// growablePools returns pools that have not reached their maximum size.
+func growablePools(nodes []types.NodeInfo, pools []types.NodePool) []*types.NodePool {
+    growable := make([]*types.NodePool, 0, len(pools))
+    for i := range pools {
+        if pools[i].MaxNodes == 0 || poolSize(nodes, &pools[i]) < pools[i].MaxNodes {
+            growable = append(growable, &pools[i])
+        }
+    }
+    return growable
+}
+
+// underfilledPools reports whether a pool has fewer nodes than its minimum.
+func underfilledPools(nodes []types.NodeInfo, pools []types.NodePool) bool {
+    for i := range pools {
+        if poolSize(nodes, &pools[i]) < pools[i].MinNodes {
+            return true
+        }
+    }
+    return false
+}
+
+// fillPools adds nodes to pools below their minimum size while the cluster
+// has fewer than maxNodes nodes. It returns all nodes and the added ones.
+func fillPools(nodes []types.NodeInfo, pools []types.NodePool, maxNodes int) ([]types.NodeInfo, []types.NodeInfo) {
+    added := make([]types.NodeInfo, 0)
+    for i := range pools {
+        for poolSize(nodes, &pools[i]) < pools[i].MinNodes && len(nodes) < maxNodes {
+            newNode := newPoolNode(&pools[i], len(added))
+            added = append(added, newNode)
+            nodes = append(nodes, newNode)
+        }
+    }
+    return nodes, added
+}
+
+// addPoolNode tries a new node of every pool and keeps the cheapest one
+// that lets all pods fit. If none does, it adds a node of the pool with
+// the cheapest cpu and reports false.
+func addPoolNode(ctx context.Context, algo algorithm.Algorithm, nodes []types.NodeInfo, pools []*types.NodePool, num int) ([]types.NodeInfo, types.NodeInfo, bool) {
+    var bestNodes []types.NodeInfo
+    var bestNode types.NodeInfo
+    var bestPool *types.NodePool
+    for _, pool := range pools {
+        if helper.ContextEnded(ctx) {
+            break
+        }
+
+        newNode := newPoolNode(pool, num)
+        newNodes, ok := algo.Run(ctx, append(helper.DeepCopyNodes(nodes), newNode), []types.PodInfo{})
+        if ok && (bestPool == nil || cheaper(pool, bestPool)) {
+            bestNodes, bestNode, bestPool = newNodes, newNode, pool
+        }
+    }
+    if bestPool != nil {
+        return bestNodes, bestNode, true
+    }
+
+    pool := pools[0]
+    for _, other := range pools[1:] {
+        if cpuCost(other) < cpuCost(pool) || (cpuCost(other) == cpuCost(pool) && other.Cpu > pool.Cpu) {
+            pool = other
+        }
+    }
+    newNode := newPoolNode(pool, num)
+    newNodes, _ := algo.Run(ctx, append(helper.DeepCopyNodes(nodes), newNode), []types.PodInfo{})
+    return newNodes, newNode, false
+}
+
+func cheaper(a *types.NodePool, b *types.NodePool) bool {
+    if a.HourlyCost != b.HourlyCost {
+        return a.HourlyCost < b.HourlyCost
+    }
+    return a.Cpu < b.Cpu || (a.Cpu == b.Cpu && a.Memory < b.Memory)
+}
+
+func cpuCost(pool *types.NodePool) float64 {
+    if pool.Cpu == 0 {
+        return 0
+    }
+    return pool.HourlyCost / float64(pool.Cpu)
+}
+
+// PoolGuard keeps node pools at or above their minimum size.
+type PoolGuard struct {
+    sizes map[string]int
+}
+
+func NewPoolGuard(nodes []types.NodeInfo, pools []types.NodePool) *PoolGuard {
+    g := &PoolGuard{sizes: make(map[string]int)}
+    for i := range pools {
+        g.sizes[pools[i].Name] = poolSize(nodes, &pools[i])
+    }
+    return g
+}
+
+func (g *PoolGuard) CanDelete(node *types.NodeInfo, deleted []types.NodeInfo) bool {
+    if node.Pool == nil {
+        return true
+    }
+
+    count := 0
+    for i := range deleted {
+        if deleted[i].Pool != nil && deleted[i].Pool.Name == node.Pool.Name {
+            count++
+        }
+    }
+    return g.sizes[node.Pool.Name]-count-1 >= node.Pool.MinNodes
+}
+
+// deletionScore is higher for expensive nodes that are barely used.
+func deletionScore(node *types.NodeInfo) float64 {
+    return node.HourlyCost * (1 - node.Usage())
+}
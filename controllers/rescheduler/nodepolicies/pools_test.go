@@ -0,0 +1,159 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodepolicies
+
+import (
+    "context"
+    "testing"
+
+    "github.com/miha3009/planner/controllers/helper"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// firstFitAlgorithm moves pods off overloaded nodes to the first node
+// with enough free cpu.
+type firstFitAlgorithm struct{}
+
+func (a *firstFitAlgorithm) Run(ctx context.Context, nodes []types.NodeInfo, freePods []types.PodInfo) ([]types.NodeInfo, bool) {
+    nodes = helper.DeepCopyNodes(nodes)
+    pods := helper.DeepCopyPods(freePods)
+    for i := range nodes {
+        for nodes[i].PodsCpu > nodes[i].AvalibleCpu {
+            pod := nodes[i].Pods[len(nodes[i].Pods)-1]
+            nodes[i].RemovePod(pod)
+            pods = append(pods, pod)
+        }
+    }
+
+    ok := true
+    for _, pod := range pods {
+        placed := false
+        for i := range nodes {
+            if nodes[i].PodsCpu+pod.Cpu <= nodes[i].AvalibleCpu {
+                nodes[i].AddPod(pod)
+                placed = true
+                break
+            }
+        }
+        ok = ok && placed
+    }
+    return nodes, ok
+}
+
+func testNode(name string, cpu int64, pool *types.NodePool, pods ...int64) types.NodeInfo {
+    node := types.NodeInfo{Name: name, MaxCpu: cpu, AvalibleCpu: cpu, MaxMemory: 1000, AvalibleMemory: 1000, Pool: pool}
+    if pool != nil {
+        node.HourlyCost = pool.HourlyCost
+    }
+    for _, podCpu := range pods {
+        node.AddPod(types.PodInfo{Cpu: podCpu})
+    }
+    return node
+}
+
+func TestGrowPicksCheapestPool(t *testing.T) {
+    pools := []types.NodePool{
+        {Name: "large", Cpu: 4000, Memory: 1000, HourlyCost: 3},
+        {Name: "small", Cpu: 1000, Memory: 1000, HourlyCost: 1, Labels: map[string]string{"pool": "small"},
+            Taints: []corev1.Taint{{Key: "dedicated", Value: "small", Effect: corev1.TaintEffectNoSchedule}}},
+    }
+    nodes := []types.NodeInfo{testNode("a", 1000, nil, 750, 750)}
+
+    policy := &OnlyGrowNodePolicy{MaxNodes: 10, Pools: pools}
+    _, nodesToCreate, _ := policy.Run(context.Background(), &firstFitAlgorithm{}, nodes)
+    if len(nodesToCreate) != 1 || nodesToCreate[0].Pool.Name != "small" {
+        t.Fatalf("expected a node of the small pool, got %v", nodesToCreate)
+    }
+    node := nodesToCreate[0].Node
+    if node.Labels["pool"] != "small" || len(node.Spec.Taints) != 1 || node.Annotations[types.PoolAnnotation] != "small" {
+        t.Errorf("expected new node to carry labels, taints and name of its pool")
+    }
+}
+
+func TestGrowRespectsPoolMaxNodes(t *testing.T) {
+    small := types.NodePool{Name: "small", Cpu: 1000, Memory: 1000, HourlyCost: 1, MaxNodes: 1, Labels: map[string]string{"pool": "small"}}
+    pools := []types.NodePool{small, {Name: "large", Cpu: 4000, Memory: 1000, HourlyCost: 3}}
+    nodes := []types.NodeInfo{testNode("a", 1000, &pools[0], 750, 750)}
+
+    policy := &OnlyGrowNodePolicy{MaxNodes: 10, Pools: pools}
+    _, nodesToCreate, _ := policy.Run(context.Background(), &firstFitAlgorithm{}, nodes)
+    if len(nodesToCreate) != 1 || nodesToCreate[0].Pool.Name != "large" {
+        t.Fatalf("expected a node of the large pool, got %v", nodesToCreate)
+    }
+}
+
+func TestGrowFillsPoolsToMinNodes(t *testing.T) {
+    pools := []types.NodePool{
+        {Name: "workers", Cpu: 1000, Memory: 1000, HourlyCost: 1},
+        {Name: "system", Cpu: 1000, Memory: 1000, HourlyCost: 1, MinNodes: 2, Labels: map[string]string{"pool": "system"}},
+    }
+    nodes := []types.NodeInfo{testNode("a", 1000, &pools[0], 500), testNode("b", 1000, &pools[1])}
+
+    for _, policy := range []NodePolicy{
+        &OnlyGrowNodePolicy{MaxNodes: 10, Pools: pools},
+        &ShrinkNodePolicy{MaxNodes: 10, Pools: pools},
+    } {
+        _, nodesToCreate, nodesToDelete := policy.Run(context.Background(), &firstFitAlgorithm{}, nodes)
+        if len(nodesToCreate) != 1 || nodesToCreate[0].Pool.Name != "system" || len(nodesToDelete) != 0 {
+            t.Errorf("%T: expected a node of the system pool, got %v", policy, nodesToCreate)
+        }
+    }
+
+    policy := &OnlyGrowNodePolicy{MaxNodes: 2, Pools: pools}
+    if _, nodesToCreate, _ := policy.Run(context.Background(), &firstFitAlgorithm{}, nodes); len(nodesToCreate) != 0 {
+        t.Errorf("expected max nodes to stop filling pools, got %v", nodesToCreate)
+    }
+}
+
+func TestShrinkPrefersExpensiveUnderusedNodes(t *testing.T) {
+    cheap := &types.NodePool{Name: "cheap", HourlyCost: 1}
+    expensive := &types.NodePool{Name: "expensive", HourlyCost: 5}
+    nodes := []types.NodeInfo{
+        testNode("a", 1000, cheap, 100),
+        testNode("b", 1000, expensive, 900),
+        testNode("c", 1000, expensive, 200),
+    }
+
+    if i := choseNodeForDelete(nodes, func(i int) bool { return true }); i != 2 {
+        t.Errorf("expected node c to be chosen, got %d", i)
+    }
+}
+
+func TestPoolGuardKeepsMinNodes(t *testing.T) {
+    pools := []types.NodePool{{Name: "workers", MinNodes: 1}}
+    nodes := []types.NodeInfo{testNode("a", 1000, &pools[0]), testNode("b", 1000, &pools[0])}
+    guard := NewPoolGuard(nodes, pools)
+
+    if !guard.CanDelete(&nodes[0], nil) {
+        t.Errorf("expected one node of the pool to be deletable")
+    }
+    if guard.CanDelete(&nodes[1], nodes[:1]) {
+        t.Errorf("expected the last node of the pool to be kept")
+    }
+}
+
+func TestPoolNodeNamesDoNotCollide(t *testing.T) {
+    pool := &types.NodePool{Name: "node", Cpu: 1000, Memory: 1000}
+    node := newPoolNode(pool, 1)
+    if node.Name == "node-1" || !types.IsNewNode(node.Node) {
+        t.Errorf("expected a reserved name for the planned node, got %s", node.Name)
+    }
+    if node.Node.Annotations[types.PoolAnnotation] != "node" {
+        t.Errorf("expected the planned node to keep the pool name")
+    }
+}
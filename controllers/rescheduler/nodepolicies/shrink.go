@@ -23,11 +23,14 @@ import (
     "github.com/miha3009/planner/controllers/helper"
     algorithm "github.com/miha3009/planner/controllers/rescheduler/algorithm"
     types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
 )
 
 type ShrinkNodePolicy struct{
     Optimizer *algorithm.Optimizer
     MaxNodes int
+    Guards []DeletionGuard
+    Pools []types.NodePool
 }
 
 func (a *ShrinkNodePolicy) Run(ctx context.Context, algo algorithm.Algorithm, nodes []types.NodeInfo) ([]types.NodeInfo, []types.NodeInfo, []types.NodeInfo) {
@@ -36,48 +39,88 @@ func (a *ShrinkNodePolicy) Run(ctx context.Context, algo algorithm.Algorithm, no
     }
 
     newNodes, ok := algo.Run(ctx, nodes, []types.PodInfo{})
-    if ok {
+    if ok && !underfilledPools(newNodes, a.Pools) {
         nodes = newNodes
+        guards := a.Guards
+        if len(a.Pools) > 0 {
+            guards = append(append([]DeletionGuard{}, a.Guards...), NewPoolGuard(nodes, a.Pools))
+        }
         if a.Optimizer != nil {
             newNodes = a.Optimizer.Optimize(ctx, nodes)
             if len(nodes) == len(newNodes) {
                 return nodes, nil, nil
-            } else {
-                nodesToDelete := getDiffNodes(nodes, newNodes)
-                return newNodes, nil, nodesToDelete
             }
-        } else {
-            nodesToDelete := make([]types.NodeInfo, 0)
-            for {
-                if helper.ContextEnded(ctx) || len(nodes) == 1 {
-                    return nodes, nil, nodesToDelete
-                }
-
-                nodeI := choseNodeForDelete(nodes)
-                newNodes = helper.DeepCopyNodes(nodes)
-                newNodes = append(newNodes[:nodeI], newNodes[nodeI+1:]...)
-                newNodes, ok = algo.Run(ctx, newNodes, helper.DeepCopyPods(nodes[nodeI].Pods))
-                if ok {
-                    nodesToDelete = append(nodesToDelete, nodes[nodeI])
-                    nodes = newNodes
-                } else {
-                    return nodes, nil, nodesToDelete
-                }
+            nodesToDelete := getDiffNodes(nodes, newNodes)
+            if canDeleteAll(guards, nodesToDelete) {
+                return newNodes, nil, nodesToDelete
             }
+            log.Info("Optimizer result deletes protected nodes, falling back to the greedy shrink")
         }
+        return shrink(ctx, algo, nodes, guards)
     } else {
-        return grow(ctx, algo, newNodes, a.MaxNodes)
+        return grow(ctx, algo, newNodes, a.MaxNodes, a.Pools)
     }
 }
 
-func choseNodeForDelete(nodes []types.NodeInfo) int {
+func shrink(ctx context.Context, algo algorithm.Algorithm, nodes []types.NodeInfo, guards []DeletionGuard) ([]types.NodeInfo, []types.NodeInfo, []types.NodeInfo) {
+    nodesToDelete := make([]types.NodeInfo, 0)
+    for {
+        if helper.ContextEnded(ctx) || len(nodes) == 1 {
+            return nodes, nil, nodesToDelete
+        }
+        nodeI := choseNodeForDelete(nodes, func(i int) bool {
+            return canDelete(guards, &nodes[i], nodesToDelete)
+        })
+        if nodeI == -1 {
+            return nodes, nil, nodesToDelete
+        }
+        newNodes := helper.DeepCopyNodes(nodes)
+        newNodes = append(newNodes[:nodeI], newNodes[nodeI+1:]...)
+        newNodes, ok := algo.Run(ctx, newNodes, helper.DeepCopyPods(nodes[nodeI].Pods))
+        if ok {
+            nodesToDelete = append(nodesToDelete, nodes[nodeI])
+            nodes = newNodes
+        } else {
+            return nodes, nil, nodesToDelete
+        }
+    }
+}
+
+func canDeleteAll(guards []DeletionGuard, nodesToDelete []types.NodeInfo) bool {
+    for i := range nodesToDelete {
+        if !canDelete(guards, &nodesToDelete[i], nodesToDelete[:i]) {
+            return false
+        }
+    }
+    return true
+}
+
+// choseNodeForDelete prefers an empty node, then the most expensive
+// under-used one, and otherwise picks a random one among the allowed nodes.
+// It returns -1 if no node is allowed.
+func choseNodeForDelete(nodes []types.NodeInfo, allowed func(i int) bool) int {
+    candidates := make([]int, 0, len(nodes))
+    best, bestScore := -1, float64(0)
     for i := range nodes {
+        if !allowed(i) {
+            continue
+        }
         if len(nodes[i].Pods) == 0 {
             return i
         }
+        candidates = append(candidates, i)
+        if score := deletionScore(&nodes[i]); score > bestScore {
+            best, bestScore = i, score
+        }
     }
 
-    return rand.Intn(len(nodes))
+    if best != -1 {
+        return best
+    }
+    if len(candidates) == 0 {
+        return -1
+    }
+    return candidates[rand.Intn(len(candidates))]
 }
 
 func getDiffNodes(oldNodes []types.NodeInfo, newNodes []types.NodeInfo) []types.NodeInfo {
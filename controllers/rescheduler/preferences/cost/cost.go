@@ -0,0 +1,50 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cost
+
+import (
+    types "github.com/miha3009/planner/controllers/types"
+)
+
+// Cost prefers placements that leave expensive nodes free. A node with pods
+// costs half of its price plus the used share of the other half, so that
+// pods move to cheaper nodes even before an expensive node is empty.
+type Cost struct{}
+
+func (r Cost) Init(node *types.NodeInfo) {
+}
+
+func (r Cost) AddPod(node *types.NodeInfo, pod *types.PodInfo) {
+}
+
+func (r Cost) RemovePod(node *types.NodeInfo, pod *types.PodInfo) {
+}
+
+func (r Cost) Apply(nodes []types.NodeInfo) float64 {
+    total, used := float64(0), float64(0)
+    for i := range nodes {
+        total += nodes[i].HourlyCost
+        if len(nodes[i].Pods) > 0 {
+            used += nodes[i].HourlyCost * (0.5 + 0.5*nodes[i].Usage())
+        }
+    }
+
+    if total == 0 {
+        return types.MaxPreferenceScore
+    }
+    return types.MaxPreferenceScore * (1 - used/total)
+}
@@ -19,6 +19,7 @@ package preferences
 import (
     appsv1 "github.com/miha3009/planner/api/v1"
     balanced "github.com/miha3009/planner/controllers/rescheduler/preferences/balanced"
+    cost "github.com/miha3009/planner/controllers/rescheduler/preferences/cost"
     economy "github.com/miha3009/planner/controllers/rescheduler/preferences/economy"
     perfomance "github.com/miha3009/planner/controllers/rescheduler/preferences/perfomance"
     topologyspread "github.com/miha3009/planner/controllers/rescheduler/preferences/topologyspread"
@@ -54,6 +55,11 @@ func ConvertArgs(prf *appsv1.PreferenceArgsList) PreferenceList {
         weights = append(weights, float64(prf.TopologySpread.Weight))
     }
 
+    if prf.Cost != nil {
+        items = append(items, cost.Cost{})
+        weights = append(weights, float64(prf.Cost.Weight))
+    }
+
     weightSum := float64(0)
     for _, weight := range weights {
         weightSum += weight
@@ -0,0 +1,123 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+    "strconv"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+)
+
+const HoursPerMonth = float64(730)
+
+type Price struct {
+    Selector map[string]string
+    OnDemand float64
+    Spot     float64
+}
+
+// Model prices nodes by their labels.
+type Model struct {
+    Prices       []Price
+    SpotSelector map[string]string
+    Default      float64
+}
+
+// ConvertArgs returns nil if the cost model is not configured.
+func ConvertArgs(args *appsv1.CostModelArgs) *Model {
+    if args == nil {
+        return nil
+    }
+
+    m := &Model{SpotSelector: args.SpotSelector, Default: parseCost(args.DefaultHourlyCost)}
+    for _, price := range args.Prices {
+        onDemand := parseCost(price.HourlyCost)
+        spot := onDemand
+        if price.SpotHourlyCost != "" {
+            spot = parseCost(price.SpotHourlyCost)
+        }
+        m.Prices = append(m.Prices, Price{Selector: price.Selector, OnDemand: onDemand, Spot: spot})
+    }
+    return m
+}
+
+func parseCost(cost string) float64 {
+    if cost == "" {
+        return 0
+    }
+    value, err := strconv.ParseFloat(cost, 64)
+    if err != nil {
+        log.Info("Invalid hourly cost ", cost, ": ", err)
+        return 0
+    }
+    return value
+}
+
+func (m *Model) NodeCost(node *corev1.Node) float64 {
+    if node == nil {
+        return m.Default
+    }
+
+    spot := len(m.SpotSelector) > 0 && matches(node, m.SpotSelector)
+    for _, price := range m.Prices {
+        if matches(node, price.Selector) {
+            if spot {
+                return price.Spot
+            }
+            return price.OnDemand
+        }
+    }
+    return m.Default
+}
+
+// SetCosts prices the nodes. Nodes of a pool cost as the pool says, others
+// are priced by the model, which may be nil.
+func SetCosts(m *Model, nodes []types.NodeInfo) {
+    for i := range nodes {
+        if nodes[i].Pool != nil && nodes[i].Pool.HourlyCost > 0 {
+            nodes[i].HourlyCost = nodes[i].Pool.HourlyCost
+        } else if m != nil {
+            nodes[i].HourlyCost = m.NodeCost(nodes[i].Node)
+        }
+    }
+}
+
+func HourlyCost(nodes []types.NodeInfo) float64 {
+    cost := float64(0)
+    for i := range nodes {
+        cost += nodes[i].HourlyCost
+    }
+    return cost
+}
+
+// MonthlySavings estimates how much cheaper the cluster becomes after the
+// nodes are deleted and created.
+func MonthlySavings(nodesToDelete []types.NodeInfo, nodesToCreate []types.NodeInfo) float64 {
+    return (HourlyCost(nodesToDelete) - HourlyCost(nodesToCreate)) * HoursPerMonth
+}
+
+func matches(node *corev1.Node, selector map[string]string) bool {
+    for key, value := range selector {
+        if node.Labels[key] != value {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pricing
+
+import (
+    "testing"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func labeledNode(labels map[string]string) *corev1.Node {
+    return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+}
+
+func TestModelPricesSpotNodes(t *testing.T) {
+    m := ConvertArgs(&appsv1.CostModelArgs{
+        Prices: []appsv1.NodePriceArgs{
+            {Selector: map[string]string{"type": "large"}, HourlyCost: "0.4", SpotHourlyCost: "0.12"},
+        },
+        SpotSelector:      map[string]string{"lifecycle": "spot"},
+        DefaultHourlyCost: "0.1",
+    })
+
+    cases := []struct {
+        labels map[string]string
+        cost   float64
+    }{
+        {map[string]string{"type": "large"}, 0.4},
+        {map[string]string{"type": "large", "lifecycle": "spot"}, 0.12},
+        {map[string]string{"type": "small"}, 0.1},
+    }
+    for _, c := range cases {
+        if cost := m.NodeCost(labeledNode(c.labels)); cost != c.cost {
+            t.Errorf("expected %v to cost %v, got %v", c.labels, c.cost, cost)
+        }
+    }
+}
+
+func TestMonthlySavings(t *testing.T) {
+    pool := &types.NodePool{Name: "small", HourlyCost: 0.1}
+    nodes := []types.NodeInfo{{Node: labeledNode(map[string]string{"type": "large"})}, {Pool: pool}}
+    SetCosts(ConvertArgs(&appsv1.CostModelArgs{DefaultHourlyCost: "0.5"}), nodes)
+    if nodes[0].HourlyCost != 0.5 || nodes[1].HourlyCost != 0.1 {
+        t.Fatalf("unexpected costs %v and %v", nodes[0].HourlyCost, nodes[1].HourlyCost)
+    }
+
+    if savings := MonthlySavings(nodes[:1], nodes[1:]); savings != (0.5-0.1)*HoursPerMonth {
+        t.Errorf("unexpected savings %v", savings)
+    }
+}
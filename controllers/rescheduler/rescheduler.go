@@ -18,6 +18,8 @@ package rescheduler
 
 import (
     "context"
+    "strconv"
+    "time"
 
     appsv1 "github.com/miha3009/planner/api/v1"
     helper "github.com/miha3009/planner/controllers/helper"
@@ -25,6 +27,7 @@ import (
     constraints "github.com/miha3009/planner/controllers/rescheduler/constraints"
     "github.com/miha3009/planner/controllers/rescheduler/nodepolicies"
     preferences "github.com/miha3009/planner/controllers/rescheduler/preferences"
+    "github.com/miha3009/planner/controllers/rescheduler/pricing"
     types "github.com/miha3009/planner/controllers/types"
     "github.com/prometheus/common/log"
     corev1 "k8s.io/api/core/v1"
@@ -36,40 +39,52 @@ func GenPlan(ctx context.Context, events chan types.Event, cache *types.PlannerC
     rawPods := cache.Pods
     
     if len(rawNodes) == 1 {
-        cache.Plan = &types.Plan{}
+        cache.SetPlan(&types.Plan{})
         events <- types.PlanningEnded
         return
     }
 
     cst := planner.Constraints
     prf := planner.Preferences
+    if sizeByUsage(planner.Sizing) && cst.Overcommit == nil {
+        // Pods sized by usage may request more than a node has, so their
+        // requests are always checked.
+        cst.Overcommit = &appsv1.OvercommitArgs{}
+    }
 
-    nodes := convertNodes(rawNodes, rawPods)
+    usage := predictUsage(cache.Metrics, rawPods, planner.Sizing, planner.PlanningInterval)
+    nodes := convertNodes(rawNodes, rawPods, usage, sizeByUsage(planner.Sizing))
+    pools := convertPools(planner.NodePools)
+    assignPools(nodes, pools)
+    pricing.SetCosts(pricing.ConvertArgs(planner.CostModel), nodes)
 
     cl := constraints.ConvertArgs(&cst)
     pl := preferences.ConvertArgs(&prf)
 
     algo := getAlgorithm(&planner, cl, pl)
-    nodePolicy := getNodePolicy(&planner)
+    nodePolicy := getNodePolicy(&planner, cache, pools, len(nodes))
 
     updatedNodes, nodesToCreate, nodesToDelete := nodePolicy.Run(ctx, algo, nodes)
     if helper.ContextEnded(ctx) {
         return
     }
 
+    newNodes := genNodesFromInfo(nodesToCreate)
+    bindNewNodes(updatedNodes, newNodes)
     movementsInfo := calcDiff(nodes, updatedNodes)
     movements := convertMovement(movementsInfo)
     plan := types.Plan{
-        Movements:     movements,
-        NodesToCreate: genNodesFromInfo(nodesToCreate),
-        NodesToDelete: matchNodes(rawNodes, nodesToDelete),
+        Movements:      movements,
+        NodesToCreate:  newNodes,
+        NodesToDelete:  matchNodes(rawNodes, nodesToDelete),
+        MonthlySavings: pricing.MonthlySavings(nodesToDelete, nodesToCreate),
     }
 
-    cache.Plan = &plan
+    cache.SetPlan(&plan)
     events <- types.PlanningEnded
 }
 
-func convertNodes(rawNodes []corev1.Node, rawPods [][]corev1.Pod) []types.NodeInfo {
+func convertNodes(rawNodes []corev1.Node, rawPods [][]corev1.Pod, usage map[string]podUsage, byUsage bool) []types.NodeInfo {
     nodes := make([]types.NodeInfo, len(rawNodes))
 
     for i, node := range rawNodes {
@@ -78,7 +93,7 @@ func convertNodes(rawNodes []corev1.Node, rawPods [][]corev1.Pod) []types.NodeIn
         maxCpu := resourceToInt(node.Status.Capacity.Cpu(), "cpu")
         maxMemory := resourceToInt(node.Status.Capacity.Memory(), "mem")
 
-        pods := convertPods(rawPods[i])
+        pods := convertPods(rawPods[i], usage, byUsage)
 
         nodes[i] = types.NodeInfo{
             Node:           &rawNodes[i],
@@ -100,7 +115,57 @@ func convertNodes(rawNodes []corev1.Node, rawPods [][]corev1.Pod) []types.NodeIn
     return nodes
 }
 
-func convertPods(rawPods []corev1.Pod) []types.PodInfo {
+// convertPools parses node pools of the spec. Pools with a malformed shape
+// or cost are skipped.
+func convertPools(args []appsv1.NodePoolArgs) []types.NodePool {
+    pools := make([]types.NodePool, 0, len(args))
+    for _, arg := range args {
+        cpu, err := resource.ParseQuantity(arg.Cpu)
+        if err != nil {
+            log.Info("Node pool ", arg.Name, " has invalid cpu: ", err)
+            continue
+        }
+        memory, err := resource.ParseQuantity(arg.Memory)
+        if err != nil {
+            log.Info("Node pool ", arg.Name, " has invalid memory: ", err)
+            continue
+        }
+        cost := float64(0)
+        if arg.HourlyCost != "" {
+            if cost, err = strconv.ParseFloat(arg.HourlyCost, 64); err != nil {
+                log.Info("Node pool ", arg.Name, " has invalid hourly cost: ", err)
+                continue
+            }
+        }
+
+        pools = append(pools, types.NodePool{
+            Name:       arg.Name,
+            Cpu:        resourceToInt(&cpu, "cpu"),
+            Memory:     resourceToInt(&memory, "mem"),
+            Labels:     arg.Labels,
+            Taints:     arg.Taints,
+            MinNodes:   arg.MinNodes,
+            MaxNodes:   arg.MaxNodes,
+            HourlyCost: cost,
+        })
+    }
+    return pools
+}
+
+func assignPools(nodes []types.NodeInfo, pools []types.NodePool) {
+    for i := range nodes {
+        for j := range pools {
+            if pools[j].Matches(nodes[i].Node) {
+                nodes[i].Pool = &pools[j]
+                break
+            }
+        }
+    }
+}
+
+// convertPods sizes pods by requests or, if byUsage is set, by predicted
+// usage. Pods without metrics are sized by requests either way.
+func convertPods(rawPods []corev1.Pod, usage map[string]podUsage, byUsage bool) []types.PodInfo {
     pods := make([]types.PodInfo, 0)
 
     for i := range rawPods {
@@ -115,11 +180,24 @@ func convertPods(rawPods []corev1.Pod) []types.PodInfo {
             memorySum += resourceToInt(container.Resources.Requests.Memory(), "mem")
         }
 
+        predicted, ok := usage[types.PodKey(rawPods[i].Namespace, rawPods[i].Name)]
+        if !ok {
+            predicted = podUsage{Cpu: cpuSum, Memory: memorySum}
+        }
+
         pod := types.PodInfo{
-            Pod:    &rawPods[i],
-            Name:   rawPods[i].Name,
-            Cpu:    cpuSum,
-            Memory: memorySum,
+            Pod:           &rawPods[i],
+            Name:          rawPods[i].Name,
+            Cpu:           cpuSum,
+            Memory:        memorySum,
+            RequestCpu:    cpuSum,
+            RequestMemory: memorySum,
+            UsageCpu:      predicted.Cpu,
+            UsageMemory:   predicted.Memory,
+        }
+        if byUsage {
+            pod.Cpu = predicted.Cpu
+            pod.Memory = predicted.Memory
         }
         pods = append(pods, pod)
     }
@@ -206,13 +284,56 @@ func genNodesFromInfo(nodes []types.NodeInfo) []corev1.Node {
     coreNodes := make([]corev1.Node, len(nodes))
 
     for i := range nodes {
-        coreNodes[i] = corev1.Node{}
+        if nodes[i].Node != nil {
+            coreNodes[i] = *nodes[i].Node.DeepCopy()
+        } else {
+            coreNodes[i] = corev1.Node{}
+        }
         coreNodes[i].Name = nodes[i].Name
     }
 
     return coreNodes
 }
 
+// bindNewNodes points nodes created by the node policy to their
+// placeholders, so that movements to them have a new node.
+func bindNewNodes(nodes []types.NodeInfo, newNodes []corev1.Node) {
+    for i := range nodes {
+        if nodes[i].Node != nil {
+            continue
+        }
+        for j := range newNodes {
+            if newNodes[j].Name == nodes[i].Name {
+                nodes[i].Node = &newNodes[j]
+                break
+            }
+        }
+    }
+}
+
+func getScaleDownGuards(args *appsv1.ScaleDownArgs, cache *types.PlannerCache, now time.Time) []nodepolicies.DeletionGuard {
+    guards := make([]nodepolicies.DeletionGuard, 0)
+    if args.MinNodeAge > 0 {
+        guards = append(guards, &nodepolicies.NodeAgeGuard{MinAge: time.Second * time.Duration(args.MinNodeAge), Now: now})
+    }
+    if args.UtilizationThreshold > 0 {
+        guards = append(guards, &nodepolicies.UtilizationGuard{Threshold: float64(args.UtilizationThreshold) / 100})
+    }
+    if args.ProtectedLabel != "" {
+        guards = append(guards, &nodepolicies.ProtectedLabelGuard{Label: args.ProtectedLabel})
+    }
+
+    cooldown := time.Second * time.Duration(args.CooldownAfterScaleUp)
+    if cooldown > 0 && now.Sub(cache.LastScaleUp) < cooldown {
+        log.Info("Nodes will not be deleted during the cooldown after a scale-up")
+        guards = append(guards, &nodepolicies.DeletionBudgetGuard{Remaining: 0})
+    } else if args.MaxDeletionsPerHour > 0 {
+        remaining := args.MaxDeletionsPerHour - cache.NodeDeletionsSince(now.Add(-time.Hour))
+        guards = append(guards, &nodepolicies.DeletionBudgetGuard{Remaining: remaining})
+    }
+    return guards
+}
+
 func getAlgorithm(planner *appsv1.PlannerSpec, cl constraints.ConstraintList, pl preferences.PreferenceList) algorithm.Algorithm {
     args := planner.Algorithm
     if args == nil {
@@ -222,12 +343,24 @@ func getAlgorithm(planner *appsv1.PlannerSpec, cl constraints.ConstraintList, pl
     return &algorithm.RandomAlgorithm{Attempts: args.Attemps, StealPodChance: float64(args.StealPodChance) / 1000, Constraints: cl, Preferences: pl}
 }
 
-func getNodePolicy(planner *appsv1.PlannerSpec) nodepolicies.NodePolicy {
+func getNodePolicy(planner *appsv1.PlannerSpec, cache *types.PlannerCache, pools []types.NodePool, nodesCount int) nodepolicies.NodePolicy {
     maxNodes := planner.MaxNodes
     if maxNodes == 0 {
         maxNodes = 10000
     }
-    
+
+    guards := make([]nodepolicies.DeletionGuard, 0)
+    if args := planner.Execution; args != nil && args.NodeDriver == "cluster_autoscaler" && args.ClusterAutoscaler != nil {
+        // Nodes are provisioned by cluster-autoscaler for pending pods.
+        if maxNodes > nodesCount {
+            maxNodes = nodesCount
+        }
+        guards = append(guards, &nodepolicies.NodeGroupGuard{Groups: cache.NodeGroups, Label: args.ClusterAutoscaler.NodeGroupLabel})
+    }
+    if planner.ScaleDown != nil {
+        guards = append(guards, getScaleDownGuards(planner.ScaleDown, cache, time.Now())...)
+    }
+
     switch planner.NodePolicy {
     case "keep":
         return &nodepolicies.KeepNodePolicy{}
@@ -238,9 +371,9 @@ func getNodePolicy(planner *appsv1.PlannerSpec) nodepolicies.NodePolicy {
         } else {
             optimizer = nil
         }
-        return &nodepolicies.ShrinkNodePolicy{Optimizer: optimizer, MaxNodes: maxNodes,}
+        return &nodepolicies.ShrinkNodePolicy{Optimizer: optimizer, MaxNodes: maxNodes, Guards: guards, Pools: pools,}
     case "only_grow":
-        return &nodepolicies.OnlyGrowNodePolicy{MaxNodes: maxNodes,}
+        return &nodepolicies.OnlyGrowNodePolicy{MaxNodes: maxNodes, Pools: pools,}
     default:
         return &nodepolicies.KeepNodePolicy{}
     }
@@ -0,0 +1,108 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rescheduler
+
+import (
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    helper "github.com/miha3009/planner/controllers/helper"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+)
+
+const (
+    sizingUsage             = "usage"
+    sizingForecast          = "forecast"
+    defaultSizingPercentile = 95
+)
+
+// podUsage is predicted usage of a pod in the units of types.PodInfo.
+type podUsage struct {
+    Cpu    int64
+    Memory int64
+}
+
+// usageSeries is usage of a pod summed over its containers.
+type usageSeries struct {
+    Cpu    []float64
+    Memory []float64
+    Times  []time.Time
+}
+
+// predictUsage returns the percentile of usage of every pod over the
+// metrics window or, for the forecast source, the peak of the forecast.
+// Usage is keyed by types.PodKey.
+func predictUsage(q types.MetricsQueue, rawPods [][]corev1.Pod, args *appsv1.SizingArgs, planningInterval int) map[string]podUsage {
+    percentile := float64(defaultSizingPercentile)
+    if args != nil && args.Percentile > 0 {
+        percentile = float64(args.Percentile)
+    }
+
+    series := collectUsage(q, rawPods)
+    usage := make(map[string]podUsage, len(series))
+    for name, s := range series {
+        usage[name] = podUsage{
+            Cpu:    int64(helper.Percentile(s.Cpu, percentile)),
+            Memory: int64(helper.Percentile(s.Memory, percentile)),
+        }
+    }
+
+    if args != nil && args.Source == sizingForecast {
+        horizon := time.Second * time.Duration(planningInterval)
+        if args.Forecast != nil && args.Forecast.Horizon > 0 {
+            horizon = time.Second * time.Duration(args.Forecast.Horizon)
+        }
+        for name, forecasted := range forecastUsage(series, args.Forecast, horizon) {
+            usage[name] = forecasted
+        }
+    }
+    return usage
+}
+
+// collectUsage builds series of the pods, including the history of the pods
+// they replaced.
+func collectUsage(q types.MetricsQueue, rawPods [][]corev1.Pod) map[string]*usageSeries {
+    series := make(map[string]*usageSeries)
+    for i := range rawPods {
+        for j := range rawPods[i] {
+            key := types.PodKey(rawPods[i][j].Namespace, rawPods[i][j].Name)
+            for _, sample := range q.Pod(key) {
+                cpuSum := int64(0)
+                memorySum := int64(0)
+                for _, container := range sample.Metrics.Containers {
+                    cpuSum += resourceToInt(container.Usage.Cpu(), "cpu")
+                    memorySum += resourceToInt(container.Usage.Memory(), "mem")
+                }
+
+                s, ok := series[key]
+                if !ok {
+                    s = &usageSeries{}
+                    series[key] = s
+                }
+                s.Cpu = append(s.Cpu, float64(cpuSum))
+                s.Memory = append(s.Memory, float64(memorySum))
+                s.Times = append(s.Times, sample.Timestamp)
+            }
+        }
+    }
+    return series
+}
+
+func sizeByUsage(args *appsv1.SizingArgs) bool {
+    return args != nil && (args.Source == sizingUsage || args.Source == sizingForecast)
+}
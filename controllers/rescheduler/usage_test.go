@@ -0,0 +1,141 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rescheduler
+
+import (
+    "testing"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    resource "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    metrics "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+func usageSample(pod string, cpus ...int64) types.MetricsPackage {
+    containers := make([]metrics.ContainerMetrics, 0, len(cpus))
+    for _, cpu := range cpus {
+        containers = append(containers, metrics.ContainerMetrics{Usage: corev1.ResourceList{
+            "cpu":    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+            "memory": *resource.NewQuantity(cpu*1000, resource.BinarySI),
+        }})
+    }
+    return types.MetricsPackage{
+        PodMetrics: map[string]metrics.PodMetrics{types.PodKey("default", pod): {Containers: containers}},
+        Timestamp:  time.Now(),
+    }
+}
+
+func requestingPod(name string, cpu string) corev1.Pod {
+    return corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+        Spec: corev1.PodSpec{Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{
+            Requests: corev1.ResourceList{"cpu": resource.MustParse(cpu), "memory": resource.MustParse("1Mi")},
+        }}}},
+    }
+}
+
+func TestPredictUsage(t *testing.T) {
+    q := types.NewMetricsQueue()
+    for i := int64(1); i <= 20; i++ {
+        q.Push(usageSample("web", i*10, i*10))
+    }
+
+    pods := [][]corev1.Pod{{requestingPod("web", "1")}}
+    usage := predictUsage(q, pods, &appsv1.SizingArgs{Percentile: 90}, 60)
+    if usage["default/web"].Cpu != 360 || usage["default/web"].Memory != 360000 {
+        t.Errorf("expected the 90th percentile of summed containers, got %+v", usage["default/web"])
+    }
+    if usage := predictUsage(q, pods, nil, 60); usage["default/web"].Cpu != 380 {
+        t.Errorf("expected the 95th percentile by default, got %+v", usage["default/web"])
+    }
+
+    // A pod moved by the executor keeps the history of the original.
+    q.Rename("default/web", "default/web-x7k2p")
+    moved := [][]corev1.Pod{{requestingPod("web-x7k2p", "1")}}
+    if usage := predictUsage(q, moved, nil, 60); usage["default/web-x7k2p"].Cpu != 380 {
+        t.Errorf("expected the history of the replaced pod, got %+v", usage["default/web-x7k2p"])
+    }
+}
+
+func TestConvertPodsByUsage(t *testing.T) {
+    rawPods := []corev1.Pod{requestingPod("web", "1"), requestingPod("db", "500m")}
+    usage := map[string]podUsage{"default/web": {Cpu: 200, Memory: 1000}}
+
+    pods := convertPods(rawPods, usage, true)
+    if pods[0].Cpu != 200 || pods[0].RequestCpu != 1000 || pods[0].UsageCpu != 200 {
+        t.Errorf("expected web to be sized by usage, got %+v", pods[0])
+    }
+    if pods[1].Cpu != 500 || pods[1].UsageCpu != 500 {
+        t.Errorf("expected db without metrics to be sized by requests, got %+v", pods[1])
+    }
+
+    pods = convertPods(rawPods, usage, false)
+    if pods[0].Cpu != 1000 || pods[0].UsageCpu != 200 {
+        t.Errorf("expected web to be sized by requests, got %+v", pods[0])
+    }
+}
+
+func TestPredictUsageByForecast(t *testing.T) {
+    q := types.NewMetricsQueue()
+    start := time.Now().Add(-time.Hour)
+    for i := int64(0); i < 10; i++ {
+        sample := usageSample("web", 100+i*20)
+        sample.Timestamp = start.Add(time.Duration(i) * time.Minute)
+        q.Push(sample)
+    }
+    q.Push(usageSample("new", 50))
+
+    args := &appsv1.SizingArgs{Source: sizingForecast, Forecast: &appsv1.ForecastArgs{Horizon: 300}}
+    pods := [][]corev1.Pod{{requestingPod("web", "1"), requestingPod("new", "1")}}
+    usage := predictUsage(q, pods, args, 60)
+    if cpu := usage["default/web"].Cpu; cpu < 370 || cpu > 390 {
+        t.Errorf("expected the peak of the growing usage in five minutes, got %v", cpu)
+    }
+    if cpu := usage["default/new"].Cpu; cpu != 50 {
+        t.Errorf("expected a pod with short history to be sized by the percentile, got %v", cpu)
+    }
+}
+
+func TestForecastResamplesDownsampledHistory(t *testing.T) {
+    q := types.NewMetricsQueue()
+    now := time.Now()
+    start := now.Add(-135 * time.Minute)
+    push := func(at time.Time) {
+        // Usage grows by 2m cpu a minute.
+        sample := usageSample("web", 100+int64(at.Sub(start).Minutes()*2))
+        sample.Timestamp = at
+        q.Push(sample)
+    }
+    // Downsampled history has a sample every five minutes, recent samples
+    // come every 15 seconds.
+    for at := start; at.Before(now.Add(-16 * time.Minute)); at = at.Add(5 * time.Minute) {
+        push(at)
+    }
+    for at := now.Add(-15 * time.Minute); !at.After(now); at = at.Add(15 * time.Second) {
+        push(at)
+    }
+
+    args := &appsv1.SizingArgs{Source: sizingForecast, Forecast: &appsv1.ForecastArgs{Horizon: 1800}}
+    pods := [][]corev1.Pod{{requestingPod("web", "1")}}
+    usage := predictUsage(q, pods, args, 60)
+    if cpu := usage["default/web"].Cpu; cpu < 415 || cpu > 445 {
+        t.Errorf("expected the usage in 30 minutes to follow the trend, got %v", cpu)
+    }
+}
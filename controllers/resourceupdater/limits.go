@@ -0,0 +1,103 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourceupdater
+
+import (
+    "math"
+    "strconv"
+    "time"
+
+    helper "github.com/miha3009/planner/controllers/helper"
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+)
+
+const oomKilled = "OOMKilled"
+
+func parseRatio(value string) (float64, error) {
+    if value == "" {
+        return 0, nil
+    }
+    return strconv.ParseFloat(value, 64)
+}
+
+// limit returns the request multiplied by the ratio. Without a ratio the
+// current limit is kept, but raised to the request if it is lower.
+func limit(request int64, ratio float64, current int64) int64 {
+    if ratio > 0 {
+        return int64(math.Ceil(float64(request) * ratio))
+    }
+    if current > 0 && current < request {
+        return request
+    }
+    return current
+}
+
+func bump(value int64, percent float64) int64 {
+    return int64(math.Ceil(float64(value) * (1 + percent/100)))
+}
+
+// throttled reports whether the average share of throttled periods is above
+// the threshold. Metrics without throttling never trigger it.
+func (r *recommender) throttled(throttling []float64) bool {
+    if r.throttlingThreshold == 0 || len(throttling) == 0 {
+        return false
+    }
+    return helper.Mean(throttling)*100 > r.throttlingThreshold
+}
+
+// oomMemory raises memory of a container that was OOM killed above its
+// memory limit or request at the time. A kill is handled once, later cycles
+// keep the raised memory until the container is killed again.
+func (r *recommender) oomMemory(key string, container *corev1.Container, status *corev1.ContainerStatus, memory int64) int64 {
+    finishedAt, ok := lastOOMKill(status)
+    if !ok {
+        return memory
+    }
+
+    oom, handled := r.handledOOMs[key]
+    if !handled || !oom.FinishedAt.Equal(finishedAt) {
+        base := memory
+        if memoryLimit := container.Resources.Limits.Memory().MilliValue(); memoryLimit > base {
+            base = memoryLimit
+        }
+        if request := container.Resources.Requests.Memory().MilliValue(); request > base {
+            base = request
+        }
+        oom = types.OOMBump{FinishedAt: finishedAt, Memory: bump(base, r.oomBump)}
+        log.Info("Container ", key, " was OOM killed, its memory is raised")
+    }
+    r.ooms[key] = oom
+
+    if oom.Memory > memory {
+        return oom.Memory
+    }
+    return memory
+}
+
+func lastOOMKill(status *corev1.ContainerStatus) (time.Time, bool) {
+    if status == nil {
+        return time.Time{}, false
+    }
+    for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+        if state.Terminated != nil && state.Terminated.Reason == oomKilled {
+            return state.Terminated.FinishedAt.Time, true
+        }
+    }
+    return time.Time{}, false
+}
@@ -18,52 +18,107 @@ package resourceupdater
 
 import (
     "context"
+    "time"
 
     appsv1 "github.com/miha3009/planner/api/v1"
     types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
     corev1 "k8s.io/api/core/v1"
     resource "k8s.io/apimachinery/pkg/api/resource"
+    "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type ContainerMetrics struct {
     Cpu    []int64
     Memory []int64
+    Times  []time.Time
+    // Shares of throttled cpu periods, if the metrics report them.
+    Throttling []float64
 }
 
 type PodMetrics map[string]ContainerMetrics
 
-func UpdatePodResources(ctx context.Context, events chan types.Event, cache *types.PlannerCache, planner appsv1.PlannerSpec) {
-    cache.Metrics.Lock()
-    defer cache.Metrics.Unlock()
+func UpdatePodResources(ctx context.Context, events chan types.Event, cache *types.PlannerCache, clt client.Client, planner appsv1.PlannerSpec) {
+    defer func() { events <- types.ResourceUpdatingEnded }()
+
+    strategy := planner.ResourceUpdateStrategy
+    if strategy == "none" || strategy == "" {
+        return
+    }
+    r, err := newRecommender(strategy, planner.ResourceUpdate, cache.OOMBumps, time.Now())
+    if err != nil {
+        log.Info("Requests will not be updated: ", err)
+        return
+    }
+
+    var vpa *vpaPublisher
+    if planner.VPA != nil {
+        vpa = newVPAPublisher(clt, planner.VPA)
+    }
+    updatePods := planner.VPA == nil || planner.VPA.UpdatePods
 
     for i := range cache.Pods {
         for j := range cache.Pods[i] {
-            if newPod, needUpdate := updatePod(ctx, &cache.Pods[i][j], cache.Metrics, planner.ResourceUpdateStrategy); needUpdate {
+            pod := &cache.Pods[i][j]
+            if !updatePods {
+                pod = pod.DeepCopy()
+            }
+            newPod, needUpdate := updatePod(ctx, pod, cache.Metrics, r)
+            if !needUpdate {
+                continue
+            }
+            if vpa != nil {
+                vpa.Add(ctx, newPod)
+            }
+            if updatePods {
                 newPod.Spec.NodeName = cache.Nodes[i].Name
                 cache.UpdatedPods = append(cache.UpdatedPods, *newPod)
             }
         }
     }
+    cache.OOMBumps = r.ooms
 
-    events <- types.ResourceUpdatingEnded
-}
-
-func updatePod(ctx context.Context, pod *corev1.Pod, q types.MetricsQueue, strategy string) (*corev1.Pod, bool) {
-    if strategy == "none" || strategy == "" {
-        return nil, false
+    if vpa != nil {
+        vpa.Publish(ctx)
     }
+}
 
-    m := getPodMetrics(pod.Name, q)
+// updatePod sets requests and limits of containers to the recommended ones.
+// Containers without metrics keep their resources.
+func updatePod(ctx context.Context, pod *corev1.Pod, q types.MetricsQueue, r *recommender) (*corev1.Pod, bool) {
+    m := getPodMetrics(pod, q)
 
     newPod := *pod
-    for i, container := range pod.Spec.Containers {
-        requestCpu := calcRecommendation(m[container.Name].Cpu, strategy)
-        requestMemory := calcRecommendation(m[container.Name].Memory, strategy)
+    updated := false
+    for i := range pod.Spec.Containers {
+        container := &pod.Spec.Containers[i]
+        key := pod.Namespace + "/" + pod.Name + "/" + container.Name
+        rec, ok := r.recommend(key, container, containerStatus(pod, container.Name), m[container.Name])
+        if !ok {
+            continue
+        }
 
-        newPod.Spec.Containers[i].Resources.Requests = corev1.ResourceList{
-            "cpu":    *resource.NewMilliQuantity(requestCpu, resource.Format("DecimalSI")),
-            "memory": *resource.NewMilliQuantity(requestMemory, resource.Format("DecimalSI")),
+        resources := corev1.ResourceRequirements{
+            Requests: copyResources(container.Resources.Requests),
+            Limits:   copyResources(container.Resources.Limits),
         }
+        resources.Requests["cpu"] = *resource.NewMilliQuantity(rec.cpu, resource.Format("DecimalSI"))
+        resources.Requests["memory"] = *resource.NewMilliQuantity(rec.memory, resource.Format("DecimalSI"))
+        if rec.cpuLimit > 0 {
+            resources.Limits["cpu"] = *resource.NewMilliQuantity(rec.cpuLimit, resource.Format("DecimalSI"))
+        }
+        if rec.memoryLimit > 0 {
+            resources.Limits["memory"] = *resource.NewMilliQuantity(rec.memoryLimit, resource.Format("DecimalSI"))
+        }
+        if len(resources.Limits) == 0 {
+            resources.Limits = nil
+        }
+        newPod.Spec.Containers[i].Resources = resources
+        updated = true
+    }
+
+    if !updated {
+        return nil, false
     }
 
     *pod = newPod
@@ -71,49 +126,52 @@ func updatePod(ctx context.Context, pod *corev1.Pod, q types.MetricsQueue, strat
     return &newPod, true
 }
 
-func getPodMetrics(podName string, q types.MetricsQueue) PodMetrics {
-    podMetrics := PodMetrics{}
+func copyResources(list corev1.ResourceList) corev1.ResourceList {
+    copied := corev1.ResourceList{}
+    for name, quantity := range list {
+        copied[name] = quantity
+    }
+    return copied
+}
 
-    N := q.Size()
-    for i := 0; i < N; i++ {
-        p := q.Get(i).PodMetrics[podName]
-        for j := range p.Containers {
-            containerName := p.Containers[j].Name
-            cpu := p.Containers[j].Usage.Cpu().MilliValue()
-            memory := p.Containers[j].Usage.Memory().MilliValue()
-            if _, ok := podMetrics[containerName]; ok {
-                podMetrics[containerName] = ContainerMetrics{
-                    Cpu:    append(podMetrics[containerName].Cpu, cpu),
-                    Memory: append(podMetrics[containerName].Memory, memory),
-                }
-            } else {
-                podMetrics[containerName] = ContainerMetrics{
-                    Cpu:    []int64{cpu},
-                    Memory: []int64{memory},
-                }
-            }
+func containerStatus(pod *corev1.Pod, name string) *corev1.ContainerStatus {
+    for i := range pod.Status.ContainerStatuses {
+        if pod.Status.ContainerStatuses[i].Name == name {
+            return &pod.Status.ContainerStatuses[i]
         }
     }
-
-    return podMetrics
+    return nil
 }
 
-func calcRecommendation(x []int64, strategy string) int64 {
-    switch strategy {
-    case "max":
-        return calcMaxStrategy(x)
-    default:
-        return int64(0)
+// getPodMetrics collects usage by container of all pods of the workload of
+// the pod, or of the pod and the pods it replaced if it has no workload.
+func getPodMetrics(pod *corev1.Pod, q types.MetricsQueue) PodMetrics {
+    podMetrics := PodMetrics{}
+
+    key := types.PodKey(pod.Namespace, pod.Name)
+    workload := types.WorkloadKey(pod)
+    if workload == "" {
+        workload = q.Owner(key)
+    }
+    samples := q.Pod(key)
+    if workload != "" {
+        samples = q.Workload(workload)
     }
-}
 
-func calcMaxStrategy(x []int64) int64 {
-    maxValue := int64(0)
-    for i := range x {
-        if x[i] > maxValue {
-            maxValue = x[i]
+    for _, sample := range samples {
+        p := sample.Metrics
+        for j := range p.Containers {
+            containerName := p.Containers[j].Name
+            m := podMetrics[containerName]
+            m.Cpu = append(m.Cpu, p.Containers[j].Usage.Cpu().MilliValue())
+            m.Memory = append(m.Memory, p.Containers[j].Usage.Memory().MilliValue())
+            m.Times = append(m.Times, sample.Timestamp)
+            if throttling, ok := sample.Throttling[containerName]; ok {
+                m.Throttling = append(m.Throttling, throttling)
+            }
+            podMetrics[containerName] = m
         }
     }
 
-    return maxValue
+    return podMetrics
 }
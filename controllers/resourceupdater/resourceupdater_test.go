@@ -0,0 +1,216 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourceupdater
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    resource "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    metrics "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+func usage(cpu int64, memory int64) corev1.ResourceList {
+    return corev1.ResourceList{
+        "cpu":    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+        "memory": *resource.NewQuantity(memory, resource.BinarySI),
+    }
+}
+
+func queueOf(podName string, now time.Time, cpus ...int64) types.MetricsQueue {
+    q := types.NewMetricsQueue()
+    for i, cpu := range cpus {
+        q.Push(types.MetricsPackage{
+            PodMetrics: map[string]metrics.PodMetrics{
+                types.PodKey("default", podName): {Containers: []metrics.ContainerMetrics{{Name: "app", Usage: usage(cpu, 1000)}}},
+            },
+            Timestamp: now.Add(time.Duration(i-len(cpus)) * time.Minute),
+        })
+    }
+    return q
+}
+
+func testPod() *corev1.Pod {
+    return &corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+        Spec: corev1.PodSpec{Containers: []corev1.Container{
+            {Name: "app", Resources: corev1.ResourceRequirements{Requests: usage(500, 1000)}},
+            {Name: "sidecar", Resources: corev1.ResourceRequirements{Requests: usage(50, 1000)}},
+        }},
+    }
+}
+
+func TestStrategies(t *testing.T) {
+    x := []int64{100, 200, 300, 400, 500, 600, 700, 800, 900, 1000}
+    cases := []struct {
+        strategy string
+        args     *appsv1.ResourceUpdateArgs
+        cpu      int64
+    }{
+        {"max", nil, 1000},
+        {"p50", nil, 500},
+        {"p90", nil, 900},
+        {"p100", nil, 1000},
+        {"mean_stddev", &appsv1.ResourceUpdateArgs{StddevFactor: "0"}, 550},
+        {"max", &appsv1.ResourceUpdateArgs{Margin: 20}, 1200},
+        {"max", &appsv1.ResourceUpdateArgs{Bounds: []appsv1.ContainerBoundsArgs{{Container: "app", MaxCpu: "800m"}}}, 800},
+        {"p50", &appsv1.ResourceUpdateArgs{Bounds: []appsv1.ContainerBoundsArgs{{MinCpu: "1"}}}, 1000},
+    }
+    for _, c := range cases {
+        r, err := newRecommender(c.strategy, c.args, nil, time.Now())
+        if err != nil {
+            t.Fatal(err)
+        }
+        rec, ok := r.recommend("web/app", &corev1.Container{Name: "app"}, nil, ContainerMetrics{Cpu: x, Memory: x})
+        if !ok || rec.cpu != c.cpu {
+            t.Errorf("%s: expected %d, got %d", c.strategy, c.cpu, rec.cpu)
+        }
+    }
+}
+
+func TestUnknownStrategyIsRejected(t *testing.T) {
+    for _, strategy := range []string{"min", "p0", "p101", "pxx"} {
+        if _, err := newRecommender(strategy, nil, nil, time.Now()); err == nil {
+            t.Errorf("expected %s to be rejected", strategy)
+        }
+    }
+}
+
+func TestHistogramPrefersRecentSamples(t *testing.T) {
+    now := time.Now()
+    x := []int64{1000, 1000, 1000, 100, 100}
+    times := []time.Time{now.Add(-72 * time.Hour), now.Add(-72 * time.Hour), now.Add(-72 * time.Hour), now, now}
+    value := calcHistogramStrategy(x, times, now, time.Hour*24, 75)
+    if value < 100 || value > 100*histogramBucketRatio {
+        t.Errorf("expected the bucket of recent samples, got %v", value)
+    }
+
+    value = calcHistogramStrategy(x, times, now, time.Hour*24*365, 75)
+    if value < 1000 || value > 1000*histogramBucketRatio {
+        t.Errorf("expected the bucket of old samples without decay, got %v", value)
+    }
+}
+
+func TestUpdatePodKeepsRequestsWithoutMetrics(t *testing.T) {
+    r, _ := newRecommender("max", nil, nil, time.Now())
+    pod := testPod()
+    newPod, ok := updatePod(context.Background(), pod, queueOf("web", time.Now(), 200, 300), r)
+    if !ok {
+        t.Fatal("expected the pod to be updated")
+    }
+
+    app := newPod.Spec.Containers[0].Resources.Requests
+    if app.Cpu().MilliValue() != 300 || app.Memory().Value() != 1000 {
+        t.Errorf("unexpected requests of app: %v", app)
+    }
+    sidecar := newPod.Spec.Containers[1].Resources.Requests
+    if sidecar.Cpu().MilliValue() != 50 {
+        t.Errorf("requests of sidecar without metrics changed: %v", sidecar)
+    }
+
+    if _, ok := updatePod(context.Background(), testPod(), queueOf("other", time.Now(), 200), r); ok {
+        t.Error("expected a pod without metrics to be kept")
+    }
+}
+
+func TestPodMetricsOfWorkload(t *testing.T) {
+    q := queueOf("web-7c9f8-x2k4p", time.Now(), 100, 400)
+    q.SetOwner(types.PodKey("default", "web-7c9f8-x2k4p"), "default/Deployment/web")
+
+    controller := true
+    pod := testPod()
+    pod.Name = "web-7c9f8-q8w2z"
+    pod.Labels = map[string]string{"pod-template-hash": "7c9f8"}
+    pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-7c9f8", Controller: &controller}}
+    if m := getPodMetrics(pod, q); len(m["app"].Cpu) != 2 {
+        t.Errorf("expected metrics of the replaced replica, got %+v", m)
+    }
+
+    // A copy made by the executor has no controller, but keeps the history.
+    copied := testPod()
+    copied.Name = "web-mv1"
+    q.Rename(types.PodKey("default", "web-7c9f8-x2k4p"), types.PodKey("default", copied.Name))
+    if m := getPodMetrics(copied, q); len(m["app"].Cpu) != 2 {
+        t.Errorf("expected metrics of the moved pod, got %+v", m)
+    }
+}
+
+func TestLimits(t *testing.T) {
+    container := &corev1.Container{Name: "app", Resources: corev1.ResourceRequirements{Limits: usage(200, 1000)}}
+    m := ContainerMetrics{Cpu: []int64{400}, Memory: []int64{500000}}
+
+    r, _ := newRecommender("max", nil, nil, time.Now())
+    rec, _ := r.recommend("web/app", container, nil, m)
+    if rec.cpuLimit != 400 || rec.memoryLimit != 1000000 {
+        t.Errorf("expected the cpu limit raised to the request and the memory limit kept, got %+v", rec)
+    }
+
+    r, _ = newRecommender("max", &appsv1.ResourceUpdateArgs{CpuLimitRatio: "1.5", MemoryLimitRatio: "2"}, nil, time.Now())
+    rec, _ = r.recommend("web/app", container, nil, m)
+    if rec.cpuLimit != 600 || rec.memoryLimit != 1000000 {
+        t.Errorf("expected limits by ratio, got %+v", rec)
+    }
+
+    rec, _ = r.recommend("web/app", &corev1.Container{Name: "app"}, nil, m)
+    if rec.cpuLimit != 600 {
+        t.Errorf("expected a limit by ratio for a container without limits, got %+v", rec)
+    }
+}
+
+func TestOOMKillRaisesMemoryOnce(t *testing.T) {
+    container := &corev1.Container{Name: "app", Resources: corev1.ResourceRequirements{Limits: usage(100, 1000)}}
+    finishedAt := metav1.NewTime(time.Now().Add(-time.Minute))
+    status := &corev1.ContainerStatus{Name: "app", LastTerminationState: corev1.ContainerState{
+        Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", FinishedAt: finishedAt},
+    }}
+    m := ContainerMetrics{Cpu: []int64{100}, Memory: []int64{800000}}
+
+    r, _ := newRecommender("max", nil, nil, time.Now())
+    rec, _ := r.recommend("web/app", container, status, m)
+    if rec.memory != 1200000 || rec.memoryLimit != 1200000 {
+        t.Fatalf("expected memory 20%% above the limit, got %+v", rec)
+    }
+
+    // The next cycle sees the raised limit, but the same kill.
+    container.Resources.Limits = usage(100, 1200)
+    r, _ = newRecommender("max", nil, r.ooms, time.Now())
+    rec, _ = r.recommend("web/app", container, status, m)
+    if rec.memory != 1200000 {
+        t.Errorf("expected memory to stay raised once, got %+v", rec)
+    }
+}
+
+func TestThrottlingRaisesCpu(t *testing.T) {
+    container := &corev1.Container{Name: "app", Resources: corev1.ResourceRequirements{Limits: usage(500, 1000)}}
+    args := &appsv1.ResourceUpdateArgs{ThrottlingThreshold: 10, ThrottlingBump: 50}
+    r, _ := newRecommender("max", args, nil, time.Now())
+
+    rec, _ := r.recommend("web/app", container, nil, ContainerMetrics{Cpu: []int64{200}, Memory: []int64{1000}, Throttling: []float64{0.3, 0.1}})
+    if rec.cpu != 300 || rec.cpuLimit != 750 {
+        t.Errorf("expected cpu and its limit raised by half, got %+v", rec)
+    }
+
+    rec, _ = r.recommend("web/app", container, nil, ContainerMetrics{Cpu: []int64{200}, Memory: []int64{1000}, Throttling: []float64{0.05}})
+    if rec.cpu != 200 || rec.cpuLimit != 500 {
+        t.Errorf("expected no change below the threshold, got %+v", rec)
+    }
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourceupdater
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    helper "github.com/miha3009/planner/controllers/helper"
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    resource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+    defaultHistogramPercentile = 90
+    defaultHalfLife            = time.Hour * 24
+    defaultStddevFactor        = 2.0
+    defaultOOMBump             = 20
+    defaultThrottlingBump      = 20
+    histogramBucketRatio       = 1.05
+)
+
+// recommender turns usage samples of a container into requests and limits.
+type recommender struct {
+    strategy            string
+    percentile          float64
+    halfLife            time.Duration
+    stddevFactor        float64
+    margin              float64
+    bounds              []containerBounds
+    cpuLimitRatio       float64
+    memoryLimitRatio    float64
+    oomBump             float64
+    throttlingThreshold float64
+    throttlingBump      float64
+    // OOM bumps of the previous cycle and of this one.
+    handledOOMs map[string]types.OOMBump
+    ooms        map[string]types.OOMBump
+    now         time.Time
+}
+
+// recommendation holds requests and limits in milli units, zero limits
+// mean no limit.
+type recommendation struct {
+    cpu         int64
+    memory      int64
+    cpuLimit    int64
+    memoryLimit int64
+}
+
+// containerBounds holds limits in milli units, zero means no limit.
+type containerBounds struct {
+    container string
+    minCpu    int64
+    maxCpu    int64
+    minMemory int64
+    maxMemory int64
+}
+
+func newRecommender(strategy string, args *appsv1.ResourceUpdateArgs, handledOOMs map[string]types.OOMBump, now time.Time) (*recommender, error) {
+    r := &recommender{
+        strategy:       strategy,
+        percentile:     defaultHistogramPercentile,
+        halfLife:       defaultHalfLife,
+        stddevFactor:   defaultStddevFactor,
+        oomBump:        defaultOOMBump,
+        throttlingBump: defaultThrottlingBump,
+        handledOOMs:    handledOOMs,
+        ooms:           make(map[string]types.OOMBump),
+        now:            now,
+    }
+
+    switch {
+    case strategy == "max" || strategy == "histogram" || strategy == "mean_stddev":
+    case strings.HasPrefix(strategy, "p"):
+        percentile, err := strconv.Atoi(strategy[1:])
+        if err != nil || percentile < 1 || percentile > 100 {
+            return nil, fmt.Errorf("unknown resource update strategy %q", strategy)
+        }
+        r.strategy = "percentile"
+        r.percentile = float64(percentile)
+    default:
+        return nil, fmt.Errorf("unknown resource update strategy %q", strategy)
+    }
+
+    if args == nil {
+        return r, nil
+    }
+    if args.HistogramPercentile > 0 && r.strategy == "histogram" {
+        r.percentile = float64(args.HistogramPercentile)
+    }
+    if args.HalfLife > 0 {
+        r.halfLife = time.Duration(args.HalfLife) * time.Second
+    }
+    if args.StddevFactor != "" {
+        factor, err := strconv.ParseFloat(args.StddevFactor, 64)
+        if err != nil {
+            return nil, fmt.Errorf("invalid stddev factor: %v", err)
+        }
+        r.stddevFactor = factor
+    }
+    var err error
+    if r.cpuLimitRatio, err = parseRatio(args.CpuLimitRatio); err != nil {
+        return nil, fmt.Errorf("invalid cpu limit ratio: %v", err)
+    }
+    if r.memoryLimitRatio, err = parseRatio(args.MemoryLimitRatio); err != nil {
+        return nil, fmt.Errorf("invalid memory limit ratio: %v", err)
+    }
+    if args.OOMBump > 0 {
+        r.oomBump = float64(args.OOMBump)
+    }
+    if args.ThrottlingBump > 0 {
+        r.throttlingBump = float64(args.ThrottlingBump)
+    }
+    r.throttlingThreshold = float64(args.ThrottlingThreshold)
+    r.margin = float64(args.Margin)
+    for _, arg := range args.Bounds {
+        r.bounds = append(r.bounds, convertBounds(arg))
+    }
+    return r, nil
+}
+
+func convertBounds(arg appsv1.ContainerBoundsArgs) containerBounds {
+    return containerBounds{
+        container: arg.Container,
+        minCpu:    parseBound(arg.Container, arg.MinCpu),
+        maxCpu:    parseBound(arg.Container, arg.MaxCpu),
+        minMemory: parseBound(arg.Container, arg.MinMemory),
+        maxMemory: parseBound(arg.Container, arg.MaxMemory),
+    }
+}
+
+func parseBound(container string, value string) int64 {
+    if value == "" {
+        return 0
+    }
+    q, err := resource.ParseQuantity(value)
+    if err != nil {
+        log.Info("Bounds of container ", container, " are invalid: ", err)
+        return 0
+    }
+    return q.MilliValue()
+}
+
+// recommend returns requests and limits of the container. It reports
+// false if there are no samples to base them on.
+func (r *recommender) recommend(key string, container *corev1.Container, status *corev1.ContainerStatus, m ContainerMetrics) (recommendation, bool) {
+    if len(m.Cpu) == 0 {
+        return recommendation{}, false
+    }
+
+    rec := recommendation{
+        cpu:    r.applyMargin(r.calc(m.Cpu, m.Times)),
+        memory: r.applyMargin(r.calc(m.Memory, m.Times)),
+    }
+    throttled := r.throttled(m.Throttling)
+    if throttled {
+        rec.cpu = bump(rec.cpu, r.throttlingBump)
+    }
+    rec.memory = r.oomMemory(key, container, status, rec.memory)
+    for _, b := range r.bounds {
+        if b.container == "" || b.container == container.Name {
+            rec.cpu = clamp(rec.cpu, b.minCpu, b.maxCpu)
+            rec.memory = clamp(rec.memory, b.minMemory, b.maxMemory)
+            break
+        }
+    }
+
+    cpuLimit := container.Resources.Limits.Cpu().MilliValue()
+    if throttled {
+        cpuLimit = bump(cpuLimit, r.throttlingBump)
+    }
+    rec.cpuLimit = limit(rec.cpu, r.cpuLimitRatio, cpuLimit)
+    rec.memoryLimit = limit(rec.memory, r.memoryLimitRatio, container.Resources.Limits.Memory().MilliValue())
+    return rec, true
+}
+
+func (r *recommender) calc(x []int64, times []time.Time) float64 {
+    switch r.strategy {
+    case "max":
+        return float64(calcMaxStrategy(x))
+    case "percentile":
+        return float64(calcPercentileStrategy(x, r.percentile))
+    case "histogram":
+        return calcHistogramStrategy(x, times, r.now, r.halfLife, r.percentile)
+    default:
+        return calcMeanStddevStrategy(x, r.stddevFactor)
+    }
+}
+
+func (r *recommender) applyMargin(value float64) int64 {
+    return int64(math.Ceil(value * (1 + r.margin/100)))
+}
+
+func clamp(value int64, min int64, max int64) int64 {
+    if min > 0 && value < min {
+        return min
+    }
+    if max > 0 && value > max {
+        return max
+    }
+    return value
+}
+
+func calcMaxStrategy(x []int64) int64 {
+    maxValue := int64(0)
+    for i := range x {
+        if x[i] > maxValue {
+            maxValue = x[i]
+        }
+    }
+
+    return maxValue
+}
+
+// calcPercentileStrategy uses the nearest-rank method.
+func calcPercentileStrategy(x []int64, percentile float64) int64 {
+    nums := make([]float64, len(x))
+    for i := range x {
+        nums[i] = float64(x[i])
+    }
+    return int64(helper.Percentile(nums, percentile))
+}
+
+// calcHistogramStrategy puts samples into exponentially growing buckets,
+// like the Vertical Pod Autoscaler does. The weight of a sample halves every
+// halfLife, so recent usage matters more. The upper bound of the bucket
+// holding the percentile is returned.
+func calcHistogramStrategy(x []int64, times []time.Time, now time.Time, halfLife time.Duration, percentile float64) float64 {
+    weights := make(map[int]float64)
+    total := float64(0)
+    for i := range x {
+        weight := float64(1)
+        if i < len(times) {
+            weight = math.Exp2(float64(times[i].Sub(now)) / float64(halfLife))
+        }
+        weights[histogramBucket(x[i])] += weight
+        total += weight
+    }
+
+    buckets := make([]int, 0, len(weights))
+    for bucket := range weights {
+        buckets = append(buckets, bucket)
+    }
+    sort.Ints(buckets)
+
+    threshold := total * percentile / 100
+    sum := float64(0)
+    for _, bucket := range buckets {
+        sum += weights[bucket]
+        if sum >= threshold {
+            return histogramBucketEnd(bucket)
+        }
+    }
+    return histogramBucketEnd(buckets[len(buckets)-1])
+}
+
+// histogramBucket returns -1 for zero samples and floor(log(x)) with the
+// base histogramBucketRatio for others.
+func histogramBucket(x int64) int {
+    if x < 1 {
+        return -1
+    }
+    return int(math.Floor(math.Log(float64(x)) / math.Log(histogramBucketRatio)))
+}
+
+func histogramBucketEnd(bucket int) float64 {
+    if bucket < 0 {
+        return 0
+    }
+    return math.Pow(histogramBucketRatio, float64(bucket+1))
+}
+
+func calcMeanStddevStrategy(x []int64, factor float64) float64 {
+    nums := make([]float64, len(x))
+    for i := range x {
+        nums[i] = float64(x[i])
+    }
+    return helper.Mean(nums) + factor*math.Sqrt(helper.Variance(nums))
+}
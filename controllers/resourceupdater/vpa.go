@@ -0,0 +1,196 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourceupdater
+
+import (
+    "context"
+    "math"
+    "sort"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    types "github.com/miha3009/planner/controllers/types"
+    "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/errors"
+    resource "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+    vpaGroup   = "autoscaling.k8s.io"
+    vpaVersion = "v1"
+    // The VPA updater evicts pods whose requests are out of the bounds,
+    // so the bounds leave room for small changes.
+    vpaBoundsTolerance = 0.1
+)
+
+// vpaPublisher collects recommendations of pods by their owners and writes
+// them to VerticalPodAutoscaler objects that target the owners.
+type vpaPublisher struct {
+    clt    client.Client
+    args   *appsv1.VPAArgs
+    owners map[types.Workload]map[string]corev1.ResourceList
+}
+
+func newVPAPublisher(clt client.Client, args *appsv1.VPAArgs) *vpaPublisher {
+    return &vpaPublisher{clt: clt, args: args, owners: make(map[types.Workload]map[string]corev1.ResourceList)}
+}
+
+// Add remembers requests of the updated pod. Containers of pods with the
+// same owner get the largest requests.
+func (p *vpaPublisher) Add(ctx context.Context, pod *corev1.Pod) {
+    owner, err := p.ownerOf(ctx, pod)
+    if err != nil {
+        log.Info("Recommendation of pod ", pod.Name, " will not be published: ", err)
+        return
+    }
+
+    containers, ok := p.owners[owner]
+    if !ok {
+        containers = make(map[string]corev1.ResourceList)
+        p.owners[owner] = containers
+    }
+    for _, container := range pod.Spec.Containers {
+        current, ok := containers[container.Name]
+        if !ok {
+            current = corev1.ResourceList{}
+            containers[container.Name] = current
+        }
+        for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+            quantity, ok := container.Resources.Requests[name]
+            if old, found := current[name]; ok && (!found || quantity.Cmp(old) > 0) {
+                current[name] = quantity
+            }
+        }
+    }
+}
+
+// Publish writes the recommendations to the status of matching objects.
+func (p *vpaPublisher) Publish(ctx context.Context) {
+    if len(p.owners) == 0 {
+        return
+    }
+
+    vpas := &unstructured.UnstructuredList{}
+    vpas.SetGroupVersionKind(vpaGVK("VerticalPodAutoscalerList"))
+    if err := p.clt.List(ctx, vpas); err != nil {
+        log.Info("Failed to list vertical pod autoscalers: ", err)
+        return
+    }
+
+    for i := range vpas.Items {
+        vpa := &vpas.Items[i]
+        if !p.selects(vpa) {
+            continue
+        }
+        kind, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "kind")
+        name, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "name")
+        containers, ok := p.owners[types.Workload{Kind: kind, Namespace: vpa.GetNamespace(), Name: name}]
+        if !ok {
+            continue
+        }
+
+        if err := unstructured.SetNestedField(vpa.Object, vpaRecommendation(containers), "status", "recommendation"); err != nil {
+            log.Info(err)
+            continue
+        }
+        if err := p.updateStatus(ctx, vpa); err != nil {
+            log.Info("Failed to publish recommendation to ", vpa.GetName(), ": ", err)
+            continue
+        }
+        log.Info("Recommendation of ", kind, " ", name, " is published to ", vpa.GetName())
+    }
+}
+
+func (p *vpaPublisher) selects(vpa *unstructured.Unstructured) bool {
+    if p.args.RecommenderName == "" {
+        return true
+    }
+    recommenders, _, _ := unstructured.NestedSlice(vpa.Object, "spec", "recommenders")
+    for _, recommender := range recommenders {
+        if r, ok := recommender.(map[string]interface{}); ok && r["name"] == p.args.RecommenderName {
+            return true
+        }
+    }
+    return false
+}
+
+// updateStatus uses the status subresource if the CRD of the cluster
+// has it and updates the whole object otherwise.
+func (p *vpaPublisher) updateStatus(ctx context.Context, vpa *unstructured.Unstructured) error {
+    err := p.clt.Status().Update(ctx, vpa)
+    if errors.IsNotFound(err) {
+        err = p.clt.Update(ctx, vpa)
+    }
+    return err
+}
+
+// ownerOf finds the controller of the pod. Pods of a ReplicaSet belong to
+// its Deployment if it has one.
+func (p *vpaPublisher) ownerOf(ctx context.Context, pod *corev1.Pod) (types.Workload, error) {
+    return types.OwnerOf(ctx, pod, func(ctx context.Context, namespace string, name string) (metav1.Object, error) {
+        rs := &unstructured.Unstructured{}
+        rs.SetGroupVersionKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"})
+        err := p.clt.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, rs)
+        return rs, err
+    })
+}
+
+// vpaRecommendation builds status.recommendation with containers in name
+// order.
+func vpaRecommendation(containers map[string]corev1.ResourceList) map[string]interface{} {
+    names := make([]string, 0, len(containers))
+    for name := range containers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    recommendations := make([]interface{}, 0, len(names))
+    for _, name := range names {
+        requests := containers[name]
+        recommendations = append(recommendations, map[string]interface{}{
+            "containerName":  name,
+            "target":         vpaResources(requests, 1),
+            "uncappedTarget": vpaResources(requests, 1),
+            "lowerBound":     vpaResources(requests, 1-vpaBoundsTolerance),
+            "upperBound":     vpaResources(requests, 1+vpaBoundsTolerance),
+        })
+    }
+    return map[string]interface{}{"containerRecommendations": recommendations}
+}
+
+// vpaResources scales requests by the factor. Memory is rounded up to
+// whole bytes.
+func vpaResources(requests corev1.ResourceList, factor float64) map[string]interface{} {
+    resources := make(map[string]interface{})
+    if cpu, ok := requests[corev1.ResourceCPU]; ok {
+        milli := int64(math.Ceil(float64(cpu.MilliValue()) * factor))
+        resources["cpu"] = resource.NewMilliQuantity(milli, resource.DecimalSI).String()
+    }
+    if memory, ok := requests[corev1.ResourceMemory]; ok {
+        bytes := int64(math.Ceil(float64(memory.MilliValue()) * factor / 1000))
+        resources["memory"] = resource.NewQuantity(bytes, resource.BinarySI).String()
+    }
+    return resources
+}
+
+func vpaGVK(kind string) schema.GroupVersionKind {
+    return schema.GroupVersionKind{Group: vpaGroup, Version: vpaVersion, Kind: kind}
+}
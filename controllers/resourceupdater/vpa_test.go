@@ -0,0 +1,152 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourceupdater
+
+import (
+    "context"
+    "testing"
+
+    appsv1 "github.com/miha3009/planner/api/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var replicaSetGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}
+
+// vpaScheme registers kinds read by the publisher as unstructured objects,
+// so that the fake client can serve them.
+func vpaScheme() *runtime.Scheme {
+    scheme := runtime.NewScheme()
+    scheme.AddKnownTypeWithName(vpaGVK("VerticalPodAutoscaler"), &unstructured.Unstructured{})
+    scheme.AddKnownTypeWithName(vpaGVK("VerticalPodAutoscalerList"), &unstructured.UnstructuredList{})
+    scheme.AddKnownTypeWithName(replicaSetGVK, &unstructured.Unstructured{})
+    return scheme
+}
+
+func testVPA(name string, targetKind string, target string, recommenders ...string) *unstructured.Unstructured {
+    spec := map[string]interface{}{
+        "targetRef": map[string]interface{}{"apiVersion": "apps/v1", "kind": targetKind, "name": target},
+    }
+    if len(recommenders) > 0 {
+        list := make([]interface{}, 0, len(recommenders))
+        for _, r := range recommenders {
+            list = append(list, map[string]interface{}{"name": r})
+        }
+        spec["recommenders"] = list
+    }
+    vpa := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+    vpa.SetGroupVersionKind(vpaGVK("VerticalPodAutoscaler"))
+    vpa.SetNamespace("default")
+    vpa.SetName(name)
+    return vpa
+}
+
+func testReplicaSet(name string, deployment string) *unstructured.Unstructured {
+    controller := true
+    rs := &unstructured.Unstructured{Object: map[string]interface{}{}}
+    rs.SetGroupVersionKind(replicaSetGVK)
+    rs.SetNamespace("default")
+    rs.SetName(name)
+    rs.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: deployment, UID: "d", Controller: &controller}})
+    return rs
+}
+
+func recommendedPod(name string, kind string, owner string, cpu int64) *corev1.Pod {
+    controller := true
+    return &corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{
+            Namespace:       "default",
+            Name:            name,
+            OwnerReferences: []metav1.OwnerReference{{Kind: kind, Name: owner, Controller: &controller}},
+        },
+        Spec: corev1.PodSpec{Containers: []corev1.Container{
+            {Name: "app", Resources: corev1.ResourceRequirements{Requests: usage(cpu, 1<<20)}},
+        }},
+    }
+}
+
+func target(t *testing.T, clt client.Client, name string) map[string]interface{} {
+    vpa := &unstructured.Unstructured{}
+    vpa.SetGroupVersionKind(vpaGVK("VerticalPodAutoscaler"))
+    if err := clt.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, vpa); err != nil {
+        t.Fatal(err)
+    }
+    recommendations, _, _ := unstructured.NestedSlice(vpa.Object, "status", "recommendation", "containerRecommendations")
+    if len(recommendations) == 0 {
+        return nil
+    }
+    return recommendations[0].(map[string]interface{})
+}
+
+func TestVPAPublisher(t *testing.T) {
+    clt := fake.NewFakeClientWithScheme(vpaScheme(),
+        testReplicaSet("web-1", "web"),
+        testVPA("web", "Deployment", "web"),
+        testVPA("db", "StatefulSet", "db", "default"),
+        testVPA("other", "Deployment", "other"),
+    )
+
+    p := newVPAPublisher(clt, &appsv1.VPAArgs{})
+    p.Add(context.Background(), recommendedPod("web-1-a", "ReplicaSet", "web-1", 100))
+    p.Add(context.Background(), recommendedPod("web-1-b", "ReplicaSet", "web-1", 300))
+    p.Add(context.Background(), recommendedPod("db-0", "StatefulSet", "db", 200))
+    p.Publish(context.Background())
+
+    rec := target(t, clt, "web")
+    if rec == nil || rec["containerName"] != "app" {
+        t.Fatalf("expected a recommendation for the deployment, got %v", rec)
+    }
+    if cpu := rec["target"].(map[string]interface{})["cpu"]; cpu != "300m" {
+        t.Errorf("expected the largest request as the target, got %v", cpu)
+    }
+    if memory := rec["target"].(map[string]interface{})["memory"]; memory != "1Mi" {
+        t.Errorf("expected memory in bytes, got %v", memory)
+    }
+    if cpu := rec["lowerBound"].(map[string]interface{})["cpu"]; cpu != "270m" {
+        t.Errorf("expected the lower bound below the target, got %v", cpu)
+    }
+    if target(t, clt, "db") == nil {
+        t.Errorf("expected a recommendation for the stateful set")
+    }
+    if target(t, clt, "other") != nil {
+        t.Errorf("expected a deployment without pods to be skipped")
+    }
+}
+
+func TestVPAPublisherSelectsRecommender(t *testing.T) {
+    clt := fake.NewFakeClientWithScheme(vpaScheme(),
+        testVPA("planned", "StatefulSet", "a", "planner"),
+        testVPA("default", "StatefulSet", "b"),
+    )
+
+    p := newVPAPublisher(clt, &appsv1.VPAArgs{RecommenderName: "planner"})
+    p.Add(context.Background(), recommendedPod("a-0", "StatefulSet", "a", 100))
+    p.Add(context.Background(), recommendedPod("b-0", "StatefulSet", "b", 100))
+    p.Publish(context.Background())
+
+    if target(t, clt, "planned") == nil {
+        t.Errorf("expected a recommendation for the object selecting the planner")
+    }
+    if target(t, clt, "default") != nil {
+        t.Errorf("expected objects of other recommenders to be kept")
+    }
+}
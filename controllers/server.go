@@ -17,28 +17,24 @@ limitations under the License.
 package controllers
 
 import (
+    "context"
     "encoding/json"
     "fmt"
     "net/http"
     "strconv"
+    "time"
 
+    messages "github.com/miha3009/planner/controllers/messages"
+    multicluster "github.com/miha3009/planner/controllers/multicluster"
     types "github.com/miha3009/planner/controllers/types"
     "github.com/prometheus/common/log"
+    corev1 "k8s.io/api/core/v1"
 )
 
-type MoveMessage struct {
-    Pod string
-    OldNode string
-    NewNode string
-}
-
-type PlanMessage struct {
-    NodesChange int
-    Moves []MoveMessage
-}
+const simulationTimeout = time.Minute
 
-func GetPlanMessage(plan *types.Plan) (PlanMessage, bool) {
-    myPlan := PlanMessage{}
+func GetPlanMessage(plan *types.Plan) (messages.PlanMessage, bool) {
+    myPlan := messages.PlanMessage{}
     if plan == nil {
         return myPlan, false
     }
@@ -46,23 +42,217 @@ func GetPlanMessage(plan *types.Plan) (PlanMessage, bool) {
     if len(plan.NodesToCreate) > 0 {
         myPlan.NodesChange = len(plan.NodesToCreate)
     } else if len(plan.NodesToDelete) > 0 {
-        myPlan.NodesChange = -len(plan.NodesToCreate)
+        myPlan.NodesChange = -len(plan.NodesToDelete)
     } else {
         myPlan.NodesChange = 0
     }
 
-    myPlan.Moves = make([]MoveMessage, len(plan.Movements))
+    myPlan.MonthlySavings = plan.MonthlySavings
+
+    myPlan.Moves = make([]messages.MoveMessage, len(plan.Movements))
     for i := range plan.Movements {
-        myPlan.Moves[i] = MoveMessage{
+        myPlan.Moves[i] = messages.MoveMessage{
             Pod: plan.Movements[i].Pod.Name,
             OldNode: plan.Movements[i].OldNode.Name,
             NewNode: plan.Movements[i].NewNode.Name,
         }
     }
 
+    results := plan.ResultsSnapshot()
+    myPlan.Results = make([]messages.MoveResultMessage, len(results))
+    for i, result := range results {
+        myPlan.Results[i] = messages.MoveResultMessage{
+            Pod:     result.Movement.Pod.Name,
+            NewPod:  result.NewPod,
+            NewNode: result.Movement.NewNode.Name,
+            Ok:      result.Ok,
+            Error:   result.Error,
+        }
+    }
+
     return myPlan, true
 }
 
+func GetStatusMessage(reconciler *PlannerReconciler) messages.StatusMessage {
+    phase, plan := reconciler.Cache.Status()
+    myPlan, ok := GetPlanMessage(plan)
+    return messages.StatusMessage{
+        Active:    reconciler.MainProcess != nil,
+        Phase:     phase,
+        LastStart: reconciler.LastStart,
+        HasPlan:   ok,
+        Plan:      myPlan,
+        Clusters:  GetClusterMessages(reconciler),
+    }
+}
+
+// GetClusterMessages returns the status of the local cluster followed by
+// remote ones, or nothing if the planner plans only the local cluster.
+func GetClusterMessages(reconciler *PlannerReconciler) []messages.ClusterStatusMessage {
+    if reconciler.Clusters == nil {
+        return nil
+    }
+    clusters := reconciler.Clusters.List()
+    if len(clusters) == 0 {
+        return nil
+    }
+
+    capacities := reconciler.Clusters.Capacities()
+    shifts := reconciler.Clusters.Shifts(capacities)
+    res := make([]messages.ClusterStatusMessage, 0, len(clusters)+1)
+
+    clusterMessage := func(name string, phase string, plan *types.Plan, lastStart time.Time) messages.ClusterStatusMessage {
+        myPlan, ok := GetPlanMessage(plan)
+        capacity := capacities[name]
+        return messages.ClusterStatusMessage{
+            Name:              name,
+            Phase:             phase,
+            LastStart:         lastStart,
+            HasPlan:           ok,
+            Plan:              myPlan,
+            Nodes:             capacity.Nodes,
+            CpuUtilization:    capacity.CpuUtilization(),
+            MemoryUtilization: capacity.MemoryUtilization(),
+            NodeShift:         shifts[name],
+        }
+    }
+    phase, plan := reconciler.Cache.Status()
+    res = append(res, clusterMessage(multicluster.LocalCluster, phase, plan, reconciler.LastStart))
+    for _, c := range clusters {
+        phase, plan := c.Status()
+        res = append(res, clusterMessage(c.Name, phase, plan, c.LastStart()))
+    }
+    return res
+}
+
+// selectedCluster returns the remote cluster given by the cluster parameter
+// of the request, or nil for the local one. It writes an error and returns
+// false if the cluster is unknown.
+func selectedCluster(reconciler *PlannerReconciler, w http.ResponseWriter, r *http.Request) (*multicluster.Cluster, bool) {
+    name := r.URL.Query().Get("cluster")
+    if name == "" || name == multicluster.LocalCluster {
+        return nil, true
+    }
+    if reconciler.Clusters != nil {
+        if c, ok := reconciler.Clusters.Get(name); ok {
+            return c, true
+        }
+    }
+    http.Error(w, "Cluster "+name+" not found", http.StatusNotFound)
+    return nil, false
+}
+
+// selectedCache returns the cache of the cluster selected by the request.
+func selectedCache(reconciler *PlannerReconciler, w http.ResponseWriter, r *http.Request) (*types.PlannerCache, bool) {
+    c, ok := selectedCluster(reconciler, w, r)
+    if !ok {
+        return nil, false
+    }
+    if c != nil {
+        return c.Cache, true
+    }
+    return reconciler.Cache, true
+}
+
+func GetExplainMessage(cache *types.PlannerCache) (messages.ExplainMessage, bool) {
+    _, plan := cache.Status()
+    myPlan, ok := GetPlanMessage(plan)
+    if !ok {
+        return messages.ExplainMessage{}, false
+    }
+
+    usage := make(map[string]*messages.NodeUsageMessage)
+    allocatable := make(map[string]corev1.ResourceList)
+    nodes := make([]messages.NodeUsageMessage, 0)
+    for i := range cache.Nodes {
+        nodes = append(nodes, messages.NodeUsageMessage{Node: cache.Nodes[i].Name})
+        allocatable[cache.Nodes[i].Name] = cache.Nodes[i].Status.Allocatable
+    }
+    for i := range plan.NodesToCreate {
+        nodes = append(nodes, messages.NodeUsageMessage{Node: plan.NodesToCreate[i].Name})
+    }
+    for i := range nodes {
+        usage[nodes[i].Node] = &nodes[i]
+    }
+
+    for i := range cache.Pods {
+        if i >= len(cache.Nodes) {
+            break
+        }
+        node := usage[cache.Nodes[i].Name]
+        for j := range cache.Pods[i] {
+            cpu, memory := podUsage(&cache.Pods[i][j], allocatable[node.Node])
+            node.CpuBefore += cpu
+            node.MemoryBefore += memory
+            node.PodsBefore++
+        }
+    }
+    for i := range nodes {
+        nodes[i].CpuAfter = nodes[i].CpuBefore
+        nodes[i].MemoryAfter = nodes[i].MemoryBefore
+        nodes[i].PodsAfter = nodes[i].PodsBefore
+    }
+
+    for _, move := range plan.Movements {
+        oldNode, newNode := usage[move.OldNode.Name], usage[move.NewNode.Name]
+        if oldNode == nil || newNode == nil {
+            continue
+        }
+        cpu, memory := podUsage(move.Pod, allocatable[oldNode.Node])
+        oldNode.CpuAfter -= cpu
+        oldNode.MemoryAfter -= memory
+        oldNode.PodsAfter--
+        cpu, memory = podUsage(move.Pod, allocatable[newNode.Node])
+        newNode.CpuAfter += cpu
+        newNode.MemoryAfter += memory
+        newNode.PodsAfter++
+    }
+
+    return messages.ExplainMessage{Plan: myPlan, Nodes: nodes}, true
+}
+
+// podUsage returns the share of node allocatable resources (in percents)
+// requested by the pod.
+func podUsage(pod *corev1.Pod, allocatable corev1.ResourceList) (float64, float64) {
+    cpu, memory := float64(0), float64(0)
+    maxCpu := float64(allocatable.Cpu().MilliValue())
+    maxMemory := float64(allocatable.Memory().Value())
+
+    for _, container := range pod.Spec.Containers {
+        if maxCpu > 0 {
+            cpu += float64(container.Resources.Requests.Cpu().MilliValue()) * 100 / maxCpu
+        }
+        if maxMemory > 0 {
+            memory += float64(container.Resources.Requests.Memory().Value()) * 100 / maxMemory
+        }
+    }
+
+    return cpu, memory
+}
+
+func GetHistoryMessage(cache *types.PlannerCache) []messages.HistoryMessage {
+    records := cache.PlanHistory()
+    history := make([]messages.HistoryMessage, len(records))
+    for i, record := range records {
+        myPlan, _ := GetPlanMessage(record.Plan)
+        history[i] = messages.HistoryMessage{
+            CreatedAt: record.CreatedAt,
+            Status:    record.Status,
+            Plan:      myPlan,
+        }
+    }
+    return history
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+    b, err := json.Marshal(v)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    fmt.Fprint(w, string(b))
+}
+
 func RunServer(reconciler *PlannerReconciler) {
     http.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
         if r.Method == "POST" {
@@ -80,7 +270,12 @@ func RunServer(reconciler *PlannerReconciler) {
     
     http.HandleFunc("/plan", func(w http.ResponseWriter, r *http.Request) {
         if r.Method == "GET" {
-            myPlan, ok := GetPlanMessage(reconciler.Cache.Plan)
+            cache, found := selectedCache(reconciler, w, r)
+            if !found {
+                return
+            }
+            _, plan := cache.Status()
+            myPlan, ok := GetPlanMessage(plan)
 
             if ok {
                 b, err := json.Marshal(myPlan)
@@ -93,7 +288,12 @@ func RunServer(reconciler *PlannerReconciler) {
 
     http.HandleFunc("/planText", func(w http.ResponseWriter, r *http.Request) {
         if r.Method == "GET" {
-            myPlan, ok := GetPlanMessage(reconciler.Cache.Plan)
+            cache, found := selectedCache(reconciler, w, r)
+            if !found {
+                return
+            }
+            _, plan := cache.Status()
+            myPlan, ok := GetPlanMessage(plan)
             msg := ""
 
             if !ok {
@@ -125,7 +325,92 @@ func RunServer(reconciler *PlannerReconciler) {
 
     http.HandleFunc("/phase", func(w http.ResponseWriter, r *http.Request) {
         if r.Method == "GET" {
-            fmt.Fprint(w, reconciler.Cache.Phase + "\n")
+            if cache, ok := selectedCache(reconciler, w, r); ok {
+                phase, _ := cache.Status()
+                fmt.Fprint(w, phase + "\n")
+            }
+        }
+    })
+
+    http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == "GET" {
+            writeJson(w, GetStatusMessage(reconciler))
+        }
+    })
+
+    http.HandleFunc("/explain", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == "GET" {
+            cache, found := selectedCache(reconciler, w, r)
+            if !found {
+                return
+            }
+            explain, ok := GetExplainMessage(cache)
+            if !ok {
+                http.Error(w, "Plan not found", http.StatusNotFound)
+                return
+            }
+            writeJson(w, explain)
+        }
+    })
+
+    http.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == "GET" {
+            if cache, ok := selectedCache(reconciler, w, r); ok {
+                writeJson(w, GetHistoryMessage(cache))
+            }
+        }
+    })
+
+    http.HandleFunc("/approve", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == "POST" {
+            c, ok := selectedCluster(reconciler, w, r)
+            if !ok {
+                return
+            }
+            if c == nil {
+                reconciler.Events <- types.PlanApproved
+            } else if !c.Approve() {
+                http.Error(w, "No plan of cluster "+c.Name+" is waiting for approval", http.StatusConflict)
+                return
+            }
+            fmt.Fprint(w, "Plan approved\n")
+        }
+    })
+
+    http.HandleFunc("/abort", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == "POST" {
+            c, ok := selectedCluster(reconciler, w, r)
+            if !ok {
+                return
+            }
+            if c == nil {
+                reconciler.Events <- types.PlanAborted
+            } else if !c.Abort() {
+                http.Error(w, "No plan of cluster "+c.Name+" can be aborted", http.StatusConflict)
+                return
+            }
+            fmt.Fprint(w, "Plan aborted\n")
+        }
+    })
+
+    http.HandleFunc("/simulate", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == "POST" {
+            snapshot := &messages.Snapshot{}
+            if err := json.NewDecoder(r.Body).Decode(snapshot); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+
+            ctx, cancel := context.WithTimeout(r.Context(), simulationTimeout)
+            defer cancel()
+            plan, err := Simulate(ctx, snapshot)
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+
+            myPlan, _ := GetPlanMessage(plan)
+            writeJson(w, myPlan)
         }
     })
 
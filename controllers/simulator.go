@@ -0,0 +1,68 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+    "context"
+    "fmt"
+
+    messages "github.com/miha3009/planner/controllers/messages"
+    rescheduler "github.com/miha3009/planner/controllers/rescheduler"
+    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// Simulate generates a plan for the snapshot without executing it.
+func Simulate(ctx context.Context, snapshot *messages.Snapshot) (*types.Plan, error) {
+    if len(snapshot.Nodes) == 0 {
+        return nil, fmt.Errorf("snapshot has no nodes")
+    }
+
+    nodeByName := make(map[string]int)
+    for i := range snapshot.Nodes {
+        nodeByName[snapshot.Nodes[i].Name] = i
+    }
+
+    pods := make([][]corev1.Pod, len(snapshot.Nodes))
+    for i := range pods {
+        pods[i] = make([]corev1.Pod, 0)
+    }
+    for _, pod := range snapshot.Pods {
+        i, ok := nodeByName[pod.Spec.NodeName]
+        if !ok {
+            return nil, fmt.Errorf("pod %s is bound to unknown node '%s'", pod.Name, pod.Spec.NodeName)
+        }
+        pods[i] = append(pods[i], pod)
+    }
+
+    cache := types.NewCache()
+    cache.Nodes = snapshot.Nodes
+    cache.Pods = pods
+
+    events := make(chan types.Event, 1)
+    rescheduler.GenPlan(ctx, events, cache, snapshot.Spec)
+
+    select {
+    case e := <-events:
+        if e != types.PlanningEnded || cache.Plan == nil {
+            return nil, fmt.Errorf("planning failed")
+        }
+        return cache.Plan, nil
+    default:
+        return nil, fmt.Errorf("planning interrupted")
+    }
+}
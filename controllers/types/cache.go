@@ -17,16 +17,41 @@ limitations under the License.
 package types
 
 import (
+    "sync"
+    "time"
+
     corev1 "k8s.io/api/core/v1"
 )
 
+const maxHistorySize int = 20
+
 type PlannerCache struct {
+    // mu guards Plan, Phase and History, which the control server reads
+    // while a cycle runs.
+    mu          sync.RWMutex
     Nodes       []corev1.Node
     Pods        [][]corev1.Pod
     Metrics     MetricsQueue
     UpdatedPods []corev1.Pod
     Plan        *Plan
     Phase       string
+    History     []PlanRecord
+    NodeGroups  map[string]NodeGroup
+    // Node changes made by the executor. They outlive Clear, because
+    // scale-down guards look at previous cycles.
+    LastScaleUp   time.Time
+    NodeDeletions []time.Time
+    // Memory bumps after OOM kills by namespace/pod/container. The resource
+    // updater keeps them between cycles, so that an OOM kill raises memory
+    // only once.
+    OOMBumps      map[string]OOMBump
+}
+
+// OOMBump is the memory in milli units given to a container after the OOM
+// kill that finished at FinishedAt.
+type OOMBump struct {
+    FinishedAt time.Time
+    Memory     int64
 }
 
 func NewCache() *PlannerCache {
@@ -37,6 +62,9 @@ func NewCache() *PlannerCache {
         UpdatedPods: make([]corev1.Pod, 0),
         Plan:        nil,
         Phase:       "Waiting",
+        History:     make([]PlanRecord, 0),
+        NodeGroups:  make(map[string]NodeGroup),
+        OOMBumps:    make(map[string]OOMBump),
     }
 }
 
@@ -44,5 +72,90 @@ func (cache *PlannerCache) Clear() {
     cache.Nodes = make([]corev1.Node, 0)
     cache.Pods = make([][]corev1.Pod, 0)
     cache.UpdatedPods = make([]corev1.Pod, 0)
-    cache.Plan = nil
+    cache.NodeGroups = make(map[string]NodeGroup)
+    cache.SetPlan(nil)
+}
+
+func (cache *PlannerCache) SetPhase(phase string) {
+    cache.mu.Lock()
+    defer cache.mu.Unlock()
+    cache.Phase = phase
+}
+
+func (cache *PlannerCache) SetPlan(plan *Plan) {
+    cache.mu.Lock()
+    defer cache.mu.Unlock()
+    cache.Plan = plan
+}
+
+// Status returns the phase and the plan of the current cycle.
+func (cache *PlannerCache) Status() (string, *Plan) {
+    cache.mu.RLock()
+    defer cache.mu.RUnlock()
+    return cache.Phase, cache.Plan
+}
+
+func (cache *PlannerCache) RecordScaleUp(t time.Time) {
+    cache.LastScaleUp = t
+}
+
+// RecordNodeDeletions remembers deletions of the last hour.
+func (cache *PlannerCache) RecordNodeDeletions(t time.Time, count int) {
+    kept := make([]time.Time, 0, len(cache.NodeDeletions)+count)
+    for _, deletion := range cache.NodeDeletions {
+        if t.Sub(deletion) < time.Hour {
+            kept = append(kept, deletion)
+        }
+    }
+    for i := 0; i < count; i++ {
+        kept = append(kept, t)
+    }
+    cache.NodeDeletions = kept
+}
+
+func (cache *PlannerCache) NodeDeletionsSince(t time.Time) int {
+    count := 0
+    for _, deletion := range cache.NodeDeletions {
+        if deletion.After(t) {
+            count++
+        }
+    }
+    return count
+}
+
+func (cache *PlannerCache) AddToHistory(plan *Plan, status string) {
+    cache.mu.Lock()
+    defer cache.mu.Unlock()
+    cache.History = append(cache.History, PlanRecord{
+        Plan:      plan,
+        CreatedAt: time.Now(),
+        Status:    status,
+    })
+    if len(cache.History) > maxHistorySize {
+        cache.History = cache.History[len(cache.History)-maxHistorySize:]
+    }
+}
+
+func (cache *PlannerCache) SetLastPlanStatus(status string) {
+    cache.mu.Lock()
+    defer cache.mu.Unlock()
+    if len(cache.History) > 0 {
+        cache.History[len(cache.History)-1].Status = status
+    }
+}
+
+func (cache *PlannerCache) LastPlanStatus() string {
+    cache.mu.RLock()
+    defer cache.mu.RUnlock()
+    if len(cache.History) == 0 {
+        return ""
+    }
+    return cache.History[len(cache.History)-1].Status
+}
+
+// PlanHistory returns a copy of the history.
+func (cache *PlannerCache) PlanHistory() []PlanRecord {
+    cache.mu.RLock()
+    defer cache.mu.RUnlock()
+    return append([]PlanRecord{}, cache.History...)
 }
@@ -0,0 +1,47 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+    "sync"
+    "testing"
+)
+
+func TestPlanHistoryIsCopied(t *testing.T) {
+    cache := NewCache()
+    wg := sync.WaitGroup{}
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        for i := 0; i < 100; i++ {
+            cache.AddToHistory(&Plan{}, PlanStatusExecuting)
+            cache.SetLastPlanStatus(PlanStatusExecuted)
+        }
+    }()
+    for i := 0; i < 100; i++ {
+        for _, record := range cache.PlanHistory() {
+            _ = record.Status
+        }
+    }
+    wg.Wait()
+
+    history := cache.PlanHistory()
+    history[0].Status = PlanStatusAborted
+    if cache.History[0].Status == PlanStatusAborted {
+        t.Errorf("expected the history to be copied")
+    }
+}
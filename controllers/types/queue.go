@@ -14,147 +14,395 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
+
 package types
 
 import (
+    "sort"
+    "sync"
     "time"
+
+    corev1 "k8s.io/api/core/v1"
+    resource "k8s.io/apimachinery/pkg/api/resource"
+    metrics "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 )
 
-const minCapacity int = 16
+const (
+    defaultMetricsMaxAge = time.Hour
+    // Well below the max age, so that most of the history is downsampled.
+    defaultDownsampleAfter = time.Minute * 15
+    defaultDownsampleStep  = time.Minute * 5
+)
 
+// MetricsQueue is a time-ordered store of metrics samples shared by the
+// metrics listener and the planning cycle. All methods are safe for
+// concurrent use. Pushed samples must not be modified afterwards, because
+// readers get them without copying the maps.
 type MetricsQueue interface {
     Push(m MetricsPackage)
-    Pop() bool
     Size() int
     Get(idx int) MetricsPackage
+    // Samples returns all samples, oldest first.
+    Samples() []MetricsPackage
+    // Range returns samples taken within [start, end], oldest first.
+    Range(start time.Time, end time.Time) []MetricsPackage
+    // Pod returns the samples of the pod and of the pods it replaced,
+    // oldest first.
+    Pod(key string) []PodSample
+    // Workload returns the samples of all pods of the workload, oldest first.
+    Workload(key string) []PodSample
+    // Owner returns the workload of the pod or an empty string.
+    Owner(pod string) string
+    // SetOwner attributes the pod to the workload given by WorkloadKey.
+    SetOwner(pod string, workload string)
+    // Rename records that newPod replaced oldPod, so that the history of
+    // oldPod is kept for newPod.
+    Rename(oldPod string, newPod string)
+    // Shrink drops samples older than the max age and downsamples old ones.
     Shrink()
-    Lock()
-    Unlock()
     SetMaxAge(maxAge time.Duration)
+    SetDownsampling(after time.Duration, step time.Duration)
+}
+
+// podIdentity links a pod to its workload and to the pods it replaced.
+// Identities of pods without samples are dropped after the max age.
+type podIdentity struct {
+    Workload string
+    Previous []string
+    Updated  time.Time
+}
+
+// PodSample is metrics of one pod taken at Timestamp.
+type PodSample struct {
+    Pod        string
+    Metrics    metrics.PodMetrics
+    Throttling map[string]float64
+    Timestamp  time.Time
 }
 
 type MetricsQueueImpl struct {
-    M ChanMutex
+    mu sync.RWMutex
 
-    buf        []MetricsPackage
-    waitingBuf []MetricsPackage
-    start      int
-    end        int
-    capacity   int
+    buf []MetricsPackage
+    // Positions in buf of samples with metrics of a pod.
+    pods       map[string][]int
+    identities map[string]podIdentity
 
-    maxAge time.Duration
+    maxAge          time.Duration
+    downsampleAfter time.Duration
+    downsampleStep  time.Duration
 }
 
 func NewMetricsQueue() *MetricsQueueImpl {
     return &MetricsQueueImpl{
-        M:          *NewChanMutex(),
-        buf:        make([]MetricsPackage, minCapacity),
-        waitingBuf: make([]MetricsPackage, 0),
-        start:      0,
-        end:        0,
-        capacity:   minCapacity,
-        maxAge:     time.Second * 3600,
+        buf:             make([]MetricsPackage, 0),
+        pods:            make(map[string][]int),
+        identities:      make(map[string]podIdentity),
+        maxAge:          defaultMetricsMaxAge,
+        downsampleAfter: defaultDownsampleAfter,
+        downsampleStep:  defaultDownsampleStep,
     }
 }
 
+// Push adds the sample keeping the queue ordered by time. Samples normally
+// come in order, so it is appended in constant time.
 func (q *MetricsQueueImpl) Push(m MetricsPackage) {
-    if q.M.TryLock() {
-        defer q.M.Unlock()
-        if len(q.waitingBuf) > 0 {
-            for i := range q.waitingBuf {
-                q.push(q.waitingBuf[i])
-            }
-            q.waitingBuf = make([]MetricsPackage, 0)
-        }
-        q.push(m)
-    } else {
-        q.waitingBuf = append(q.waitingBuf, m)
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    idx := sort.Search(len(q.buf), func(i int) bool { return q.buf[i].Timestamp.After(m.Timestamp) })
+    if idx == len(q.buf) {
+        q.buf = append(q.buf, m)
+        q.indexSample(idx)
+        return
     }
+
+    q.buf = append(q.buf, MetricsPackage{})
+    copy(q.buf[idx+1:], q.buf[idx:])
+    q.buf[idx] = m
+    q.reindex()
 }
 
-func (q *MetricsQueueImpl) push(m MetricsPackage) {
-    if q.Size() == q.capacity-1 {
-        q.resize()
-    }
+func (q *MetricsQueueImpl) Size() int {
+    q.mu.RLock()
+    defer q.mu.RUnlock()
+    return len(q.buf)
+}
 
-    q.buf[q.end] = m
-    if q.end == q.capacity-1 {
-        q.end = 0
-    } else {
-        q.end++
+func (q *MetricsQueueImpl) Get(idx int) MetricsPackage {
+    q.mu.RLock()
+    defer q.mu.RUnlock()
+    if idx < 0 || idx >= len(q.buf) {
+        panic("IndexOutOfRangeError")
     }
+    return q.buf[idx]
+}
+
+func (q *MetricsQueueImpl) Samples() []MetricsPackage {
+    q.mu.RLock()
+    defer q.mu.RUnlock()
+    res := make([]MetricsPackage, len(q.buf))
+    copy(res, q.buf)
+    return res
 }
 
-func (q *MetricsQueueImpl) Pop() bool {
-    if q.start == q.end {
-        return false
+func (q *MetricsQueueImpl) Range(start time.Time, end time.Time) []MetricsPackage {
+    q.mu.RLock()
+    defer q.mu.RUnlock()
+    from := sort.Search(len(q.buf), func(i int) bool { return !q.buf[i].Timestamp.Before(start) })
+    to := sort.Search(len(q.buf), func(i int) bool { return q.buf[i].Timestamp.After(end) })
+    if from >= to {
+        return []MetricsPackage{}
     }
+    res := make([]MetricsPackage, to-from)
+    copy(res, q.buf[from:to])
+    return res
+}
 
-    if q.start == q.capacity-1 {
-        q.start = 0
-    } else {
-        q.start++
+func (q *MetricsQueueImpl) Pod(key string) []PodSample {
+    q.mu.RLock()
+    defer q.mu.RUnlock()
+    return q.samplesOf(append([]string{key}, q.identities[key].Previous...))
+}
+
+func (q *MetricsQueueImpl) Workload(key string) []PodSample {
+    q.mu.RLock()
+    defer q.mu.RUnlock()
+    keys := make([]string, 0)
+    for pod, id := range q.identities {
+        if id.Workload == key {
+            keys = append(keys, pod)
+        }
     }
+    return q.samplesOf(keys)
+}
 
-    return true
+func (q *MetricsQueueImpl) Owner(pod string) string {
+    q.mu.RLock()
+    defer q.mu.RUnlock()
+    return q.identities[pod].Workload
 }
 
-func (q *MetricsQueueImpl) Size() int {
-    if q.end >= q.start {
-        return q.end - q.start
-    } else {
-        return q.end - q.start + q.capacity
+func (q *MetricsQueueImpl) SetOwner(pod string, workload string) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    id := q.identities[pod]
+    id.Workload = workload
+    id.Updated = time.Now()
+    q.identities[pod] = id
+}
+
+func (q *MetricsQueueImpl) Rename(oldPod string, newPod string) {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    old := q.identities[oldPod]
+    id := q.identities[newPod]
+    id.Previous = append([]string{oldPod}, old.Previous...)
+    if id.Workload == "" {
+        id.Workload = old.Workload
     }
+    id.Updated = time.Now()
+    q.identities[newPod] = id
 }
 
-func (q *MetricsQueueImpl) Get(idx int) MetricsPackage {
-    if idx < 0 || idx > q.Size() {
-        panic("IndexOutOfRangeError")
+// samplesOf merges samples of the pods in time order.
+func (q *MetricsQueueImpl) samplesOf(keys []string) []PodSample {
+    type position struct {
+        idx int
+        key string
     }
+    positions := make([]position, 0)
+    for _, key := range keys {
+        for _, idx := range q.pods[key] {
+            positions = append(positions, position{idx: idx, key: key})
+        }
+    }
+    sort.SliceStable(positions, func(i, j int) bool { return positions[i].idx < positions[j].idx })
 
-    if q.start+idx >= q.capacity {
-        return q.buf[idx-q.capacity+q.start]
-    } else {
-        return q.buf[idx+q.start]
+    res := make([]PodSample, 0, len(positions))
+    for _, p := range positions {
+        res = append(res, PodSample{
+            Pod:        p.key,
+            Metrics:    q.buf[p.idx].PodMetrics[p.key],
+            Throttling: q.buf[p.idx].CpuThrottling[p.key],
+            Timestamp:  q.buf[p.idx].Timestamp,
+        })
     }
+    return res
 }
 
 func (q *MetricsQueueImpl) Shrink() {
-    if q.M.TryLock() {
-        defer q.M.Unlock()
-        for q.buf[q.start].Timestamp.Before(time.Now().Add(-q.maxAge)) {
-            if !q.Pop() {
-                break
-            }
+    q.mu.Lock()
+    defer q.mu.Unlock()
+
+    now := time.Now()
+    first := sort.Search(len(q.buf), func(i int) bool { return !q.buf[i].Timestamp.Before(now.Add(-q.maxAge)) })
+    kept := q.buf[first:]
+    if q.downsampleStep > 0 {
+        kept = downsample(kept, now.Add(-q.downsampleAfter), q.downsampleStep)
+    }
+
+    // Copy, so that the dropped samples are not held by the old array.
+    q.buf = make([]MetricsPackage, len(kept))
+    copy(q.buf, kept)
+    q.reindex()
+
+    for pod, id := range q.identities {
+        if len(q.pods[pod]) == 0 && id.Updated.Before(now.Add(-q.maxAge)) {
+            delete(q.identities, pod)
         }
     }
 }
 
-func (q *MetricsQueueImpl) Lock() {
-    q.M.Lock()
+// SetMaxAge sets how long samples are kept. Non-positive values are ignored.
+func (q *MetricsQueueImpl) SetMaxAge(maxAge time.Duration) {
+    if maxAge <= 0 {
+        return
+    }
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.maxAge = maxAge
+}
+
+// SetDownsampling makes Shrink merge samples older than after into one
+// sample per step. Non-positive values are replaced with the defaults.
+// Downsampling is off if after is not below the max age.
+func (q *MetricsQueueImpl) SetDownsampling(after time.Duration, step time.Duration) {
+    if after <= 0 {
+        after = defaultDownsampleAfter
+    }
+    if step <= 0 {
+        step = defaultDownsampleStep
+    }
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    q.downsampleAfter = after
+    q.downsampleStep = step
 }
 
-func (q *MetricsQueueImpl) Unlock() {
-    q.M.Unlock()
+func (q *MetricsQueueImpl) indexSample(i int) {
+    for name := range q.buf[i].PodMetrics {
+        q.pods[name] = append(q.pods[name], i)
+    }
 }
 
-func (q *MetricsQueueImpl) SetMaxAge(maxAge time.Duration) {
-    q.maxAge = maxAge
+func (q *MetricsQueueImpl) reindex() {
+    q.pods = make(map[string][]int)
+    for i := range q.buf {
+        q.indexSample(i)
+    }
 }
 
-func (q *MetricsQueueImpl) resize() {
-    newBuf := make([]MetricsPackage, q.capacity<<1)
-    size := q.Size()
+// downsample merges samples taken before cutoff into one sample per step.
+// Buckets that end after cutoff are kept as is, so recent data keeps its
+// resolution.
+func downsample(buf []MetricsPackage, cutoff time.Time, step time.Duration) []MetricsPackage {
+    res := make([]MetricsPackage, 0, len(buf))
+    for i := 0; i < len(buf); {
+        bucket := buf[i].Timestamp.Truncate(step)
+        j := i + 1
+        for j < len(buf) && buf[j].Timestamp.Truncate(step).Equal(bucket) {
+            j++
+        }
+        if j-i > 1 && !bucket.Add(step).After(cutoff) {
+            res = append(res, mergePackages(buf[i:j]))
+        } else {
+            res = append(res, buf[i:j]...)
+        }
+        i = j
+    }
+    return res
+}
 
-    if q.end >= q.start {
-        copy(newBuf, q.buf[q.start:q.end])
-    } else {
-        n := copy(newBuf, q.buf[q.start:])
-        copy(newBuf[n:], q.buf[:q.end+1])
+// mergePackages combines samples into one taken at the time of the last.
+// Cpu and throttling are averaged. Memory keeps the peak, because the
+// recommendations must not hide what caused OOM kills.
+func mergePackages(packs []MetricsPackage) MetricsPackage {
+    res := MetricsPackage{
+        NodeMetrics:   make(map[string]metrics.NodeMetrics),
+        PodMetrics:    make(map[string]metrics.PodMetrics),
+        CpuThrottling: make(map[string]map[string]float64),
+        Timestamp:     packs[len(packs)-1].Timestamp,
     }
 
-    q.start = 0
-    q.end = size
-    q.buf = newBuf
-    q.capacity = q.capacity << 1
+    nodeUsage := make(map[string]*usageAccumulator)
+    containerUsage := make(map[string]map[string]*usageAccumulator)
+    throttling := make(map[string]map[string][]float64)
+    for i := range packs {
+        for name, m := range packs[i].NodeMetrics {
+            res.NodeMetrics[name] = m
+            if nodeUsage[name] == nil {
+                nodeUsage[name] = &usageAccumulator{}
+            }
+            nodeUsage[name].add(m.Usage)
+        }
+        for name, m := range packs[i].PodMetrics {
+            res.PodMetrics[name] = m
+            if containerUsage[name] == nil {
+                containerUsage[name] = make(map[string]*usageAccumulator)
+            }
+            for j := range m.Containers {
+                acc := containerUsage[name][m.Containers[j].Name]
+                if acc == nil {
+                    acc = &usageAccumulator{}
+                    containerUsage[name][m.Containers[j].Name] = acc
+                }
+                acc.add(m.Containers[j].Usage)
+            }
+        }
+        for name, containers := range packs[i].CpuThrottling {
+            if throttling[name] == nil {
+                throttling[name] = make(map[string][]float64)
+            }
+            for container, value := range containers {
+                throttling[name][container] = append(throttling[name][container], value)
+            }
+        }
+    }
+
+    for name, m := range res.NodeMetrics {
+        m.Usage = nodeUsage[name].usage()
+        res.NodeMetrics[name] = m
+    }
+    for name, m := range res.PodMetrics {
+        containers := make([]metrics.ContainerMetrics, 0, len(containerUsage[name]))
+        for container, acc := range containerUsage[name] {
+            containers = append(containers, metrics.ContainerMetrics{Name: container, Usage: acc.usage()})
+        }
+        sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+        m.Containers = containers
+        res.PodMetrics[name] = m
+    }
+    for name, containers := range throttling {
+        res.CpuThrottling[name] = make(map[string]float64)
+        for container, values := range containers {
+            sum := 0.0
+            for _, value := range values {
+                sum += value
+            }
+            res.CpuThrottling[name][container] = sum / float64(len(values))
+        }
+    }
+    return res
+}
+
+type usageAccumulator struct {
+    cpu    int64
+    memory int64
+    count  int64
+}
+
+func (a *usageAccumulator) add(usage corev1.ResourceList) {
+    a.cpu += usage.Cpu().MilliValue()
+    if memory := usage.Memory().Value(); memory > a.memory {
+        a.memory = memory
+    }
+    a.count++
+}
+
+func (a *usageAccumulator) usage() corev1.ResourceList {
+    return corev1.ResourceList{
+        corev1.ResourceCPU:    *resource.NewMilliQuantity(a.cpu/a.count, resource.DecimalSI),
+        corev1.ResourceMemory: *resource.NewQuantity(a.memory, resource.BinarySI),
+    }
 }
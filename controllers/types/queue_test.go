@@ -14,61 +14,192 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
+
 package types
 
 import (
+    "sync"
     "testing"
     "time"
 
-    types "github.com/miha3009/planner/controllers/types"
+    corev1 "k8s.io/api/core/v1"
+    resource "k8s.io/apimachinery/pkg/api/resource"
+    metrics "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 )
 
-func TestSimple(t *testing.T) {
-    queue := types.NewMetricsQueue(time.Second)
-    for i := int64(0); i < 20; i++ {
-        queue.Push(genPackage(i))
+func genPackage(t time.Time, pod string, cpu int64, memory int64) MetricsPackage {
+    return MetricsPackage{
+        PodMetrics: map[string]metrics.PodMetrics{pod: {Containers: []metrics.ContainerMetrics{{
+            Name: "app",
+            Usage: corev1.ResourceList{
+                corev1.ResourceCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+                corev1.ResourceMemory: *resource.NewQuantity(memory, resource.BinarySI),
+            },
+        }}}},
+        Timestamp: t,
     }
+}
 
-    if getIndex(queue.Get(2)) != 2 {
-        t.FailNow()
+func TestPushKeepsOrder(t *testing.T) {
+    queue := NewMetricsQueue()
+    start := time.Now()
+    for _, i := range []int{0, 1, 3, 2} {
+        queue.Push(genPackage(start.Add(time.Duration(i)*time.Second), "web", int64(i), 0))
     }
 
-    queue.Pop()
+    if queue.Size() != 4 {
+        t.Fatalf("expected 4 samples, got %d", queue.Size())
+    }
+    for i, sample := range queue.Pod("web") {
+        if cpu := sample.Metrics.Containers[0].Usage.Cpu().MilliValue(); cpu != int64(i) {
+            t.Errorf("sample %d: expected %dm, got %dm", i, i, cpu)
+        }
+    }
+}
+
+func TestGetOutOfRange(t *testing.T) {
+    queue := NewMetricsQueue()
+    queue.Push(genPackage(time.Now(), "web", 1, 0))
+    defer func() {
+        if recover() == nil {
+            t.Error("expected a panic")
+        }
+    }()
+    queue.Get(1)
+}
+
+func TestRange(t *testing.T) {
+    queue := NewMetricsQueue()
+    start := time.Now()
+    for i := 0; i < 10; i++ {
+        queue.Push(genPackage(start.Add(time.Duration(i)*time.Second), "web", int64(i), 0))
+    }
 
-    if getIndex(queue.Get(2)) != 3 || queue.Size() != 19 {
-        t.FailNow()
+    samples := queue.Range(start.Add(2*time.Second), start.Add(4*time.Second))
+    if len(samples) != 3 || !samples[0].Timestamp.Equal(start.Add(2*time.Second)) {
+        t.Errorf("unexpected range: %+v", samples)
+    }
+    if samples := queue.Range(start.Add(time.Minute), start.Add(time.Hour)); len(samples) != 0 {
+        t.Errorf("expected an empty range, got %d samples", len(samples))
     }
 }
 
-func TestConcurrent(t *testing.T) {
-    queue := types.NewMetricsQueue(time.Second)
-    for i := int64(0); i < 10; i++ {
-        queue.Push(genPackage(i))
-    }
-    queue.Lock()
-    go addToQueue(queue)
-    time.Sleep(time.Second / 10)
-    if queue.Size() != 10 {
-        t.FailNow()
-    }
-    queue.Unlock()
-    time.Sleep(time.Second / 10)
-    queue.Push(genPackage(int64(20)))
-    if queue.Size() != 21 {
-        t.FailNow()
+func TestShrink(t *testing.T) {
+    queue := NewMetricsQueue()
+    queue.Shrink()
+
+    now := time.Now()
+    queue.Push(genPackage(now.Add(-2*time.Hour), "old", 1, 0))
+    queue.Push(genPackage(now, "web", 1, 0))
+    queue.Shrink()
+
+    if queue.Size() != 1 || len(queue.Pod("old")) != 0 || len(queue.Pod("web")) != 1 {
+        t.Errorf("expected only the recent sample to stay, got %d samples", queue.Size())
     }
 }
 
-func addToQueue(queue types.MetricsQueue) {
-    for i := int64(10); i < 20; i++ {
-        queue.Push(genPackage(i))
+func TestDownsample(t *testing.T) {
+    queue := NewMetricsQueue()
+    queue.SetMaxAge(3 * time.Hour)
+    queue.SetDownsampling(time.Hour, time.Hour)
+
+    bucket := time.Now().Add(-2 * time.Hour).Truncate(time.Hour)
+    queue.Push(genPackage(bucket.Add(time.Minute), "web", 100, 300))
+    queue.Push(genPackage(bucket.Add(2*time.Minute), "web", 300, 100))
+    queue.Push(genPackage(time.Now(), "web", 50, 50))
+    queue.Shrink()
+
+    samples := queue.Pod("web")
+    if len(samples) != 2 {
+        t.Fatalf("expected 2 samples after downsampling, got %d", len(samples))
+    }
+    usage := samples[0].Metrics.Containers[0].Usage
+    if usage.Cpu().MilliValue() != 200 || usage.Memory().Value() != 300 {
+        t.Errorf("expected mean cpu and peak memory, got %v", usage)
+    }
+    if !samples[0].Timestamp.Equal(bucket.Add(2 * time.Minute)) {
+        t.Errorf("expected the time of the last merged sample, got %v", samples[0].Timestamp)
     }
 }
 
-func genPackage(x int64) types.MetricsPackage {
-    return types.MetricsPackage{Timestamp: time.UnixMilli(x)}
+func TestDownsampleByDefault(t *testing.T) {
+    queue := NewMetricsQueue()
+    queue.SetDownsampling(0, 0)
+
+    now := time.Now()
+    for i := 59; i >= 0; i-- {
+        queue.Push(genPackage(now.Add(-time.Duration(i)*time.Minute), "web", 100, 100))
+    }
+    queue.Shrink()
+
+    // 15 recent samples stay, the older 45 minutes shrink to about one
+    // sample per 5 minutes.
+    if size := queue.Size(); size < 15 || size > 30 {
+        t.Errorf("expected samples older than 15 minutes to be downsampled, got %d samples", size)
+    }
 }
 
-func getIndex(p types.MetricsPackage) int64 {
-    return p.Timestamp.UnixMilli()
+func TestConcurrent(t *testing.T) {
+    queue := NewMetricsQueue()
+    start := time.Now()
+
+    wg := sync.WaitGroup{}
+    for w := 0; w < 4; w++ {
+        wg.Add(2)
+        go func(w int) {
+            defer wg.Done()
+            for i := 0; i < 50; i++ {
+                queue.Push(genPackage(start.Add(time.Duration(w*50+i)*time.Millisecond), "web", 1, 1))
+                queue.Shrink()
+            }
+        }(w)
+        go func() {
+            defer wg.Done()
+            for i := 0; i < 50; i++ {
+                queue.Samples()
+                queue.Pod("web")
+                queue.Range(start, start.Add(time.Second))
+            }
+        }()
+    }
+    wg.Wait()
+
+    if queue.Size() != 200 {
+        t.Errorf("expected 200 samples, got %d", queue.Size())
+    }
+    samples := queue.Samples()
+    for i := 1; i < len(samples); i++ {
+        if samples[i].Timestamp.Before(samples[i-1].Timestamp) {
+            t.Fatalf("samples are out of order at %d", i)
+        }
+    }
+}
+
+func TestRenameKeepsHistory(t *testing.T) {
+    queue := NewMetricsQueue()
+    start := time.Now()
+    queue.Push(genPackage(start, "default/web-a", 1, 0))
+    queue.Push(genPackage(start.Add(time.Second), "default/web-b", 2, 0))
+    queue.Push(genPackage(start.Add(2*time.Second), "other/web-b", 5, 0))
+    queue.SetOwner("default/web-a", "default/Deployment/web")
+
+    queue.Rename("default/web-a", "default/web-b")
+    queue.Rename("default/web-b", "default/web-c")
+    queue.Push(genPackage(start.Add(3*time.Second), "default/web-c", 3, 0))
+
+    samples := queue.Pod("default/web-c")
+    if len(samples) != 3 {
+        t.Fatalf("expected samples of the pod and the pods it replaced, got %d", len(samples))
+    }
+    for i, sample := range samples {
+        if cpu := sample.Metrics.Containers[0].Usage.Cpu().MilliValue(); cpu != int64(i+1) {
+            t.Errorf("sample %d of %s: expected %dm, got %dm", i, sample.Pod, i+1, cpu)
+        }
+    }
+    if owner := queue.Owner("default/web-c"); owner != "default/Deployment/web" {
+        t.Errorf("expected the owner to pass to the new pod, got %q", owner)
+    }
+    if samples := queue.Workload("default/Deployment/web"); len(samples) != 3 {
+        t.Errorf("expected 3 samples of the workload, got %d", len(samples))
+    }
 }
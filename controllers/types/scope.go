@@ -0,0 +1,85 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+// NodeScope tells which nodes are planned. Nodes out of the scope are never
+// sources or destinations of movements, and neither they nor their pods are
+// changed. A nil scope contains all nodes.
+type NodeScope struct {
+    selector labels.Selector
+    // Match labels of the selector, which new nodes get.
+    labels   map[string]string
+    excluded map[string]bool
+}
+
+func NewNodeScope(selector *metav1.LabelSelector, excluded []string) (*NodeScope, error) {
+    s := &NodeScope{
+        selector: labels.Everything(),
+        excluded: make(map[string]bool),
+    }
+    if selector != nil {
+        var err error
+        if s.selector, err = metav1.LabelSelectorAsSelector(selector); err != nil {
+            return nil, err
+        }
+        s.labels = selector.MatchLabels
+    }
+    for _, name := range excluded {
+        s.excluded[name] = true
+    }
+    return s, nil
+}
+
+func (s *NodeScope) Contains(node *corev1.Node) bool {
+    if s == nil {
+        return true
+    }
+    return !s.excluded[node.Name] && s.selector.Matches(labels.Set(node.Labels))
+}
+
+// Filter returns nodes of the scope.
+func (s *NodeScope) Filter(nodes []corev1.Node) []corev1.Node {
+    res := make([]corev1.Node, 0, len(nodes))
+    for i := range nodes {
+        if s.Contains(&nodes[i]) {
+            res = append(res, nodes[i])
+        }
+    }
+    return res
+}
+
+// WithLabels returns a copy of the planned node with the match labels of
+// the selector, so that the node created from it is in the scope.
+func (s *NodeScope) WithLabels(node *corev1.Node) *corev1.Node {
+    if s == nil || len(s.labels) == 0 {
+        return node
+    }
+    node = node.DeepCopy()
+    if node.Labels == nil {
+        node.Labels = make(map[string]string)
+    }
+    for key, value := range s.labels {
+        node.Labels[key] = value
+    }
+    return node
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeScope(t *testing.T) {
+    nodes := []corev1.Node{
+        {ObjectMeta: metav1.ObjectMeta{Name: "master", Labels: map[string]string{"node-role.kubernetes.io/control-plane": ""}}},
+        {ObjectMeta: metav1.ObjectMeta{Name: "worker-a"}},
+        {ObjectMeta: metav1.ObjectMeta{Name: "worker-b"}},
+        {ObjectMeta: metav1.ObjectMeta{Name: "gpu", Labels: map[string]string{"pool": "gpu"}}},
+    }
+
+    var all *NodeScope
+    if len(all.Filter(nodes)) != len(nodes) {
+        t.Errorf("expected nil scope to contain all nodes")
+    }
+
+    scope, err := NewNodeScope(&metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+        {Key: "node-role.kubernetes.io/control-plane", Operator: metav1.LabelSelectorOpDoesNotExist},
+        {Key: "pool", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"gpu"}},
+    }}, []string{"worker-b"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    filtered := scope.Filter(nodes)
+    if len(filtered) != 1 || filtered[0].Name != "worker-a" {
+        t.Errorf("expected only worker-a in scope, got %v", filtered)
+    }
+
+    if _, err := NewNodeScope(&metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+        {Key: "pool", Operator: "Unknown"},
+    }}, nil); err == nil {
+        t.Errorf("expected invalid selector to be rejected")
+    }
+}
+
+func TestNodeScopeWithLabels(t *testing.T) {
+    scope, err := NewNodeScope(&metav1.LabelSelector{MatchLabels: map[string]string{"team": "web"}}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    planned := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "0", Labels: map[string]string{"pool": "small"}}}
+
+    node := scope.WithLabels(planned)
+    if !scope.Contains(node) || node.Labels["pool"] != "small" {
+        t.Errorf("expected the node to be in the scope and keep its labels, got %v", node.Labels)
+    }
+    if _, ok := planned.Labels["team"]; ok {
+        t.Errorf("expected the planned node not to be changed")
+    }
+    if (*NodeScope)(nil).WithLabels(planned) != planned {
+        t.Errorf("expected a nil scope to keep the node")
+    }
+}
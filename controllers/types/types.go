@@ -17,6 +17,8 @@ limitations under the License.
 package types
 
 import (
+    "strings"
+    "sync"
     "time"
 
     corev1 "k8s.io/api/core/v1"
@@ -33,15 +35,31 @@ const (
     PlanningEnded               = 4
     ExecutingEnded              = 5
     PhaseEndedWithError         = 6
+    PlanApproved                = 7
+    PlanAborted                 = 8
+)
+
+const (
+    PlanStatusPendingApproval = "pending approval"
+    PlanStatusExecuting       = "executing"
+    PlanStatusExecuted        = "executed"
+    PlanStatusAborted         = "aborted"
 )
 
 const MaxPreferenceScore = float64(100)
 
+// PodInfo is a pod as the rescheduler sees it. Cpu and Memory are the
+// sizes pods are packed by, either requests or predicted usage.
 type PodInfo struct {
     Pod    *corev1.Pod
     Name   string
     Cpu    int64
     Memory int64
+
+    RequestCpu    int64
+    RequestMemory int64
+    UsageCpu      int64
+    UsageMemory   int64
 }
 
 type NodeInfo struct {
@@ -58,6 +76,71 @@ type NodeInfo struct {
     Ports           map[string]map[int32]struct{}
     PortsConflict   map[string]map[int32]int
     UntoleratedPods []string
+
+    Pool *NodePool
+    // Price of the node per hour, zero if unknown.
+    HourlyCost float64
+}
+
+// PoolAnnotation holds the pool name on planned nodes of a node pool.
+const PoolAnnotation = "planner.hse.ru/pool"
+
+// NewNodePrefix starts the names of planned nodes. Node names can not have
+// a colon, so a planned node never has the name of an existing one.
+const NewNodePrefix = "planned:"
+
+// NewNodeName returns the name of a planned node.
+func NewNodeName(name string) string {
+    return NewNodePrefix + name
+}
+
+// IsNewNode reports whether the node is planned and does not exist yet.
+func IsNewNode(node *corev1.Node) bool {
+    return node != nil && strings.HasPrefix(node.Name, NewNodePrefix)
+}
+
+// NodePool is a group of identical nodes. Cpu and Memory are in the same
+// units as NodeInfo.MaxCpu and NodeInfo.MaxMemory.
+type NodePool struct {
+    Name       string
+    Cpu        int64
+    Memory     int64
+    Labels     map[string]string
+    Taints     []corev1.Taint
+    MinNodes   int
+    MaxNodes   int
+    HourlyCost float64
+}
+
+// Matches reports whether the node has all labels of the pool.
+func (p *NodePool) Matches(node *corev1.Node) bool {
+    if len(p.Labels) == 0 || node == nil {
+        return false
+    }
+    for key, value := range p.Labels {
+        if node.Labels[key] != value {
+            return false
+        }
+    }
+    return true
+}
+
+// Usage returns the largest share of allocatable cpu or memory requested
+// by pods of the node, capped at 1.
+func (n *NodeInfo) Usage() float64 {
+    usage := float64(0)
+    if n.AvalibleCpu > 0 {
+        usage = float64(n.PodsCpu) / float64(n.AvalibleCpu)
+    }
+    if n.AvalibleMemory > 0 {
+        if memoryUsage := float64(n.PodsMemory) / float64(n.AvalibleMemory); memoryUsage > usage {
+            usage = memoryUsage
+        }
+    }
+    if usage > 1 {
+        usage = 1
+    }
+    return usage
 }
 
 func (n *NodeInfo) AddPod(p PodInfo) {
@@ -96,14 +179,65 @@ type Movement struct {
     NewNode *corev1.Node
 }
 
+type MovementResult struct {
+    Movement Movement
+    NewPod   string
+    Ok       bool
+    Error    string
+}
+
 type Plan struct {
     Movements     []Movement
     NodesToDelete []corev1.Node
     NodesToCreate []corev1.Node
+    // Results are appended by the executor while the control server reads
+    // them, so they are changed only under mu.
+    Results       []MovementResult
+    mu            sync.RWMutex
+    // Estimated change of the cluster cost per month, positive if the plan
+    // saves money.
+    MonthlySavings float64
+}
+
+func (plan *Plan) SetResults(results []MovementResult) {
+    plan.mu.Lock()
+    defer plan.mu.Unlock()
+    plan.Results = results
+}
+
+func (plan *Plan) AddResults(results ...MovementResult) {
+    plan.mu.Lock()
+    defer plan.mu.Unlock()
+    plan.Results = append(plan.Results, results...)
+}
+
+// ResultsSnapshot returns a copy of the results.
+func (plan *Plan) ResultsSnapshot() []MovementResult {
+    plan.mu.RLock()
+    defer plan.mu.RUnlock()
+    return append([]MovementResult{}, plan.Results...)
+}
+
+type PlanRecord struct {
+    Plan      *Plan
+    CreatedAt time.Time
+    Status    string
+}
+
+// NodeGroup is a cluster-autoscaler node group with its size bounds.
+type NodeGroup struct {
+    Name       string
+    MinSize    int
+    MaxSize    int
+    TargetSize int
 }
 
+// MetricsPackage is a sample of usage. Pods are keyed by PodKey.
 type MetricsPackage struct {
-    NodeMetrics map[string]metrics.NodeMetrics
-    PodMetrics  map[string]metrics.PodMetrics
-    Timestamp   time.Time
+    NodeMetrics   map[string]metrics.NodeMetrics
+    PodMetrics    map[string]metrics.PodMetrics
+    // Share of throttled cpu periods by pod and container, if the metrics
+    // source reports it.
+    CpuThrottling map[string]map[string]float64
+    Timestamp     time.Time
 }
@@ -0,0 +1,93 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const podTemplateHashLabel = "pod-template-hash"
+
+// PodKey identifies a pod in metrics. Pod names are unique only within
+// a namespace.
+func PodKey(namespace string, name string) string {
+    return namespace + "/" + name
+}
+
+// Workload is the controller of pods.
+type Workload struct {
+    Kind      string
+    Namespace string
+    Name      string
+}
+
+// Key returns the workload as namespace/kind/name.
+func (w Workload) Key() string {
+    return w.Namespace + "/" + w.Kind + "/" + w.Name
+}
+
+// ReplicaSetGetter reads a ReplicaSet, so that OwnerOf can find its
+// controller.
+type ReplicaSetGetter func(ctx context.Context, namespace string, name string) (metav1.Object, error)
+
+// OwnerOf finds the workload that controls the pod. Pods of a ReplicaSet
+// belong to its Deployment if it has one. The ReplicaSet is read with
+// getReplicaSet, or, if it is nil, the Deployment is recognized by the
+// pod-template-hash suffix of the ReplicaSet name.
+func OwnerOf(ctx context.Context, pod *corev1.Pod, getReplicaSet ReplicaSetGetter) (Workload, error) {
+    ref := metav1.GetControllerOf(pod)
+    if ref == nil {
+        return Workload{}, fmt.Errorf("pod %s has no owner", pod.Name)
+    }
+    owner := Workload{Kind: ref.Kind, Namespace: pod.Namespace, Name: ref.Name}
+    if ref.Kind != "ReplicaSet" {
+        return owner, nil
+    }
+
+    if getReplicaSet == nil {
+        if hash, ok := pod.Labels[podTemplateHashLabel]; ok && strings.HasSuffix(ref.Name, "-"+hash) {
+            owner.Kind, owner.Name = "Deployment", strings.TrimSuffix(ref.Name, "-"+hash)
+        }
+        return owner, nil
+    }
+
+    rs, err := getReplicaSet(ctx, pod.Namespace, ref.Name)
+    if err != nil {
+        return Workload{}, err
+    }
+    if rsRef := metav1.GetControllerOf(rs); rsRef != nil && rsRef.Kind == "Deployment" {
+        owner.Kind, owner.Name = rsRef.Kind, rsRef.Name
+    }
+    return owner, nil
+}
+
+// WorkloadKey identifies the workload that controls the pod, as
+// namespace/kind/name. Pods of a Deployment are attributed to the Deployment
+// rather than to its current ReplicaSet, so history survives rollouts. It
+// returns an empty string for pods without a controller.
+func WorkloadKey(pod *corev1.Pod) string {
+    owner, err := OwnerOf(context.Background(), pod, nil)
+    if err != nil {
+        return ""
+    }
+    return owner.Key()
+}
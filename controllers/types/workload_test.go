@@ -0,0 +1,86 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+    "context"
+    "fmt"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWorkloadKey(t *testing.T) {
+    controller := true
+    pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+        Namespace: "default",
+        Name:      "web-7c9f8-x2k4p",
+        Labels:    map[string]string{"pod-template-hash": "7c9f8"},
+        OwnerReferences: []metav1.OwnerReference{
+            {Kind: "Node", Name: "node-1"},
+            {Kind: "ReplicaSet", Name: "web-7c9f8", Controller: &controller},
+        },
+    }}
+    if key := WorkloadKey(pod); key != "default/Deployment/web" {
+        t.Errorf("expected the deployment of the replica set, got %q", key)
+    }
+
+    pod.OwnerReferences[1] = metav1.OwnerReference{Kind: "StatefulSet", Name: "db", Controller: &controller}
+    if key := WorkloadKey(pod); key != "default/StatefulSet/db" {
+        t.Errorf("expected the stateful set, got %q", key)
+    }
+
+    pod.OwnerReferences = nil
+    if key := WorkloadKey(pod); key != "" {
+        t.Errorf("expected no workload, got %q", key)
+    }
+}
+
+func TestOwnerOfReadsReplicaSet(t *testing.T) {
+    controller := true
+    pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+        Namespace:       "default",
+        Name:            "web-1-a",
+        OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-1", Controller: &controller}},
+    }}
+    replicaSets := map[string]*metav1.ObjectMeta{
+        "web-1": {OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", Controller: &controller}}},
+        "bare":  {},
+    }
+    getReplicaSet := func(ctx context.Context, namespace string, name string) (metav1.Object, error) {
+        if rs, ok := replicaSets[name]; ok && namespace == "default" {
+            return rs, nil
+        }
+        return nil, fmt.Errorf("replica set %s not found", name)
+    }
+
+    owner, err := OwnerOf(context.Background(), pod, getReplicaSet)
+    if err != nil || owner != (Workload{Kind: "Deployment", Namespace: "default", Name: "web"}) {
+        t.Errorf("expected the deployment of the replica set, got %v, %v", owner, err)
+    }
+
+    pod.OwnerReferences[0].Name = "bare"
+    if owner, err := OwnerOf(context.Background(), pod, getReplicaSet); err != nil || owner.Kind != "ReplicaSet" {
+        t.Errorf("expected the replica set without a deployment, got %v, %v", owner, err)
+    }
+
+    pod.OwnerReferences[0].Name = "missing"
+    if _, err := OwnerOf(context.Background(), pod, getReplicaSet); err == nil {
+        t.Errorf("expected an error for a missing replica set")
+    }
+}
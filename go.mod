@@ -6,10 +6,12 @@ require (
 	github.com/go-logr/logr v0.3.0
 	github.com/onsi/ginkgo v1.14.1
 	github.com/onsi/gomega v1.10.2
-	github.com/prometheus/common v0.10.0 // indirect
-	k8s.io/api v0.19.2 // indirect
+	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/common v0.10.0
+	k8s.io/api v0.19.2
 	k8s.io/apimachinery v0.19.2
 	k8s.io/client-go v0.19.2
 	k8s.io/metrics v0.19.2
 	sigs.k8s.io/controller-runtime v0.7.2
+	sigs.k8s.io/yaml v1.2.0
 )
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+    "context"
     "os"
     "time"
 
@@ -24,17 +25,20 @@ import (
     // to ensure that exec-entrypoint and run can make use of them.
     _ "k8s.io/client-go/plugin/pkg/client/auth"
 
+    corev1 "k8s.io/api/core/v1"
     "k8s.io/apimachinery/pkg/runtime"
     utilruntime "k8s.io/apimachinery/pkg/util/runtime"
     clientset "k8s.io/client-go/kubernetes"
     clientgoscheme "k8s.io/client-go/kubernetes/scheme"
     metricsv "k8s.io/metrics/pkg/client/clientset/versioned"
     ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
 
     appsv1 "github.com/miha3009/planner/api/v1"
     controllers "github.com/miha3009/planner/controllers"
     executor "github.com/miha3009/planner/controllers/executor"
     informer "github.com/miha3009/planner/controllers/informer"
+    multicluster "github.com/miha3009/planner/controllers/multicluster"
     types "github.com/miha3009/planner/controllers/types"
     "github.com/prometheus/common/log"
     //+kubebuilder:scaffold:imports
@@ -56,6 +60,9 @@ func main() {
     config := ctrl.GetConfigOrDie()
     mgr, err := ctrl.NewManager(config, ctrl.Options{
         Scheme: scheme,
+        // ConfigMaps are read rarely and only by name, so they are not worth
+        // a cluster-wide informer, which the RBAC role does not allow anyway.
+        ClientDisableCacheFor: []client.Object{&corev1.ConfigMap{}},
     })
     if err != nil {
         log.Error(err, "Unable to start manager")
@@ -74,22 +81,32 @@ func main() {
         os.Exit(1)
     }
 
+    if err := executor.RecoverExecution(context.Background(), clientset, executor.JournalNamespace()); err != nil {
+        log.Error(err, "Unable to recover plan execution")
+    }
+    cache := types.NewCache()
+    if err := executor.LoadNodeChanges(context.Background(), clientset, executor.JournalNamespace(), cache); err != nil {
+        log.Error(err, "Unable to load node changes")
+    }
+
     log.Info("Starting the Controller")
     events := make(chan types.Event, 10)
     events <- types.Start
     reconciler := &controllers.PlannerReconciler{
-        Client:         mgr.GetClient(),
-        Clientset:      clientset,
-        Log:            ctrl.Log.WithName("controllers").WithName("Planner"),
-        Scheme:         mgr.GetScheme(),
-        MetricsClient:  metricsclientset,
-        Events:         events,
-        Cache:          types.NewCache(),
-        MainProcess:    nil,
-        MetricsProcess: nil,
-        LastStart:      time.Time{},
-        Informer:       &informer.DefaultInformer{},
-        Executor:       &executor.DefaultExecutor{},
+        Client:           mgr.GetClient(),
+        Clientset:        clientset,
+        Log:              ctrl.Log.WithName("controllers").WithName("Planner"),
+        Scheme:           mgr.GetScheme(),
+        MetricsClient:    metricsclientset,
+        Events:           events,
+        Cache:            cache,
+        MainProcess:      nil,
+        MetricsProcess:   nil,
+        ExecutionProcess: nil,
+        LastStart:        time.Time{},
+        Clusters:         multicluster.NewSet(),
+        Informer:         &informer.DefaultInformer{},
+        Executor:         &executor.DefaultExecutor{},
     }
     if err = reconciler.SetupWithManager(mgr); err != nil {
         log.Error(err, "unable to create controller", "controller", "Planner")
@@ -54,18 +54,19 @@ func NewController(planner *appsv1.Planner, nodes []corev1.Node, pods [][]corev1
     events <- types.Start
 
     return &controllers.PlannerReconciler{
-        Client:         nil,
-        Clientset:      nil,
-        Log:            ctrl.Log.WithName("controllers").WithName("Planner"),
-        Scheme:         nil,
-        MetricsClient:  nil,
-        Events:         events,
-        Cache:          types.NewCache(),
-        MainProcess:    nil,
-        MetricsProcess: nil,
-        LastStart:      time.Time{},
-        Informer:       NewInformer(planner, nodes, pods, metrics),
-        Executor:       &TestingExecutor{},
+        Client:           nil,
+        Clientset:        nil,
+        Log:              ctrl.Log.WithName("controllers").WithName("Planner"),
+        Scheme:           nil,
+        MetricsClient:    nil,
+        Events:           events,
+        Cache:            types.NewCache(),
+        MainProcess:      nil,
+        MetricsProcess:   nil,
+        ExecutionProcess: nil,
+        LastStart:        time.Time{},
+        Informer:         NewInformer(planner, nodes, pods, metrics),
+        Executor:         &TestingExecutor{},
     }
 }
 